@@ -0,0 +1,195 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"time"
+
+	"1337b04rd/internal/app"
+	"1337b04rd/internal/backup"
+	"1337b04rd/internal/export"
+)
+
+// runCommand runs a one-off CLI subcommand instead of the HTTP server
+func runCommand(app *app.App, name string, args []string) error {
+	switch name {
+	case "export-static":
+		return runExportStatic(app, args)
+	case "export-thread":
+		return runExportThread(app, args)
+	case "import-thread":
+		return runImportThread(app, args)
+	case "backup":
+		return runBackup(app, args)
+	case "restore":
+		return runRestore(app, args)
+	default:
+		return fmt.Errorf("unknown command %q", name)
+	}
+}
+
+func runExportStatic(app *app.App, args []string) error {
+	flags := flag.NewFlagSet("export-static", flag.ContinueOnError)
+	board := flags.String("board", "b", "board to export")
+	since := flags.String("since", "", "only export threads created on or after this date (YYYY-MM-DD)")
+	out := flags.String("out", "./site", "output directory")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+
+	var sinceTime time.Time
+	if *since != "" {
+		parsed, err := time.Parse("2006-01-02", *since)
+		if err != nil {
+			return fmt.Errorf("invalid --since date: %w", err)
+		}
+		sinceTime = parsed
+	}
+
+	exporter := export.NewStaticExporter(app.PostService, app.CommentService, app.Storage)
+	result, err := exporter.Export(context.Background(), export.StaticOptions{
+		Board:  *board,
+		Since:  sinceTime,
+		OutDir: *out,
+	})
+	if err != nil {
+		return err
+	}
+
+	fmt.Printf("Exported /%s/ to %s: %d threads written, %d unchanged, %d images copied\n",
+		*board, *out, result.ThreadsWritten, result.ThreadsUnchanged, result.ImagesCopied)
+	return nil
+}
+
+func runExportThread(app *app.App, args []string) error {
+	flags := flag.NewFlagSet("export-thread", flag.ContinueOnError)
+	id := flags.Int("id", 0, "ID of the thread to export")
+	out := flags.String("out", "", "output file (default thread-<id>.zip)")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+	if *id <= 0 {
+		return errors.New("--id is required")
+	}
+	if *out == "" {
+		*out = fmt.Sprintf("thread-%d.zip", *id)
+	}
+
+	file, err := os.Create(*out)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	if err := app.TransferService.ExportThread(context.Background(), *id, file); err != nil {
+		os.Remove(*out)
+		return err
+	}
+	if err := file.Close(); err != nil {
+		return err
+	}
+
+	fmt.Printf("Exported thread %d to %s\n", *id, *out)
+	return nil
+}
+
+func runImportThread(app *app.App, args []string) error {
+	flags := flag.NewFlagSet("import-thread", flag.ContinueOnError)
+	in := flags.String("file", "", "thread archive to import")
+	board := flags.String("board", "", "board to import into (default the thread's original board)")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+	if *in == "" {
+		return errors.New("--file is required")
+	}
+
+	file, err := os.Open(*in)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	info, err := file.Stat()
+	if err != nil {
+		return err
+	}
+
+	post, err := app.TransferService.ImportThread(context.Background(), file, info.Size(), *board)
+	if err != nil {
+		return err
+	}
+
+	fmt.Printf("Imported %s as thread %d on /%s/\n", *in, post.ID, post.Board)
+	return nil
+}
+
+func runBackup(app *app.App, args []string) error {
+	flags := flag.NewFlagSet("backup", flag.ContinueOnError)
+	out := flags.String("out", "", "output file (default backup-<timestamp>.zip)")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+	if *out == "" {
+		*out = "backup-" + time.Now().UTC().Format("20060102T150405Z") + ".zip"
+	}
+
+	file, err := os.Create(*out)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	manifest, err := backup.NewArchiver(app.DB, app.Storage).Create(context.Background(), file)
+	if err != nil {
+		os.Remove(*out)
+		return err
+	}
+	if err := file.Close(); err != nil {
+		return err
+	}
+
+	rows := 0
+	for _, table := range manifest.Tables {
+		rows += table.Rows
+	}
+	fmt.Printf("Backed up %d rows and %d objects to %s\n", rows, len(manifest.Objects), *out)
+	return nil
+}
+
+func runRestore(app *app.App, args []string) error {
+	flags := flag.NewFlagSet("restore", flag.ContinueOnError)
+	in := flags.String("file", "", "backup archive to restore")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+	if *in == "" {
+		return errors.New("--file is required")
+	}
+
+	file, err := os.Open(*in)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	info, err := file.Stat()
+	if err != nil {
+		return err
+	}
+
+	manifest, err := backup.NewArchiver(app.DB, app.Storage).Restore(context.Background(), file, info.Size())
+	if err != nil {
+		return err
+	}
+
+	rows := 0
+	for _, table := range manifest.Tables {
+		rows += table.Rows
+	}
+	fmt.Printf("Restored %d rows and %d objects from %s\n", rows, len(manifest.Objects), *in)
+	return nil
+}
@@ -34,8 +34,24 @@ func main() {
 	}
 	defer app.Close()
 
+	// Run a CLI subcommand instead of the server when one is given
+	if len(os.Args) > 1 {
+		if err := runCommand(app, os.Args[1], os.Args[2:]); err != nil {
+			logger.Error("Command failed", "command", os.Args[1], "error", err)
+			app.Close()
+			os.Exit(1)
+		}
+		return
+	}
+
+	// Start background maintenance (thread expiry, upload collection and
+	// archive retention)
+	maintenanceCtx, stopMaintenance := context.WithCancel(context.Background())
+	defer stopMaintenance()
+	go app.RunMaintenance(maintenanceCtx, cfg.Archive.MaintenanceInterval, cfg.Archive.Retention)
+
 	// Setup router
-	router := setupRouter(app)
+	router := setupRouter(app, cfg)
 
 	// Create HTTP server
 	server := &http.Server{
@@ -74,7 +90,7 @@ func main() {
 	logger.Info("Server exited")
 }
 
-func setupRouter(app *app.App) *mux.Router {
+func setupRouter(app *app.App, cfg *config.Config) *mux.Router {
 	router := mux.NewRouter()
 
 	// Add CORS middleware BEFORE any routes
@@ -90,7 +106,8 @@ func setupRouter(app *app.App) *mux.Router {
 
 		w.Header().Set("Access-Control-Allow-Origin", allowedOrigin)
 		w.Header().Set("Access-Control-Allow-Methods", "GET, POST, PUT, DELETE, OPTIONS")
-		w.Header().Set("Access-Control-Allow-Headers", "Content-Type, Authorization, X-Requested-With, Accept")
+		w.Header().Set("Access-Control-Allow-Headers", "Content-Type, Authorization, X-Requested-With, Accept, If-Match, If-None-Match, If-Modified-Since, Range")
+		w.Header().Set("Access-Control-Expose-Headers", "ETag, Content-Range, Accept-Ranges, Content-Length")
 		w.Header().Set("Access-Control-Allow-Credentials", "true")
 		w.Header().Set("Access-Control-Max-Age", "86400") // 24 hours
 		w.WriteHeader(http.StatusOK)
@@ -117,6 +134,18 @@ func setupRouter(app *app.App) *mux.Router {
 	characters.HandleFunc("/random", app.CharacterHandler.GetRandomCharacter).Methods("GET")
 	characters.HandleFunc("", app.CharacterHandler.GetAllCharacters).Methods("GET")
 
+	// Catalog routes
+	api.HandleFunc("/catalog", app.PostHandler.GetCatalog).Methods("GET")
+	api.HandleFunc("/boards/{slug}/catalog", app.PostHandler.GetCatalog).Methods("GET")
+	api.HandleFunc("/boards/{slug}/reactions", app.ReactionHandler.GetBoardReactions).Methods("GET")
+
+	// Archive routes (read-only)
+	api.HandleFunc("/archive", app.PostHandler.GetArchive).Methods("GET")
+	api.HandleFunc("/archive/threads", app.PostHandler.GetArchivedPosts).Methods("GET")
+
+	// Live event stream (Server-Sent Events)
+	api.HandleFunc("/events", app.EventHandler.StreamEvents).Methods("GET")
+
 	// Health check
 	api.HandleFunc("/health", func(w http.ResponseWriter, r *http.Request) {
 		w.Header().Set("Content-Type", "application/json")
@@ -133,8 +162,14 @@ func setupRouter(app *app.App) *mux.Router {
 	posts.HandleFunc("/{id:[0-9]+}", app.PostHandler.GetPost).Methods("GET")
 	posts.HandleFunc("/{id:[0-9]+}", app.PostHandler.UpdatePost).Methods("PUT")
 	posts.HandleFunc("/{id:[0-9]+}", app.PostHandler.DeletePost).Methods("DELETE")
+	posts.HandleFunc("/{id:[0-9]+}/revisions", app.PostHandler.GetPostRevisions).Methods("GET")
 	posts.HandleFunc("/{id:[0-9]+}/archive", app.PostHandler.ArchivePost).Methods("POST")
 	posts.HandleFunc("/{id:[0-9]+}/unarchive", app.PostHandler.UnarchivePost).Methods("POST")
+	posts.HandleFunc("/{id:[0-9]+}/export", app.TransferHandler.ExportThread).Methods("GET")
+	posts.HandleFunc("/{id:[0-9]+}/reactions", app.ReactionHandler.AddPostReaction).Methods("POST")
+	posts.HandleFunc("/{id:[0-9]+}/reactions", app.ReactionHandler.RemovePostReaction).Methods("DELETE")
+	posts.HandleFunc("/{id:[0-9]+}/poll", app.PollHandler.GetPoll).Methods("GET")
+	posts.HandleFunc("/{id:[0-9]+}/poll/vote", app.PollHandler.Vote).Methods("POST")
 	posts.HandleFunc("/author", app.PostHandler.GetPostsByAuthor).Methods("GET")
 
 	// Comment routes (protected)
@@ -144,13 +179,57 @@ func setupRouter(app *app.App) *mux.Router {
 	comments.HandleFunc("/{id:[0-9]+}", app.CommentHandler.GetComment).Methods("GET")
 	comments.HandleFunc("/{id:[0-9]+}", app.CommentHandler.UpdateComment).Methods("PUT")
 	comments.HandleFunc("/{id:[0-9]+}", app.CommentHandler.DeleteComment).Methods("DELETE")
+	comments.HandleFunc("/{id:[0-9]+}/revisions", app.CommentHandler.GetCommentRevisions).Methods("GET")
 	comments.HandleFunc("/post", app.CommentHandler.GetCommentsByPost).Methods("GET")
+	comments.HandleFunc("/{id:[0-9]+}/reactions", app.ReactionHandler.AddCommentReaction).Methods("POST")
+	comments.HandleFunc("/{id:[0-9]+}/reactions", app.ReactionHandler.RemoveCommentReaction).Methods("DELETE")
+
+	// Direct upload routes (protected)
+	uploads := api.PathPrefix("/uploads").Subrouter()
+	uploads.Use(sessionMiddleware.ExtractSession)
+	uploads.HandleFunc("", app.UploadHandler.CreateUpload).Methods("POST")
+
+	// Admin routes (admin token required)
+	adminMiddleware := middleware.NewAdminMiddleware(cfg.Admin.Token)
+	admin := api.PathPrefix("/admin").Subrouter()
+	admin.Use(adminMiddleware.RequireAdmin)
+	admin.HandleFunc("/posts/{id:[0-9]+}/sticky", app.AdminHandler.StickyPost).Methods("POST")
+	admin.HandleFunc("/posts/{id:[0-9]+}/unsticky", app.AdminHandler.UnstickyPost).Methods("POST")
+	admin.HandleFunc("/posts/{id:[0-9]+}/lock", app.AdminHandler.LockPost).Methods("POST")
+	admin.HandleFunc("/posts/{id:[0-9]+}/unlock", app.AdminHandler.UnlockPost).Methods("POST")
+	admin.HandleFunc("/posts/expire", app.AdminHandler.ExpirePosts).Methods("POST")
+	admin.HandleFunc("/threads/import", app.TransferHandler.ImportThread).Methods("POST")
+	admin.HandleFunc("/boards/{slug}/reactions", app.ReactionHandler.SetBoardReactions).Methods("PUT")
+	admin.HandleFunc("/boards/{slug}/limits", app.AdminHandler.SetBoardLimits).Methods("PUT")
+	admin.HandleFunc("/boards/{slug}/image-ban-action", app.ImageBanHandler.SetBoardImageBanAction).Methods("PUT")
+	admin.HandleFunc("/image-bans", app.ImageBanHandler.GetImageBans).Methods("GET")
+	admin.HandleFunc("/image-bans", app.ImageBanHandler.CreateImageBan).Methods("POST")
+	admin.HandleFunc("/image-bans/{id:[0-9]+}", app.ImageBanHandler.DeleteImageBan).Methods("DELETE")
+	admin.HandleFunc("/attachments/held", app.ImageBanHandler.GetHeldAttachments).Methods("GET")
+	admin.HandleFunc("/images/{bucket}/{key}", app.ImageServer.ServeHeld).Methods("GET", "HEAD")
+	admin.HandleFunc("/attachments/{id:[0-9]+}/approve", app.ImageBanHandler.ApproveAttachment).Methods("POST")
+	admin.HandleFunc("/attachments/{id:[0-9]+}/reject", app.ImageBanHandler.RejectAttachment).Methods("POST")
+	admin.HandleFunc("/filters", app.FilterHandler.GetFilterRules).Methods("GET")
+	admin.HandleFunc("/filters", app.FilterHandler.CreateFilterRule).Methods("POST")
+	admin.HandleFunc("/filters/reload", app.FilterHandler.ReloadFilterRules).Methods("POST")
+	admin.HandleFunc("/filters/{id:[0-9]+}", app.FilterHandler.UpdateFilterRule).Methods("PUT")
+	admin.HandleFunc("/filters/{id:[0-9]+}", app.FilterHandler.DeleteFilterRule).Methods("DELETE")
+	admin.HandleFunc("/flagged", app.FilterHandler.GetFlagged).Methods("GET")
+	admin.HandleFunc("/posts/{id:[0-9]+}/unflag", app.FilterHandler.UnflagPost).Methods("POST")
+	admin.HandleFunc("/comments/{id:[0-9]+}/unflag", app.FilterHandler.UnflagComment).Methods("POST")
+	admin.HandleFunc("/quarantines", app.QuarantineHandler.GetQuarantines).Methods("GET")
+	admin.HandleFunc("/quarantines", app.QuarantineHandler.CreateQuarantine).Methods("POST")
+	admin.HandleFunc("/quarantines/{id:[0-9]+}", app.QuarantineHandler.DeleteQuarantine).Methods("DELETE")
+	admin.HandleFunc("/pending", app.QuarantineHandler.GetPending).Methods("GET")
+	admin.HandleFunc("/posts/{id:[0-9]+}/approve", app.QuarantineHandler.ApprovePost).Methods("POST")
+	admin.HandleFunc("/posts/{id:[0-9]+}/reject", app.QuarantineHandler.RejectPost).Methods("POST")
+	admin.HandleFunc("/comments/{id:[0-9]+}/approve", app.QuarantineHandler.ApproveComment).Methods("POST")
+	admin.HandleFunc("/comments/{id:[0-9]+}/reject", app.QuarantineHandler.RejectComment).Methods("POST")
 
 	// Image serving routes
-	router.HandleFunc("/images/posts/{filename}", app.Storage.ServePostImageHandler()).Methods("GET")
-	router.HandleFunc("/images/comments/{filename}", app.Storage.ServeCommentImageHandler()).Methods("GET")
-	router.HandleFunc("/images/avatars/{filename}", app.Storage.ServeAvatarImageHandler()).Methods("GET")
-	router.HandleFunc("/images/proxy", app.Storage.ServeImageFromURL()).Methods("GET")
+	images := router.PathPrefix("/images").Subrouter()
+	images.HandleFunc("/proxy", app.ImageServer.ServeProxy).Methods("GET", "HEAD")
+	images.HandleFunc("/{bucket}/{key}", app.ImageServer.ServeObject).Methods("GET", "HEAD")
 
 	return router
 }
@@ -166,7 +245,8 @@ func corsMiddleware(next http.Handler) http.Handler {
 		// Set CORS headers for ALL requests
 		w.Header().Set("Access-Control-Allow-Origin", allowedOrigin)
 		w.Header().Set("Access-Control-Allow-Methods", "GET, POST, PUT, DELETE, OPTIONS")
-		w.Header().Set("Access-Control-Allow-Headers", "Content-Type, Authorization, X-Requested-With, Accept")
+		w.Header().Set("Access-Control-Allow-Headers", "Content-Type, Authorization, X-Requested-With, Accept, If-Match, If-None-Match, If-Modified-Since, Range")
+		w.Header().Set("Access-Control-Expose-Headers", "ETag, Content-Range, Accept-Ranges, Content-Length")
 		w.Header().Set("Access-Control-Allow-Credentials", "true")
 		w.Header().Set("Access-Control-Max-Age", "86400") // 24 hours
 
@@ -5,15 +5,24 @@ import (
 	"log"
 	"os"
 	"strconv"
+	"strings"
+	"time"
 
 	"github.com/joho/godotenv"
 )
 
 type Config struct {
-	DB     DBConfig
-	MinIO  MinIOConfig
-	Server ServerConfig
-	Log    LogConfig
+	DB       DBConfig
+	MinIO    MinIOConfig
+	Server   ServerConfig
+	Log      LogConfig
+	Tripcode TripcodeConfig
+	Admin    AdminConfig
+	Archive  ArchiveConfig
+	Media    MediaConfig
+	Filter   FilterConfig
+	IPHash   IPHashConfig
+	Edit     EditConfig
 }
 
 type DBConfig struct {
@@ -41,6 +50,66 @@ type LogConfig struct {
 	Level string
 }
 
+type TripcodeConfig struct {
+	Secret string
+}
+
+// String keeps the tripcode secret out of logged configuration
+func (t TripcodeConfig) String() string {
+	return "{Secret:[redacted]}"
+}
+
+type ArchiveConfig struct {
+	// Retention is how long archived threads are kept; zero keeps them forever
+	Retention           time.Duration
+	MaintenanceInterval time.Duration
+}
+
+type MediaConfig struct {
+	// VideoTypes are the video content types boards accept as attachments
+	VideoTypes []string
+
+	// UploadExpiry is how long a presigned upload URL stays valid; uploads
+	// not used by a post or comment by then are collected
+	UploadExpiry time.Duration
+}
+
+type FilterConfig struct {
+	// Budget is how long the word filters may spend on one post or
+	// comment before it is flagged for moderation unfiltered
+	Budget time.Duration
+}
+
+type EditConfig struct {
+	// Window is how long after posting authors may edit a post or comment;
+	// zero leaves edits open
+	Window time.Duration
+}
+
+type IPHashConfig struct {
+	// Secret keys the hashes stored for poster addresses; without one a
+	// random key is used and quarantines by address end at restart
+	Secret string
+
+	// TrustProxy takes the client address from X-Real-IP or
+	// X-Forwarded-For; only enable it behind a proxy that sets them
+	TrustProxy bool
+}
+
+// String keeps the address hash secret out of logged configuration
+func (i IPHashConfig) String() string {
+	return fmt.Sprintf("{Secret:[redacted] TrustProxy:%t}", i.TrustProxy)
+}
+
+type AdminConfig struct {
+	Token string
+}
+
+// String keeps the admin token out of logged configuration
+func (a AdminConfig) String() string {
+	return "{Token:[redacted]}"
+}
+
 func Load() *Config {
 	// Load .env file if it exists
 	if err := godotenv.Load(); err != nil {
@@ -69,6 +138,30 @@ func Load() *Config {
 		Log: LogConfig{
 			Level: getEnv("LOG_LEVEL", "info"),
 		},
+		Tripcode: TripcodeConfig{
+			Secret: getEnv("TRIPCODE_SECRET", ""),
+		},
+		Admin: AdminConfig{
+			Token: getEnv("ADMIN_TOKEN", ""),
+		},
+		Archive: ArchiveConfig{
+			Retention:           getEnvAsDuration("ARCHIVE_RETENTION", 0),
+			MaintenanceInterval: getEnvAsDuration("MAINTENANCE_INTERVAL", 10*time.Minute),
+		},
+		Media: MediaConfig{
+			VideoTypes:   getEnvAsList("MEDIA_VIDEO_TYPES", []string{"video/webm", "video/mp4"}),
+			UploadExpiry: getEnvAsDuration("MEDIA_UPLOAD_EXPIRY", 15*time.Minute),
+		},
+		Filter: FilterConfig{
+			Budget: getEnvAsDuration("FILTER_BUDGET", 50*time.Millisecond),
+		},
+		IPHash: IPHashConfig{
+			Secret:     getEnv("IP_HASH_SECRET", ""),
+			TrustProxy: getEnvAsBool("TRUST_PROXY_HEADERS", false),
+		},
+		Edit: EditConfig{
+			Window: getEnvAsDuration("EDIT_WINDOW", 0),
+		},
 	}
 }
 
@@ -101,3 +194,27 @@ func getEnvAsBool(key string, defaultValue bool) bool {
 	}
 	return defaultValue
 }
+
+func getEnvAsList(key string, defaultValue []string) []string {
+	value := os.Getenv(key)
+	if value == "" {
+		return defaultValue
+	}
+
+	var list []string
+	for _, item := range strings.Split(value, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			list = append(list, item)
+		}
+	}
+	return list
+}
+
+func getEnvAsDuration(key string, defaultValue time.Duration) time.Duration {
+	if value := os.Getenv(key); value != "" {
+		if durationValue, err := time.ParseDuration(value); err == nil {
+			return durationValue
+		}
+	}
+	return defaultValue
+}
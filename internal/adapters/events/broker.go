@@ -0,0 +1,54 @@
+package events
+
+import (
+	"1337b04rd/internal/domain/models"
+	"sync"
+)
+
+// subscriberBuffer is how many events a slow subscriber may fall behind
+// before further events are dropped for it
+const subscriberBuffer = 16
+
+// Broker fans events out to every subscribed live client in this process
+type Broker struct {
+	mu          sync.RWMutex
+	subscribers map[chan models.Event]struct{}
+}
+
+func NewBroker() *Broker {
+	return &Broker{
+		subscribers: make(map[chan models.Event]struct{}),
+	}
+}
+
+// Subscribe registers a new subscriber. The returned function must be
+// called to unsubscribe once the client goes away.
+func (b *Broker) Subscribe() (<-chan models.Event, func()) {
+	ch := make(chan models.Event, subscriberBuffer)
+
+	b.mu.Lock()
+	b.subscribers[ch] = struct{}{}
+	b.mu.Unlock()
+
+	return ch, func() {
+		b.mu.Lock()
+		if _, ok := b.subscribers[ch]; ok {
+			delete(b.subscribers, ch)
+			close(ch)
+		}
+		b.mu.Unlock()
+	}
+}
+
+// Publish delivers an event to all subscribers without blocking
+func (b *Broker) Publish(event models.Event) {
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+
+	for ch := range b.subscribers {
+		select {
+		case ch <- event:
+		default:
+		}
+	}
+}
@@ -0,0 +1,126 @@
+package handler
+
+import (
+	"1337b04rd/internal/domain/models"
+	"1337b04rd/internal/domain/ports"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strconv"
+
+	"github.com/gorilla/mux"
+)
+
+type AdminHandler struct {
+	postService ports.PostService
+}
+
+func NewAdminHandler(postService ports.PostService) *AdminHandler {
+	return &AdminHandler{
+		postService: postService,
+	}
+}
+
+// postIDFromPath parses the {id} path variable, writing a 400 on failure
+func postIDFromPath(w http.ResponseWriter, r *http.Request) (int, bool) {
+	postIDStr := mux.Vars(r)["id"]
+	if postIDStr == "" {
+		http.Error(w, "Post ID is required", http.StatusBadRequest)
+		return 0, false
+	}
+
+	postID, err := strconv.Atoi(postIDStr)
+	if err != nil {
+		http.Error(w, "Invalid post ID", http.StatusBadRequest)
+		return 0, false
+	}
+
+	return postID, true
+}
+
+func (h *AdminHandler) StickyPost(w http.ResponseWriter, r *http.Request) {
+	h.setSticky(w, r, true)
+}
+
+func (h *AdminHandler) UnstickyPost(w http.ResponseWriter, r *http.Request) {
+	h.setSticky(w, r, false)
+}
+
+func (h *AdminHandler) LockPost(w http.ResponseWriter, r *http.Request) {
+	h.setLocked(w, r, true)
+}
+
+func (h *AdminHandler) UnlockPost(w http.ResponseWriter, r *http.Request) {
+	h.setLocked(w, r, false)
+}
+
+func (h *AdminHandler) setSticky(w http.ResponseWriter, r *http.Request, sticky bool) {
+	postID, ok := postIDFromPath(w, r)
+	if !ok {
+		return
+	}
+
+	err := h.postService.SetSticky(r.Context(), postID, sticky)
+	if err != nil {
+		http.Error(w, "Failed to update sticky flag: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+}
+
+func (h *AdminHandler) setLocked(w http.ResponseWriter, r *http.Request, locked bool) {
+	postID, ok := postIDFromPath(w, r)
+	if !ok {
+		return
+	}
+
+	err := h.postService.SetLocked(r.Context(), postID, locked)
+	if err != nil {
+		http.Error(w, "Failed to update locked flag: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+}
+
+// SetBoardLimits changes the limits of a board from a JSON body holding any
+// of "bump_limit", "max_threads", "max_attachments", "max_file_size" (in
+// bytes) and "max_video_duration" (in seconds). Limits left out keep their
+// value.
+func (h *AdminHandler) SetBoardLimits(w http.ResponseWriter, r *http.Request) {
+	var limits models.BoardLimits
+	if err := json.NewDecoder(r.Body).Decode(&limits); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	err := h.postService.SetBoardLimits(r.Context(), mux.Vars(r)["slug"], limits)
+	if errors.Is(err, models.ErrBoardNotFound) {
+		http.Error(w, "Board not found", http.StatusNotFound)
+		return
+	}
+	if errors.Is(err, models.ErrInvalidLimits) {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if err != nil {
+		http.Error(w, "Failed to update board limits: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+}
+
+// ExpirePosts archives every thread past its expiry time, skipping sticky
+// and locked threads
+func (h *AdminHandler) ExpirePosts(w http.ResponseWriter, r *http.Request) {
+	archived, err := h.postService.ArchiveExpiredPosts(r.Context())
+	if err != nil {
+		http.Error(w, "Failed to expire posts: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]int{"archived": archived})
+}
@@ -0,0 +1,77 @@
+package handler
+
+import (
+	"1337b04rd/internal/adapters/storage"
+	"1337b04rd/internal/domain/models"
+	"fmt"
+	"io"
+	"mime/multipart"
+	"net/http"
+	"strconv"
+)
+
+// parseAttachmentForm reads the files of a parsed multipart form: the legacy
+// single "image" field followed by repeated "attachments" fields, then the
+// IDs of direct uploads from repeated "uploads" fields. The i-th
+// attachment's alt text and spoiler flag come from "alt_text_<i>" and
+// "spoiler_<i>".
+func parseAttachmentForm(r *http.Request) ([]*models.AttachmentUpload, error) {
+	if r.MultipartForm == nil {
+		return nil, nil
+	}
+
+	var headers []*multipart.FileHeader
+	headers = append(headers, r.MultipartForm.File["image"]...)
+	headers = append(headers, r.MultipartForm.File["attachments"]...)
+
+	uploads := make([]*models.AttachmentUpload, 0, len(headers))
+	for _, header := range headers {
+		if header.Size > models.MaxAttachmentSize {
+			return nil, fmt.Errorf("%w: %s is larger than %d MB", models.ErrInvalidAttachment, header.Filename, models.MaxAttachmentSize>>20)
+		}
+
+		data, err := readFormFile(header)
+		if err != nil {
+			return nil, err
+		}
+
+		uploads = append(uploads, &models.AttachmentUpload{
+			Filename:    header.Filename,
+			ContentType: header.Header.Get("Content-Type"),
+			Data:        data,
+		})
+	}
+
+	for _, id := range r.MultipartForm.Value["uploads"] {
+		if id != "" {
+			uploads = append(uploads, &models.AttachmentUpload{UploadID: id})
+		}
+	}
+
+	for i, upload := range uploads {
+		index := strconv.Itoa(i)
+		spoiler, _ := strconv.ParseBool(r.FormValue("spoiler_" + index))
+		upload.Spoiler = spoiler || r.FormValue("spoiler_"+index) == "on"
+		upload.AltText = r.FormValue("alt_text_" + index)
+	}
+
+	return uploads, nil
+}
+
+func readFormFile(header *multipart.FileHeader) ([]byte, error) {
+	file, err := header.Open()
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	return io.ReadAll(file)
+}
+
+// convertAttachmentURLs converts MinIO URLs to backend proxy URLs in attachments
+func convertAttachmentURLs(attachments []*models.Attachment) {
+	for _, attachment := range attachments {
+		attachment.URL = storage.ConvertMinioURLToProxyURL(attachment.URL)
+		attachment.ThumbnailURL = storage.ConvertMinioURLToProxyURL(attachment.ThumbnailURL)
+	}
+}
@@ -5,8 +5,11 @@ import (
 	"1337b04rd/internal/adapters/storage"
 	"1337b04rd/internal/domain/models"
 	"1337b04rd/internal/domain/ports"
+	"1337b04rd/pkg/iphash"
+	"1337b04rd/pkg/tripcode"
 	"encoding/json"
-	"mime/multipart"
+	"errors"
+	"log"
 	"net/http"
 	"strconv"
 
@@ -14,12 +17,29 @@ import (
 )
 
 type CommentHandler struct {
-	commentService ports.CommentService
+	commentService  ports.CommentService
+	reactionService ports.ReactionService
+	tripcodes       *tripcode.Generator
+	ips             *iphash.Hasher
 }
 
-func NewCommentHandler(commentService ports.CommentService) *CommentHandler {
+func NewCommentHandler(commentService ports.CommentService, reactionService ports.ReactionService, tripcodes *tripcode.Generator, ips *iphash.Hasher) *CommentHandler {
 	return &CommentHandler{
-		commentService: commentService,
+		commentService:  commentService,
+		reactionService: reactionService,
+		tripcodes:       tripcodes,
+		ips:             ips,
+	}
+}
+
+// loadSessionReactions marks the reactions the requesting session gave
+func (h *CommentHandler) loadSessionReactions(r *http.Request, comments []*models.Comment) {
+	session := middleware.GetSessionFromContext(r.Context())
+	if session == nil {
+		return
+	}
+	if err := h.reactionService.LoadSessionCommentReactions(r.Context(), session.ID, comments); err != nil {
+		log.Printf("Failed to load session reactions: %v", err)
 	}
 }
 
@@ -31,6 +51,7 @@ func convertCommentURLs(comment *models.Comment) {
 	if comment.AuthorImage != "" {
 		comment.AuthorImage = storage.ConvertMinioURLToProxyURL(comment.AuthorImage)
 	}
+	convertAttachmentURLs(comment.Attachments)
 }
 
 // convertCommentsURLs converts MinIO URLs to backend proxy URLs in a slice of comments
@@ -60,6 +81,7 @@ func (h *CommentHandler) CreateComment(w http.ResponseWriter, r *http.Request) {
 	title := r.FormValue("title")
 	content := r.FormValue("content")
 	replyToCommentIDStr := r.FormValue("reply_to_comment_id")
+	sage, _ := strconv.ParseBool(r.FormValue("sage"))
 
 	if postIDStr == "" || title == "" || content == "" {
 		http.Error(w, "Missing required fields", http.StatusBadRequest)
@@ -80,6 +102,17 @@ func (h *CommentHandler) CreateComment(w http.ResponseWriter, r *http.Request) {
 		AuthorID:    session.ID,
 		AuthorName:  session.Name,
 		AuthorImage: session.Image,
+		IPHash:      h.ips.Request(r),
+		Sage:        sage || r.FormValue("sage") == "on",
+	}
+
+	// Optional name field in "name#password" or "name##password" form.
+	// Only the derived tripcode is kept, never the password itself.
+	if name, trip := h.tripcodes.Parse(r.FormValue("name")); name != "" || trip != "" {
+		if name != "" {
+			comment.AuthorName = name
+		}
+		comment.Tripcode = trip
 	}
 
 	// Handle reply to comment if provided
@@ -92,17 +125,31 @@ func (h *CommentHandler) CreateComment(w http.ResponseWriter, r *http.Request) {
 		comment.ReplyToCommentID = &replyToCommentID
 	}
 
-	// Get image file if provided
-	var imageFile multipart.File
-	var imageHeader *multipart.FileHeader
-	if file, header, err := r.FormFile("image"); err == nil {
-		imageFile = file
-		imageHeader = header
-		defer imageFile.Close()
+	// Get attached files if provided
+	uploads, err := parseAttachmentForm(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
 	}
 
 	// Create comment
-	err = h.commentService.CreateComment(r.Context(), comment, imageFile, imageHeader)
+	err = h.commentService.CreateComment(r.Context(), comment, uploads)
+	if errors.Is(err, models.ErrPostNotFound) {
+		http.Error(w, "Post not found", http.StatusNotFound)
+		return
+	}
+	if errors.Is(err, models.ErrThreadArchived) {
+		http.Error(w, "Thread is archived and read-only", http.StatusForbidden)
+		return
+	}
+	if errors.Is(err, models.ErrThreadLocked) {
+		http.Error(w, "Thread is locked and no longer accepts replies", http.StatusLocked)
+		return
+	}
+	if errors.Is(err, models.ErrTooManyAttachments) || errors.Is(err, models.ErrInvalidAttachment) || errors.Is(err, models.ErrUploadNotFound) || errors.Is(err, models.ErrBannedImage) || errors.Is(err, models.ErrContentRejected) {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
 	if err != nil {
 		http.Error(w, "Failed to create comment: "+err.Error(), http.StatusInternalServerError)
 		return
@@ -131,7 +178,11 @@ func (h *CommentHandler) GetComment(w http.ResponseWriter, r *http.Request) {
 	}
 
 	// Get comment
-	comment, err := h.commentService.GetComment(r.Context(), commentID)
+	comment, err := h.commentService.GetComment(r.Context(), commentID, viewerFromRequest(r))
+	if errors.Is(err, models.ErrCommentNotFound) {
+		http.Error(w, "Comment not found", http.StatusNotFound)
+		return
+	}
 	if err != nil {
 		http.Error(w, "Failed to get comment: "+err.Error(), http.StatusInternalServerError)
 		return
@@ -143,7 +194,9 @@ func (h *CommentHandler) GetComment(w http.ResponseWriter, r *http.Request) {
 	}
 
 	// Convert URLs and return comment
+	h.loadSessionReactions(r, []*models.Comment{comment})
 	convertCommentURLs(comment)
+	w.Header().Set("ETag", versionETag(comment.Version))
 	w.Header().Set("Content-Type", "application/json")
 	json.NewEncoder(w).Encode(comment)
 }
@@ -163,13 +216,18 @@ func (h *CommentHandler) GetCommentsByPost(w http.ResponseWriter, r *http.Reques
 	}
 
 	// Get comments by post
-	comments, err := h.commentService.GetCommentsByPost(r.Context(), postID)
+	comments, err := h.commentService.GetCommentsByPost(r.Context(), postID, viewerFromRequest(r))
+	if errors.Is(err, models.ErrPostNotFound) {
+		http.Error(w, "Post not found", http.StatusNotFound)
+		return
+	}
 	if err != nil {
 		http.Error(w, "Failed to get comments: "+err.Error(), http.StatusInternalServerError)
 		return
 	}
 
 	// Convert URLs and return comments
+	h.loadSessionReactions(r, comments)
 	convertCommentsURLs(comments)
 	w.Header().Set("Content-Type", "application/json")
 	json.NewEncoder(w).Encode(comments)
@@ -204,21 +262,8 @@ func (h *CommentHandler) UpdateComment(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	// Get the existing comment to verify ownership
-	existingComment, err := h.commentService.GetComment(r.Context(), commentID)
-	if err != nil {
-		http.Error(w, "Failed to get comment: "+err.Error(), http.StatusInternalServerError)
-		return
-	}
-
-	if existingComment == nil {
-		http.Error(w, "Comment not found", http.StatusNotFound)
-		return
-	}
-
-	// Check if the user owns this comment
-	if existingComment.AuthorID != session.ID {
-		http.Error(w, "Unauthorized: You can only update your own comments", http.StatusForbidden)
+	version, ok := expectedVersion(w, r)
+	if !ok {
 		return
 	}
 
@@ -239,19 +284,42 @@ func (h *CommentHandler) UpdateComment(w http.ResponseWriter, r *http.Request) {
 		AuthorID:    session.ID,
 		AuthorName:  session.Name,
 		AuthorImage: session.Image,
+		Version:     version,
 	}
 
-	// Get image file if provided
-	var imageFile multipart.File
-	var imageHeader *multipart.FileHeader
-	if file, header, err := r.FormFile("image"); err == nil {
-		imageFile = file
-		imageHeader = header
-		defer imageFile.Close()
+	// Get attached files if provided
+	uploads, err := parseAttachmentForm(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
 	}
 
 	// Update comment
-	err = h.commentService.UpdateComment(r.Context(), comment, imageFile, imageHeader)
+	err = h.commentService.UpdateComment(r.Context(), comment, uploads)
+	if errors.Is(err, models.ErrCommentNotFound) {
+		http.Error(w, "Comment not found", http.StatusNotFound)
+		return
+	}
+	if errors.Is(err, models.ErrNotAuthor) {
+		http.Error(w, "Unauthorized: You can only update your own comments", http.StatusForbidden)
+		return
+	}
+	if errors.Is(err, models.ErrVersionConflict) {
+		http.Error(w, "Comment was edited since this version", http.StatusPreconditionFailed)
+		return
+	}
+	if errors.Is(err, models.ErrThreadArchived) {
+		http.Error(w, "Thread is archived and read-only", http.StatusForbidden)
+		return
+	}
+	if errors.Is(err, models.ErrEditWindowClosed) {
+		http.Error(w, "The edit window for this comment has closed", http.StatusForbidden)
+		return
+	}
+	if errors.Is(err, models.ErrTooManyAttachments) || errors.Is(err, models.ErrInvalidAttachment) || errors.Is(err, models.ErrUploadNotFound) || errors.Is(err, models.ErrBannedImage) || errors.Is(err, models.ErrContentRejected) {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
 	if err != nil {
 		http.Error(w, "Failed to update comment: "+err.Error(), http.StatusInternalServerError)
 		return
@@ -259,10 +327,34 @@ func (h *CommentHandler) UpdateComment(w http.ResponseWriter, r *http.Request) {
 
 	// Convert URLs and return updated comment
 	convertCommentURLs(comment)
+	w.Header().Set("ETag", versionETag(comment.Version))
 	w.Header().Set("Content-Type", "application/json")
 	json.NewEncoder(w).Encode(comment)
 }
 
+// GetCommentRevisions returns a comment's edit history, oldest first
+func (h *CommentHandler) GetCommentRevisions(w http.ResponseWriter, r *http.Request) {
+	commentID, err := strconv.Atoi(mux.Vars(r)["id"])
+	if err != nil {
+		http.Error(w, "Invalid comment ID", http.StatusBadRequest)
+		return
+	}
+
+	revisions, err := h.commentService.GetCommentRevisions(r.Context(), commentID, viewerFromRequest(r))
+	if errors.Is(err, models.ErrCommentNotFound) {
+		http.Error(w, "Comment not found", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		http.Error(w, "Failed to get revisions: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	convertRevisionsURLs(revisions)
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(revisions)
+}
+
 func (h *CommentHandler) DeleteComment(w http.ResponseWriter, r *http.Request) {
 	// Get session from context
 	session := middleware.GetSessionFromContext(r.Context())
@@ -286,7 +378,11 @@ func (h *CommentHandler) DeleteComment(w http.ResponseWriter, r *http.Request) {
 	}
 
 	// Get the existing comment to verify ownership
-	existingComment, err := h.commentService.GetComment(r.Context(), commentID)
+	existingComment, err := h.commentService.GetComment(r.Context(), commentID, viewerFromRequest(r))
+	if errors.Is(err, models.ErrCommentNotFound) {
+		http.Error(w, "Comment not found", http.StatusNotFound)
+		return
+	}
 	if err != nil {
 		http.Error(w, "Failed to get comment: "+err.Error(), http.StatusInternalServerError)
 		return
@@ -0,0 +1,197 @@
+package handler
+
+import (
+	"1337b04rd/internal/domain/models"
+	"1337b04rd/internal/domain/ports"
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strconv"
+)
+
+// flaggedLimit is the default page size of the moderation queue
+const flaggedLimit = 50
+
+type FilterHandler struct {
+	filterService ports.FilterService
+}
+
+func NewFilterHandler(filterService ports.FilterService) *FilterHandler {
+	return &FilterHandler{
+		filterService: filterService,
+	}
+}
+
+// filterRuleBody is the JSON body of filter rule requests. A rule is
+// enabled unless "enabled" says otherwise.
+type filterRuleBody struct {
+	Board       string `json:"board"`
+	Pattern     string `json:"pattern"`
+	Regex       bool   `json:"regex"`
+	Action      string `json:"action"`
+	Replacement string `json:"replacement"`
+	Message     string `json:"message"`
+	Enabled     *bool  `json:"enabled"`
+}
+
+func (b *filterRuleBody) rule() *models.FilterRule {
+	rule := &models.FilterRule{
+		Board:       b.Board,
+		Pattern:     b.Pattern,
+		IsRegex:     b.Regex,
+		Action:      b.Action,
+		Replacement: b.Replacement,
+		Message:     b.Message,
+		Enabled:     true,
+	}
+	if b.Enabled != nil {
+		rule.Enabled = *b.Enabled
+	}
+	return rule
+}
+
+// writeFilterRuleError maps the errors of saving a rule to a response
+func writeFilterRuleError(w http.ResponseWriter, err error, action string) {
+	switch {
+	case errors.Is(err, models.ErrFilterRuleNotFound):
+		http.Error(w, "Filter rule not found", http.StatusNotFound)
+	case errors.Is(err, models.ErrBoardNotFound):
+		http.Error(w, "Board not found", http.StatusBadRequest)
+	case errors.Is(err, models.ErrInvalidFilterRule):
+		http.Error(w, err.Error(), http.StatusBadRequest)
+	default:
+		http.Error(w, "Failed to "+action+" filter rule: "+err.Error(), http.StatusInternalServerError)
+	}
+}
+
+func (h *FilterHandler) GetFilterRules(w http.ResponseWriter, r *http.Request) {
+	rules, err := h.filterService.GetFilterRules(r.Context())
+	if err != nil {
+		http.Error(w, "Failed to get filter rules: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(rules)
+}
+
+// CreateFilterRule adds a rule from a JSON body of the form {"pattern":
+// "spam", "action": "reject", "message": "No spam"}. "regex" makes the
+// pattern a regular expression and "board" limits the rule to one board.
+func (h *FilterHandler) CreateFilterRule(w http.ResponseWriter, r *http.Request) {
+	var body filterRuleBody
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	rule := body.rule()
+	if err := h.filterService.CreateFilterRule(r.Context(), rule); err != nil {
+		writeFilterRuleError(w, err, "create")
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(rule)
+}
+
+// UpdateFilterRule replaces a rule's settings from the same body as
+// CreateFilterRule
+func (h *FilterHandler) UpdateFilterRule(w http.ResponseWriter, r *http.Request) {
+	id, ok := idFromPath(w, r, "filter rule")
+	if !ok {
+		return
+	}
+
+	var body filterRuleBody
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	rule := body.rule()
+	rule.ID = id
+	if err := h.filterService.UpdateFilterRule(r.Context(), rule); err != nil {
+		writeFilterRuleError(w, err, "update")
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+}
+
+func (h *FilterHandler) DeleteFilterRule(w http.ResponseWriter, r *http.Request) {
+	id, ok := idFromPath(w, r, "filter rule")
+	if !ok {
+		return
+	}
+
+	if err := h.filterService.DeleteFilterRule(r.Context(), id); err != nil {
+		writeFilterRuleError(w, err, "delete")
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// ReloadFilterRules picks up rules changed directly in the database
+func (h *FilterHandler) ReloadFilterRules(w http.ResponseWriter, r *http.Request) {
+	if err := h.filterService.ReloadRules(r.Context()); err != nil {
+		http.Error(w, "Failed to reload filter rules: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+}
+
+// GetFlagged lists the posts and comments flagged by the filter rules,
+// oldest first
+func (h *FilterHandler) GetFlagged(w http.ResponseWriter, r *http.Request) {
+	limit := flaggedLimit
+	offset := 0
+	if l, err := strconv.Atoi(r.URL.Query().Get("limit")); err == nil && l > 0 {
+		limit = l
+	}
+	if o, err := strconv.Atoi(r.URL.Query().Get("offset")); err == nil && o >= 0 {
+		offset = o
+	}
+
+	flagged, err := h.filterService.GetFlagged(r.Context(), limit, offset)
+	if err != nil {
+		http.Error(w, "Failed to get flagged content: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	convertPostsURLs(flagged.Posts)
+	convertCommentsURLs(flagged.Comments)
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(flagged)
+}
+
+func (h *FilterHandler) UnflagPost(w http.ResponseWriter, r *http.Request) {
+	h.unflag(w, r, "post", "Post not found", h.filterService.UnflagPost)
+}
+
+func (h *FilterHandler) UnflagComment(w http.ResponseWriter, r *http.Request) {
+	h.unflag(w, r, "comment", "Comment not found", h.filterService.UnflagComment)
+}
+
+func (h *FilterHandler) unflag(w http.ResponseWriter, r *http.Request, what, notFound string, unflag func(ctx context.Context, id int) error) {
+	id, ok := idFromPath(w, r, what)
+	if !ok {
+		return
+	}
+
+	err := unflag(r.Context(), id)
+	if errors.Is(err, models.ErrPostNotFound) || errors.Is(err, models.ErrCommentNotFound) {
+		http.Error(w, notFound, http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		http.Error(w, "Failed to unflag "+what+": "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+}
@@ -0,0 +1,192 @@
+package handler
+
+import (
+	"1337b04rd/internal/adapters/storage"
+	"1337b04rd/internal/domain/models"
+	"1337b04rd/internal/domain/ports"
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strconv"
+
+	"github.com/gorilla/mux"
+)
+
+// heldAttachmentsLimit is the default page size of the review queue
+const heldAttachmentsLimit = 50
+
+type ImageBanHandler struct {
+	imageBanService ports.ImageBanService
+}
+
+func NewImageBanHandler(imageBanService ports.ImageBanService) *ImageBanHandler {
+	return &ImageBanHandler{
+		imageBanService: imageBanService,
+	}
+}
+
+// idFromPath parses the {id} path variable, writing a 400 naming what the
+// ID is for on failure
+func idFromPath(w http.ResponseWriter, r *http.Request, what string) (int, bool) {
+	id, err := strconv.Atoi(mux.Vars(r)["id"])
+	if err != nil {
+		http.Error(w, "Invalid "+what+" ID", http.StatusBadRequest)
+		return 0, false
+	}
+	return id, true
+}
+
+func (h *ImageBanHandler) GetImageBans(w http.ResponseWriter, r *http.Request) {
+	bans, err := h.imageBanService.GetImageBans(r.Context())
+	if err != nil {
+		http.Error(w, "Failed to get image bans: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(bans)
+}
+
+// CreateImageBan bans an image from a JSON body of the form {"hash":
+// "<16 hex digits>"} or {"attachment_id": 42}, with an optional Hamming
+// distance "threshold" and "reason"
+func (h *ImageBanHandler) CreateImageBan(w http.ResponseWriter, r *http.Request) {
+	var body struct {
+		Hash         string `json:"hash"`
+		AttachmentID int    `json:"attachment_id"`
+		Threshold    *int   `json:"threshold"`
+		Reason       string `json:"reason"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	threshold := models.DefaultImageBanThreshold
+	if body.Threshold != nil {
+		threshold = *body.Threshold
+	}
+
+	ban, err := h.imageBanService.CreateImageBan(r.Context(), body.Hash, body.AttachmentID, threshold, body.Reason)
+	if errors.Is(err, models.ErrAttachmentNotFound) {
+		http.Error(w, "Attachment not found", http.StatusNotFound)
+		return
+	}
+	if errors.Is(err, models.ErrInvalidImageBan) {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if err != nil {
+		http.Error(w, "Failed to create image ban: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(ban)
+}
+
+func (h *ImageBanHandler) DeleteImageBan(w http.ResponseWriter, r *http.Request) {
+	id, ok := idFromPath(w, r, "image ban")
+	if !ok {
+		return
+	}
+
+	err := h.imageBanService.DeleteImageBan(r.Context(), id)
+	if errors.Is(err, models.ErrImageBanNotFound) {
+		http.Error(w, "Image ban not found", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		http.Error(w, "Failed to delete image ban: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// GetHeldAttachments lists the attachments held for review, oldest first
+func (h *ImageBanHandler) GetHeldAttachments(w http.ResponseWriter, r *http.Request) {
+	limit := heldAttachmentsLimit
+	offset := 0
+	if l, err := strconv.Atoi(r.URL.Query().Get("limit")); err == nil && l > 0 {
+		limit = l
+	}
+	if o, err := strconv.Atoi(r.URL.Query().Get("offset")); err == nil && o >= 0 {
+		offset = o
+	}
+
+	attachments, err := h.imageBanService.GetHeldAttachments(r.Context(), limit, offset)
+	if err != nil {
+		http.Error(w, "Failed to get held attachments: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if attachments == nil {
+		attachments = []*models.Attachment{}
+	}
+
+	// Held files are only reachable through the admin API
+	for _, attachment := range attachments {
+		attachment.URL = storage.ConvertMinioURLToAdminURL(attachment.URL)
+		attachment.ThumbnailURL = storage.ConvertMinioURLToAdminURL(attachment.ThumbnailURL)
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(attachments)
+}
+
+func (h *ImageBanHandler) ApproveAttachment(w http.ResponseWriter, r *http.Request) {
+	h.reviewAttachment(w, r, h.imageBanService.ApproveAttachment)
+}
+
+func (h *ImageBanHandler) RejectAttachment(w http.ResponseWriter, r *http.Request) {
+	h.reviewAttachment(w, r, h.imageBanService.RejectAttachment)
+}
+
+func (h *ImageBanHandler) reviewAttachment(w http.ResponseWriter, r *http.Request, review func(ctx context.Context, id int) error) {
+	id, ok := idFromPath(w, r, "attachment")
+	if !ok {
+		return
+	}
+
+	err := review(r.Context(), id)
+	if errors.Is(err, models.ErrAttachmentNotFound) {
+		http.Error(w, "Attachment not found", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		http.Error(w, "Failed to review attachment: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+}
+
+// SetBoardImageBanAction sets what a board does with uploads matching a
+// banned image from a JSON body of the form {"action": "reject"} or
+// {"action": "review"}
+func (h *ImageBanHandler) SetBoardImageBanAction(w http.ResponseWriter, r *http.Request) {
+	var body struct {
+		Action string `json:"action"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	err := h.imageBanService.SetBoardImageBanAction(r.Context(), mux.Vars(r)["slug"], body.Action)
+	if errors.Is(err, models.ErrBoardNotFound) {
+		http.Error(w, "Board not found", http.StatusNotFound)
+		return
+	}
+	if errors.Is(err, models.ErrInvalidImageBan) {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if err != nil {
+		http.Error(w, "Failed to update image ban action: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+}
@@ -0,0 +1,106 @@
+package handler
+
+import (
+	"1337b04rd/internal/adapters/middleware"
+	"1337b04rd/internal/domain/models"
+	"1337b04rd/internal/domain/ports"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strconv"
+)
+
+type PollHandler struct {
+	pollService ports.PollService
+}
+
+func NewPollHandler(pollService ports.PollService) *PollHandler {
+	return &PollHandler{
+		pollService: pollService,
+	}
+}
+
+// GetPoll returns a thread's poll. Vote counts are hidden until the session
+// has voted or the poll has closed.
+func (h *PollHandler) GetPoll(w http.ResponseWriter, r *http.Request) {
+	postID, ok := postIDFromPath(w, r)
+	if !ok {
+		return
+	}
+
+	sessionID := ""
+	if session := middleware.GetSessionFromContext(r.Context()); session != nil {
+		sessionID = session.ID
+	}
+
+	poll, err := h.pollService.GetPoll(r.Context(), postID, sessionID)
+	if errors.Is(err, models.ErrPollNotFound) {
+		http.Error(w, "Poll not found", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		http.Error(w, "Failed to get poll: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(poll)
+}
+
+// Vote casts the session's ballot from one or more "option" form values
+func (h *PollHandler) Vote(w http.ResponseWriter, r *http.Request) {
+	// Get session from context
+	session := middleware.GetSessionFromContext(r.Context())
+	if session == nil {
+		http.Error(w, "Authentication required", http.StatusUnauthorized)
+		return
+	}
+
+	postID, ok := postIDFromPath(w, r)
+	if !ok {
+		return
+	}
+
+	if err := r.ParseForm(); err != nil {
+		http.Error(w, "Failed to parse form", http.StatusBadRequest)
+		return
+	}
+
+	var optionIDs []int
+	for _, value := range r.Form["option"] {
+		id, err := strconv.Atoi(value)
+		if err != nil {
+			http.Error(w, "Invalid option", http.StatusBadRequest)
+			return
+		}
+		optionIDs = append(optionIDs, id)
+	}
+
+	poll, err := h.pollService.Vote(r.Context(), postID, session.ID, optionIDs)
+	switch {
+	case errors.Is(err, models.ErrPostNotFound):
+		http.Error(w, "Post not found", http.StatusNotFound)
+		return
+	case errors.Is(err, models.ErrPollNotFound):
+		http.Error(w, "Poll not found", http.StatusNotFound)
+		return
+	case errors.Is(err, models.ErrThreadArchived):
+		http.Error(w, "Thread is archived", http.StatusForbidden)
+		return
+	case errors.Is(err, models.ErrPollClosed):
+		http.Error(w, "Poll is closed", http.StatusForbidden)
+		return
+	case errors.Is(err, models.ErrAlreadyVoted):
+		http.Error(w, "Already voted", http.StatusConflict)
+		return
+	case errors.Is(err, models.ErrInvalidVote):
+		http.Error(w, "Invalid vote", http.StatusBadRequest)
+		return
+	case err != nil:
+		http.Error(w, "Failed to vote: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(poll)
+}
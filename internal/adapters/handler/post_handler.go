@@ -5,25 +5,86 @@ import (
 	"1337b04rd/internal/adapters/storage"
 	"1337b04rd/internal/domain/models"
 	"1337b04rd/internal/domain/ports"
+	"1337b04rd/pkg/iphash"
+	"1337b04rd/pkg/tripcode"
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
 	"encoding/json"
+	"errors"
+	"fmt"
 	"log"
-	"mime/multipart"
 	"net/http"
 	"strconv"
+	"strings"
+	"time"
 
 	"github.com/gorilla/mux"
 )
 
 type PostHandler struct {
-	postService ports.PostService
+	postService     ports.PostService
+	reactionService ports.ReactionService
+	pollService     ports.PollService
+	tripcodes       *tripcode.Generator
+	ips             *iphash.Hasher
 }
 
-func NewPostHandler(postService ports.PostService) *PostHandler {
+func NewPostHandler(postService ports.PostService, reactionService ports.ReactionService, pollService ports.PollService, tripcodes *tripcode.Generator, ips *iphash.Hasher) *PostHandler {
 	return &PostHandler{
-		postService: postService,
+		postService:     postService,
+		reactionService: reactionService,
+		pollService:     pollService,
+		tripcodes:       tripcodes,
+		ips:             ips,
 	}
 }
 
+// loadSessionState attaches polls and marks the reactions and votes of the
+// requesting session, if any
+func (h *PostHandler) loadSessionState(r *http.Request, posts []*models.Post) {
+	sessionID := ""
+	if session := middleware.GetSessionFromContext(r.Context()); session != nil {
+		sessionID = session.ID
+		if err := h.reactionService.LoadSessionReactions(r.Context(), sessionID, posts); err != nil {
+			log.Printf("Failed to load session reactions: %v", err)
+		}
+	}
+	if err := h.pollService.LoadPolls(r.Context(), sessionID, posts); err != nil {
+		log.Printf("Failed to load polls: %v", err)
+	}
+}
+
+// parsePollForm reads the optional poll fields of a new thread: the
+// question, repeated poll_options values, poll_multiple and an RFC 3339
+// poll_closes_at time
+func parsePollForm(r *http.Request) (*models.Poll, error) {
+	question := r.FormValue("poll_question")
+	options := r.Form["poll_options"]
+	if question == "" && len(options) == 0 {
+		return nil, nil
+	}
+
+	multiple, _ := strconv.ParseBool(r.FormValue("poll_multiple"))
+	poll := &models.Poll{
+		Question:       question,
+		MultipleChoice: multiple || r.FormValue("poll_multiple") == "on",
+	}
+	for _, text := range options {
+		poll.Options = append(poll.Options, &models.PollOption{Text: text})
+	}
+
+	if closesAt := r.FormValue("poll_closes_at"); closesAt != "" {
+		t, err := time.Parse(time.RFC3339, closesAt)
+		if err != nil {
+			return nil, fmt.Errorf("%w: poll_closes_at must be an RFC 3339 time", models.ErrInvalidPoll)
+		}
+		poll.ClosesAt = &t
+	}
+
+	return poll, nil
+}
+
 // convertPostURLs converts MinIO URLs to backend proxy URLs in a post
 func convertPostURLs(post *models.Post) {
 	if post.ImageURL != "" {
@@ -32,6 +93,7 @@ func convertPostURLs(post *models.Post) {
 	if post.AuthorImage != "" {
 		post.AuthorImage = storage.ConvertMinioURLToProxyURL(post.AuthorImage)
 	}
+	convertAttachmentURLs(post.Attachments)
 }
 
 // convertPostsURLs converts MinIO URLs to backend proxy URLs in a slice of posts
@@ -41,6 +103,16 @@ func convertPostsURLs(posts []*models.Post) {
 	}
 }
 
+// convertRevisionsURLs converts MinIO URLs to backend proxy URLs in a
+// slice of revisions
+func convertRevisionsURLs(revisions []*models.Revision) {
+	for _, revision := range revisions {
+		if revision.ImageURL != "" {
+			revision.ImageURL = storage.ConvertMinioURLToProxyURL(revision.ImageURL)
+		}
+	}
+}
+
 func (h *PostHandler) CreatePost(w http.ResponseWriter, r *http.Request) {
 	log.Printf("CreatePost called, checking session...")
 	// Get session from context
@@ -68,27 +140,61 @@ func (h *PostHandler) CreatePost(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	// Board defaults to the main board when not given
+	board := r.FormValue("board")
+	if board == "" {
+		board = models.DefaultBoard
+	}
+
 	// Create post model with session data
 	post := &models.Post{
+		Board:       board,
 		Title:       title,
 		Content:     content,
 		AuthorID:    session.ID,
 		AuthorName:  session.Name,
 		AuthorImage: session.Image,
+		IPHash:      h.ips.Request(r),
 		IsArchive:   false,
 	}
 
-	// Get image file if provided
-	var imageFile multipart.File
-	var imageHeader *multipart.FileHeader
-	if file, header, err := r.FormFile("image"); err == nil {
-		imageFile = file
-		imageHeader = header
-		defer imageFile.Close()
+	// Optional name field in "name#password" or "name##password" form.
+	// Only the derived tripcode is kept, never the password itself.
+	if name, trip := h.tripcodes.Parse(r.FormValue("name")); name != "" || trip != "" {
+		if name != "" {
+			post.AuthorName = name
+		}
+		post.Tripcode = trip
+	}
+
+	// Optional poll attached to the thread
+	post.Poll, err = parsePollForm(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	// Get attached files if provided
+	uploads, err := parseAttachmentForm(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
 	}
 
 	// Create post
-	err = h.postService.CreatePost(r.Context(), post, imageFile, imageHeader)
+	err = h.postService.CreatePost(r.Context(), post, uploads)
+	if errors.Is(err, models.ErrBoardNotFound) {
+		http.Error(w, "Board not found", http.StatusBadRequest)
+		return
+	}
+	if errors.Is(err, models.ErrInvalidPoll) {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if errors.Is(err, models.ErrTooManyAttachments) || errors.Is(err, models.ErrInvalidAttachment) || errors.Is(err, models.ErrUploadNotFound) || errors.Is(err, models.ErrBannedImage) || errors.Is(err, models.ErrContentRejected) {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
 	if err != nil {
 		http.Error(w, "Failed to create post: "+err.Error(), http.StatusInternalServerError)
 		return
@@ -117,7 +223,11 @@ func (h *PostHandler) GetPost(w http.ResponseWriter, r *http.Request) {
 	}
 
 	// Get post
-	post, err := h.postService.GetPost(r.Context(), postID)
+	post, err := h.postService.GetPost(r.Context(), postID, viewerFromRequest(r))
+	if errors.Is(err, models.ErrPostNotFound) {
+		http.Error(w, "Post not found", http.StatusNotFound)
+		return
+	}
 	if err != nil {
 		http.Error(w, "Failed to get post: "+err.Error(), http.StatusInternalServerError)
 		return
@@ -129,7 +239,9 @@ func (h *PostHandler) GetPost(w http.ResponseWriter, r *http.Request) {
 	}
 
 	// Convert URLs and return post
+	h.loadSessionState(r, []*models.Post{post})
 	convertPostURLs(post)
+	w.Header().Set("ETag", versionETag(post.Version))
 	w.Header().Set("Content-Type", "application/json")
 	json.NewEncoder(w).Encode(post)
 }
@@ -139,6 +251,11 @@ func (h *PostHandler) GetPosts(w http.ResponseWriter, r *http.Request) {
 	limitStr := r.URL.Query().Get("limit")
 	offsetStr := r.URL.Query().Get("offset")
 	includeArchivedStr := r.URL.Query().Get("include_archived")
+	sort, err := models.ParsePostSort(r.URL.Query().Get("sort"))
+	if err != nil {
+		http.Error(w, "Invalid sort: must be bump, created or replies", http.StatusBadRequest)
+		return
+	}
 
 	limit := 10 // default limit
 	offset := 0 // default offset
@@ -161,13 +278,14 @@ func (h *PostHandler) GetPosts(w http.ResponseWriter, r *http.Request) {
 	}
 
 	// Get posts
-	posts, err := h.postService.GetPosts(r.Context(), limit, offset, includeArchived)
+	posts, err := h.postService.GetPosts(r.Context(), viewerFromRequest(r), limit, offset, includeArchived, sort)
 	if err != nil {
 		http.Error(w, "Failed to get posts: "+err.Error(), http.StatusInternalServerError)
 		return
 	}
 
 	// Convert URLs and return posts
+	h.loadSessionState(r, posts)
 	convertPostsURLs(posts)
 	w.Header().Set("Content-Type", "application/json")
 	json.NewEncoder(w).Encode(posts)
@@ -200,13 +318,14 @@ func (h *PostHandler) GetPostsByAuthor(w http.ResponseWriter, r *http.Request) {
 	}
 
 	// Get posts by author
-	posts, err := h.postService.GetPostsByAuthor(r.Context(), authorID, limit, offset)
+	posts, err := h.postService.GetPostsByAuthor(r.Context(), authorID, viewerFromRequest(r), limit, offset)
 	if err != nil {
 		http.Error(w, "Failed to get posts: "+err.Error(), http.StatusInternalServerError)
 		return
 	}
 
 	// Convert URLs and return posts
+	h.loadSessionState(r, posts)
 	convertPostsURLs(posts)
 	w.Header().Set("Content-Type", "application/json")
 	json.NewEncoder(w).Encode(posts)
@@ -241,21 +360,8 @@ func (h *PostHandler) UpdatePost(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	// Get the existing post to verify ownership
-	existingPost, err := h.postService.GetPost(r.Context(), postID)
-	if err != nil {
-		http.Error(w, "Failed to get post: "+err.Error(), http.StatusInternalServerError)
-		return
-	}
-
-	if existingPost == nil {
-		http.Error(w, "Post not found", http.StatusNotFound)
-		return
-	}
-
-	// Check if the user owns this post
-	if existingPost.AuthorID != session.ID {
-		http.Error(w, "Unauthorized: You can only update your own posts", http.StatusForbidden)
+	version, ok := expectedVersion(w, r)
+	if !ok {
 		return
 	}
 
@@ -275,19 +381,42 @@ func (h *PostHandler) UpdatePost(w http.ResponseWriter, r *http.Request) {
 		Content:    content,
 		AuthorID:   session.ID,
 		AuthorName: session.Name,
+		Version:    version,
 	}
 
-	// Get image file if provided
-	var imageFile multipart.File
-	var imageHeader *multipart.FileHeader
-	if file, header, err := r.FormFile("image"); err == nil {
-		imageFile = file
-		imageHeader = header
-		defer imageFile.Close()
+	// Get attached files if provided
+	uploads, err := parseAttachmentForm(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
 	}
 
 	// Update post
-	err = h.postService.UpdatePost(r.Context(), post, imageFile, imageHeader)
+	err = h.postService.UpdatePost(r.Context(), post, uploads)
+	if errors.Is(err, models.ErrPostNotFound) {
+		http.Error(w, "Post not found", http.StatusNotFound)
+		return
+	}
+	if errors.Is(err, models.ErrNotAuthor) {
+		http.Error(w, "Unauthorized: You can only update your own posts", http.StatusForbidden)
+		return
+	}
+	if errors.Is(err, models.ErrVersionConflict) {
+		http.Error(w, "Post was edited since this version", http.StatusPreconditionFailed)
+		return
+	}
+	if errors.Is(err, models.ErrThreadArchived) {
+		http.Error(w, "Thread is archived and read-only", http.StatusForbidden)
+		return
+	}
+	if errors.Is(err, models.ErrEditWindowClosed) {
+		http.Error(w, "The edit window for this post has closed", http.StatusForbidden)
+		return
+	}
+	if errors.Is(err, models.ErrTooManyAttachments) || errors.Is(err, models.ErrInvalidAttachment) || errors.Is(err, models.ErrUploadNotFound) || errors.Is(err, models.ErrBannedImage) || errors.Is(err, models.ErrContentRejected) {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
 	if err != nil {
 		http.Error(w, "Failed to update post: "+err.Error(), http.StatusInternalServerError)
 		return
@@ -295,10 +424,34 @@ func (h *PostHandler) UpdatePost(w http.ResponseWriter, r *http.Request) {
 
 	// Convert URLs and return updated post
 	convertPostURLs(post)
+	w.Header().Set("ETag", versionETag(post.Version))
 	w.Header().Set("Content-Type", "application/json")
 	json.NewEncoder(w).Encode(post)
 }
 
+// GetPostRevisions returns a thread's edit history, oldest first
+func (h *PostHandler) GetPostRevisions(w http.ResponseWriter, r *http.Request) {
+	postID, err := strconv.Atoi(mux.Vars(r)["id"])
+	if err != nil {
+		http.Error(w, "Invalid post ID", http.StatusBadRequest)
+		return
+	}
+
+	revisions, err := h.postService.GetPostRevisions(r.Context(), postID, viewerFromRequest(r))
+	if errors.Is(err, models.ErrPostNotFound) {
+		http.Error(w, "Post not found", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		http.Error(w, "Failed to get revisions: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	convertRevisionsURLs(revisions)
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(revisions)
+}
+
 func (h *PostHandler) DeletePost(w http.ResponseWriter, r *http.Request) {
 	// Get session from context
 	session := middleware.GetSessionFromContext(r.Context())
@@ -322,7 +475,11 @@ func (h *PostHandler) DeletePost(w http.ResponseWriter, r *http.Request) {
 	}
 
 	// Get the existing post to verify ownership
-	existingPost, err := h.postService.GetPost(r.Context(), postID)
+	existingPost, err := h.postService.GetPost(r.Context(), postID, viewerFromRequest(r))
+	if errors.Is(err, models.ErrPostNotFound) {
+		http.Error(w, "Post not found", http.StatusNotFound)
+		return
+	}
 	if err != nil {
 		http.Error(w, "Failed to get post: "+err.Error(), http.StatusInternalServerError)
 		return
@@ -372,7 +529,11 @@ func (h *PostHandler) ArchivePost(w http.ResponseWriter, r *http.Request) {
 	}
 
 	// Get the existing post to verify ownership
-	existingPost, err := h.postService.GetPost(r.Context(), postID)
+	existingPost, err := h.postService.GetPost(r.Context(), postID, viewerFromRequest(r))
+	if errors.Is(err, models.ErrPostNotFound) {
+		http.Error(w, "Post not found", http.StatusNotFound)
+		return
+	}
 	if err != nil {
 		http.Error(w, "Failed to get post: "+err.Error(), http.StatusInternalServerError)
 		return
@@ -422,7 +583,11 @@ func (h *PostHandler) UnarchivePost(w http.ResponseWriter, r *http.Request) {
 	}
 
 	// Get the existing post to verify ownership
-	existingPost, err := h.postService.GetPost(r.Context(), postID)
+	existingPost, err := h.postService.GetPost(r.Context(), postID, viewerFromRequest(r))
+	if errors.Is(err, models.ErrPostNotFound) {
+		http.Error(w, "Post not found", http.StatusNotFound)
+		return
+	}
 	if err != nil {
 		http.Error(w, "Failed to get post: "+err.Error(), http.StatusInternalServerError)
 		return
@@ -448,3 +613,134 @@ func (h *PostHandler) UnarchivePost(w http.ResponseWriter, r *http.Request) {
 
 	w.WriteHeader(http.StatusOK)
 }
+
+// GetCatalog returns a compact list of a board's live threads. The response
+// carries an ETag so clients polling the catalog get a 304 when unchanged.
+func (h *PostHandler) GetCatalog(w http.ResponseWriter, r *http.Request) {
+	board := mux.Vars(r)["slug"]
+	if board == "" {
+		board = models.DefaultBoard
+	}
+
+	entries, err := h.postService.GetCatalog(r.Context(), board)
+	if errors.Is(err, models.ErrBoardNotFound) {
+		http.Error(w, "Board not found", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		http.Error(w, "Failed to get catalog: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	for _, entry := range entries {
+		if entry.Thumbnail != "" {
+			entry.Thumbnail = storage.ConvertMinioURLToProxyURL(entry.Thumbnail)
+		}
+	}
+
+	var body bytes.Buffer
+	if err := json.NewEncoder(&body).Encode(entries); err != nil {
+		http.Error(w, "Failed to encode catalog: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	sum := sha256.Sum256(body.Bytes())
+	etag := `"` + hex.EncodeToString(sum[:16]) + `"`
+
+	w.Header().Set("ETag", etag)
+	w.Header().Set("Cache-Control", "no-cache")
+	if match := r.Header.Get("If-None-Match"); match != "" && etagMatches(match, etag) {
+		w.WriteHeader(http.StatusNotModified)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Write(body.Bytes())
+}
+
+// etagMatches reports whether an If-None-Match header matches etag
+func etagMatches(header, etag string) bool {
+	for _, candidate := range strings.Split(header, ",") {
+		candidate = strings.TrimPrefix(strings.TrimSpace(candidate), "W/")
+		if candidate == "*" || candidate == etag {
+			return true
+		}
+	}
+	return false
+}
+
+// GetArchive lists the day or month buckets of a board's archived threads
+func (h *PostHandler) GetArchive(w http.ResponseWriter, r *http.Request) {
+	board := r.URL.Query().Get("board")
+	if board == "" {
+		board = models.DefaultBoard
+	}
+
+	size, err := models.ParseArchiveBucketSize(r.URL.Query().Get("bucket"))
+	if err != nil {
+		http.Error(w, "Invalid bucket: must be day or month", http.StatusBadRequest)
+		return
+	}
+
+	buckets, err := h.postService.GetArchiveBuckets(r.Context(), board, size, r.URL.Query().Get("q"))
+	if errors.Is(err, models.ErrBoardNotFound) {
+		http.Error(w, "Board not found", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		http.Error(w, "Failed to get archive: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(buckets)
+}
+
+// GetArchivedPosts lists archived threads, optionally limited to one period
+// ("2006-01" or "2006-01-02") and a search term
+func (h *PostHandler) GetArchivedPosts(w http.ResponseWriter, r *http.Request) {
+	board := r.URL.Query().Get("board")
+	if board == "" {
+		board = models.DefaultBoard
+	}
+
+	from, to, err := models.ParseArchivePeriod(r.URL.Query().Get("period"))
+	if err != nil {
+		http.Error(w, "Invalid period: use YYYY-MM or YYYY-MM-DD", http.StatusBadRequest)
+		return
+	}
+
+	limitStr := r.URL.Query().Get("limit")
+	offsetStr := r.URL.Query().Get("offset")
+
+	limit := 10 // default limit
+	offset := 0 // default offset
+
+	if limitStr != "" {
+		if l, err := strconv.Atoi(limitStr); err == nil && l > 0 {
+			limit = l
+		}
+	}
+
+	if offsetStr != "" {
+		if o, err := strconv.Atoi(offsetStr); err == nil && o >= 0 {
+			offset = o
+		}
+	}
+
+	posts, err := h.postService.GetArchivedPosts(r.Context(), board, from, to, r.URL.Query().Get("q"), limit, offset)
+	if errors.Is(err, models.ErrBoardNotFound) {
+		http.Error(w, "Board not found", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		http.Error(w, "Failed to get archived posts: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	// Convert URLs and return posts
+	h.loadSessionState(r, posts)
+	convertPostsURLs(posts)
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(posts)
+}
@@ -0,0 +1,160 @@
+package handler
+
+import (
+	"1337b04rd/internal/domain/models"
+	"1337b04rd/internal/domain/ports"
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strconv"
+)
+
+// pendingLimit is the default page size of the approval queue
+const pendingLimit = 50
+
+type QuarantineHandler struct {
+	quarantineService ports.QuarantineService
+	postService       ports.PostService
+	commentService    ports.CommentService
+}
+
+func NewQuarantineHandler(quarantineService ports.QuarantineService, postService ports.PostService, commentService ports.CommentService) *QuarantineHandler {
+	return &QuarantineHandler{
+		quarantineService: quarantineService,
+		postService:       postService,
+		commentService:    commentService,
+	}
+}
+
+func (h *QuarantineHandler) GetQuarantines(w http.ResponseWriter, r *http.Request) {
+	quarantines, err := h.quarantineService.GetQuarantines(r.Context())
+	if err != nil {
+		http.Error(w, "Failed to get quarantines: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(quarantines)
+}
+
+// CreateQuarantine quarantines a session from a JSON body of the form
+// {"session_id": "..."}, or the author of a post or comment with
+// {"post_id": 42} or {"comment_id": 42}. Adding "ip": true quarantines the
+// address the post or comment was written from instead. "reason" is
+// optional.
+func (h *QuarantineHandler) CreateQuarantine(w http.ResponseWriter, r *http.Request) {
+	var body struct {
+		SessionID string `json:"session_id"`
+		PostID    int    `json:"post_id"`
+		CommentID int    `json:"comment_id"`
+		IP        bool   `json:"ip"`
+		Reason    string `json:"reason"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	quarantine, err := h.quarantineService.CreateQuarantine(r.Context(), body.SessionID, body.PostID, body.CommentID, body.IP, body.Reason)
+	if errors.Is(err, models.ErrPostNotFound) {
+		http.Error(w, "Post not found", http.StatusNotFound)
+		return
+	}
+	if errors.Is(err, models.ErrCommentNotFound) {
+		http.Error(w, "Comment not found", http.StatusNotFound)
+		return
+	}
+	if errors.Is(err, models.ErrInvalidQuarantine) {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if err != nil {
+		http.Error(w, "Failed to create quarantine: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(quarantine)
+}
+
+func (h *QuarantineHandler) DeleteQuarantine(w http.ResponseWriter, r *http.Request) {
+	id, ok := idFromPath(w, r, "quarantine")
+	if !ok {
+		return
+	}
+
+	err := h.quarantineService.DeleteQuarantine(r.Context(), id)
+	if errors.Is(err, models.ErrQuarantineNotFound) {
+		http.Error(w, "Quarantine not found", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		http.Error(w, "Failed to delete quarantine: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// GetPending lists the posts and comments waiting for approval, oldest
+// first
+func (h *QuarantineHandler) GetPending(w http.ResponseWriter, r *http.Request) {
+	limit := pendingLimit
+	offset := 0
+	if l, err := strconv.Atoi(r.URL.Query().Get("limit")); err == nil && l > 0 {
+		limit = l
+	}
+	if o, err := strconv.Atoi(r.URL.Query().Get("offset")); err == nil && o >= 0 {
+		offset = o
+	}
+
+	pending, err := h.quarantineService.GetPending(r.Context(), limit, offset)
+	if err != nil {
+		http.Error(w, "Failed to get pending content: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	convertPostsURLs(pending.Posts)
+	convertCommentsURLs(pending.Comments)
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(pending)
+}
+
+func (h *QuarantineHandler) ApprovePost(w http.ResponseWriter, r *http.Request) {
+	h.review(w, r, "post", "Post not found", h.quarantineService.ApprovePost)
+}
+
+func (h *QuarantineHandler) ApproveComment(w http.ResponseWriter, r *http.Request) {
+	h.review(w, r, "comment", "Comment not found", h.quarantineService.ApproveComment)
+}
+
+// RejectPost deletes a pending thread together with its files
+func (h *QuarantineHandler) RejectPost(w http.ResponseWriter, r *http.Request) {
+	h.review(w, r, "post", "Post not found", h.postService.DeletePost)
+}
+
+// RejectComment deletes a pending comment together with its files
+func (h *QuarantineHandler) RejectComment(w http.ResponseWriter, r *http.Request) {
+	h.review(w, r, "comment", "Comment not found", h.commentService.DeleteComment)
+}
+
+func (h *QuarantineHandler) review(w http.ResponseWriter, r *http.Request, what, notFound string, review func(ctx context.Context, id int) error) {
+	id, ok := idFromPath(w, r, what)
+	if !ok {
+		return
+	}
+
+	err := review(r.Context(), id)
+	if errors.Is(err, models.ErrPostNotFound) || errors.Is(err, models.ErrCommentNotFound) {
+		http.Error(w, notFound, http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		http.Error(w, "Failed to review "+what+": "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+}
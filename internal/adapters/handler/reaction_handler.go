@@ -0,0 +1,140 @@
+package handler
+
+import (
+	"1337b04rd/internal/adapters/middleware"
+	"1337b04rd/internal/domain/models"
+	"1337b04rd/internal/domain/ports"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strconv"
+
+	"github.com/gorilla/mux"
+)
+
+type ReactionHandler struct {
+	reactionService ports.ReactionService
+}
+
+func NewReactionHandler(reactionService ports.ReactionService) *ReactionHandler {
+	return &ReactionHandler{
+		reactionService: reactionService,
+	}
+}
+
+func (h *ReactionHandler) AddPostReaction(w http.ResponseWriter, r *http.Request) {
+	h.react(w, r, false, true)
+}
+
+func (h *ReactionHandler) RemovePostReaction(w http.ResponseWriter, r *http.Request) {
+	h.react(w, r, false, false)
+}
+
+func (h *ReactionHandler) AddCommentReaction(w http.ResponseWriter, r *http.Request) {
+	h.react(w, r, true, true)
+}
+
+func (h *ReactionHandler) RemoveCommentReaction(w http.ResponseWriter, r *http.Request) {
+	h.react(w, r, true, false)
+}
+
+// react adds or removes the session's reaction given in the "emoji" form
+// field (or query parameter) and returns the item's updated counts
+func (h *ReactionHandler) react(w http.ResponseWriter, r *http.Request, onComment, add bool) {
+	// Get session from context
+	session := middleware.GetSessionFromContext(r.Context())
+	if session == nil {
+		http.Error(w, "Authentication required", http.StatusUnauthorized)
+		return
+	}
+
+	id, err := strconv.Atoi(mux.Vars(r)["id"])
+	if err != nil {
+		http.Error(w, "Invalid ID", http.StatusBadRequest)
+		return
+	}
+
+	emoji := r.FormValue("emoji")
+	if emoji == "" {
+		http.Error(w, "Emoji is required", http.StatusBadRequest)
+		return
+	}
+
+	reaction := &models.Reaction{SessionID: session.ID, Emoji: emoji}
+	if onComment {
+		reaction.CommentID = &id
+	} else {
+		reaction.PostID = id
+	}
+
+	var counts map[string]int
+	if add {
+		counts, err = h.reactionService.AddReaction(r.Context(), reaction)
+	} else {
+		counts, err = h.reactionService.RemoveReaction(r.Context(), reaction)
+	}
+	switch {
+	case errors.Is(err, models.ErrPostNotFound):
+		http.Error(w, "Post not found", http.StatusNotFound)
+		return
+	case errors.Is(err, models.ErrCommentNotFound):
+		http.Error(w, "Comment not found", http.StatusNotFound)
+		return
+	case errors.Is(err, models.ErrThreadArchived):
+		http.Error(w, "Thread is archived", http.StatusForbidden)
+		return
+	case errors.Is(err, models.ErrInvalidReaction):
+		http.Error(w, "Reaction is not allowed on this board", http.StatusBadRequest)
+		return
+	case err != nil:
+		http.Error(w, "Failed to update reaction: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{"reactions": counts})
+}
+
+// GetBoardReactions returns the reactions allowed on a board
+func (h *ReactionHandler) GetBoardReactions(w http.ResponseWriter, r *http.Request) {
+	reactions, err := h.reactionService.GetBoardReactions(r.Context(), mux.Vars(r)["slug"])
+	if errors.Is(err, models.ErrBoardNotFound) {
+		http.Error(w, "Board not found", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		http.Error(w, "Failed to get reactions: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string][]string{"reactions": reactions})
+}
+
+// SetBoardReactions replaces a board's reaction set from a JSON body of the
+// form {"reactions": ["👍", ...]}. An empty list restores the defaults.
+func (h *ReactionHandler) SetBoardReactions(w http.ResponseWriter, r *http.Request) {
+	var body struct {
+		Reactions []string `json:"reactions"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	err := h.reactionService.SetBoardReactions(r.Context(), mux.Vars(r)["slug"], body.Reactions)
+	if errors.Is(err, models.ErrBoardNotFound) {
+		http.Error(w, "Board not found", http.StatusNotFound)
+		return
+	}
+	if errors.Is(err, models.ErrInvalidReaction) {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if err != nil {
+		http.Error(w, "Failed to update reactions: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+}
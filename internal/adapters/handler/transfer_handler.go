@@ -0,0 +1,105 @@
+package handler
+
+import (
+	"1337b04rd/internal/domain/models"
+	"1337b04rd/internal/domain/ports"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+)
+
+// maxImportSize bounds the size of an uploaded thread archive
+const maxImportSize = 512 << 20
+
+type TransferHandler struct {
+	transferService ports.TransferService
+}
+
+func NewTransferHandler(transferService ports.TransferService) *TransferHandler {
+	return &TransferHandler{
+		transferService: transferService,
+	}
+}
+
+// ExportThread downloads a thread with its comments and images as a ZIP
+func (h *TransferHandler) ExportThread(w http.ResponseWriter, r *http.Request) {
+	postID, ok := postIDFromPath(w, r)
+	if !ok {
+		return
+	}
+
+	// The archive is streamed as it is built. Failures before its first
+	// byte, such as a missing thread, are still reported as errors.
+	archive := &archiveWriter{w: w, filename: fmt.Sprintf("thread-%d.zip", postID)}
+	err := h.transferService.ExportThread(r.Context(), postID, archive)
+	if err == nil {
+		return
+	}
+	if archive.started {
+		// Too late for an error status; cut the response short so the
+		// client does not take the truncated archive for a complete one
+		log.Printf("Failed to export thread %d: %v", postID, err)
+		panic(http.ErrAbortHandler)
+	}
+	if errors.Is(err, models.ErrPostNotFound) {
+		http.Error(w, "Post not found", http.StatusNotFound)
+		return
+	}
+	http.Error(w, "Failed to export thread: "+err.Error(), http.StatusInternalServerError)
+}
+
+// archiveWriter sends the headers of a ZIP download with the first byte
+// written to it
+type archiveWriter struct {
+	w        http.ResponseWriter
+	filename string
+	started  bool
+}
+
+func (a *archiveWriter) Write(p []byte) (int, error) {
+	if !a.started {
+		a.started = true
+		a.w.Header().Set("Content-Type", "application/zip")
+		a.w.Header().Set("Content-Disposition", fmt.Sprintf(`attachment; filename="%s"`, a.filename))
+		a.w.WriteHeader(http.StatusOK)
+	}
+	return a.w.Write(p)
+}
+
+// ImportThread restores an exported thread uploaded as the "archive" form
+// file, optionally onto the board given in the "board" form field
+func (h *TransferHandler) ImportThread(w http.ResponseWriter, r *http.Request) {
+	r.Body = http.MaxBytesReader(w, r.Body, maxImportSize)
+	if err := r.ParseMultipartForm(32 << 20); err != nil {
+		http.Error(w, "Failed to parse form: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	file, header, err := r.FormFile("archive")
+	if err != nil {
+		http.Error(w, "Archive file is required", http.StatusBadRequest)
+		return
+	}
+	defer file.Close()
+
+	post, err := h.transferService.ImportThread(r.Context(), file, header.Size, r.FormValue("board"))
+	if errors.Is(err, models.ErrInvalidExport) {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if errors.Is(err, models.ErrBoardNotFound) {
+		http.Error(w, "Board not found", http.StatusBadRequest)
+		return
+	}
+	if err != nil {
+		http.Error(w, "Failed to import thread: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	convertPostURLs(post)
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(post)
+}
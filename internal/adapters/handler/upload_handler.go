@@ -0,0 +1,65 @@
+package handler
+
+import (
+	"1337b04rd/internal/adapters/middleware"
+	"1337b04rd/internal/domain/models"
+	"1337b04rd/internal/domain/ports"
+	"encoding/json"
+	"errors"
+	"net/http"
+)
+
+type UploadHandler struct {
+	uploadService ports.UploadService
+}
+
+func NewUploadHandler(uploadService ports.UploadService) *UploadHandler {
+	return &UploadHandler{
+		uploadService: uploadService,
+	}
+}
+
+// CreateUpload starts a direct upload from a JSON body of the form
+// {"target": "post", "board": "b", "filename": "cat.png", "content_type":
+// "image/png", "size": 12345}. The board is the one the post or comment
+// goes to, whose file size limit the size must be within. The response
+// holds the upload ID to send with the post or comment as an "uploads" form
+// value, and the URL to PUT the file to.
+func (h *UploadHandler) CreateUpload(w http.ResponseWriter, r *http.Request) {
+	// Get session from context
+	session := middleware.GetSessionFromContext(r.Context())
+	if session == nil {
+		http.Error(w, "Authentication required", http.StatusUnauthorized)
+		return
+	}
+
+	var body struct {
+		Target      models.UploadTarget `json:"target"`
+		Board       string              `json:"board"`
+		Filename    string              `json:"filename"`
+		ContentType string              `json:"content_type"`
+		Size        int64               `json:"size"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	upload, err := h.uploadService.CreateUpload(r.Context(), session.ID, body.Target, body.Board, body.Filename, body.ContentType, body.Size)
+	if errors.Is(err, models.ErrBoardNotFound) {
+		http.Error(w, "Board not found", http.StatusBadRequest)
+		return
+	}
+	if errors.Is(err, models.ErrInvalidAttachment) {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if err != nil {
+		http.Error(w, "Failed to create upload: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(upload)
+}
@@ -0,0 +1,35 @@
+package handler
+
+import (
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+// versionETag is the ETag of a post or comment at version
+func versionETag(version int) string {
+	return `"` + strconv.Itoa(version) + `"`
+}
+
+// expectedVersion reads the version an edit was made from, taken from an
+// If-Match header holding the ETag of a post or comment or else from the
+// "version" form field. Weak ETags name their version as well. It writes
+// the error response and returns false when neither names a version; an
+// If-Match of "*" does not, since an edit must say which version it saw.
+func expectedVersion(w http.ResponseWriter, r *http.Request) (int, bool) {
+	value := r.FormValue("version")
+	if match := strings.TrimSpace(r.Header.Get("If-Match")); match != "" {
+		value = strings.Trim(strings.TrimPrefix(match, "W/"), `"`)
+	}
+	if value == "" || value == "*" {
+		http.Error(w, "An If-Match header or version field is required", http.StatusPreconditionRequired)
+		return 0, false
+	}
+
+	version, err := strconv.Atoi(value)
+	if err != nil || version < 1 {
+		http.Error(w, "Invalid version", http.StatusBadRequest)
+		return 0, false
+	}
+	return version, true
+}
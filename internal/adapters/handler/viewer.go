@@ -0,0 +1,16 @@
+package handler
+
+import (
+	"1337b04rd/internal/adapters/middleware"
+	"1337b04rd/internal/domain/models"
+	"net/http"
+)
+
+// viewerFromRequest returns who a request reads posts and comments for:
+// its session, or an anonymous reader without one
+func viewerFromRequest(r *http.Request) models.Viewer {
+	if session := middleware.GetSessionFromContext(r.Context()); session != nil {
+		return models.Viewer{SessionID: session.ID}
+	}
+	return models.Viewer{}
+}
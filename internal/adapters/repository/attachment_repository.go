@@ -0,0 +1,185 @@
+package repository
+
+import (
+	"1337b04rd/internal/domain/models"
+	"context"
+	"database/sql"
+
+	"github.com/lib/pq"
+)
+
+type AttachmentRepository struct {
+	db dbtx
+}
+
+func NewAttachmentRepository(db *sql.DB) *AttachmentRepository {
+	return &AttachmentRepository{db: db}
+}
+
+const attachmentColumns = `id, post_id, comment_id, position, url, thumbnail_url, filename,
+	content_type, size, width, height, duration, spoiler, alt_text, image_hash, held, created_at`
+
+// Replace swaps the attachments of a post (commentID nil) or comment for the
+// given ones in one transaction and returns the attachments it removed, so
+// their objects can be deleted once the change is committed
+func (r *AttachmentRepository) Replace(ctx context.Context, postID int, commentID *int, attachments []*models.Attachment) ([]*models.Attachment, error) {
+	tx, err := begin(ctx, r.db)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	rows, err := tx.QueryContext(ctx, `
+		DELETE FROM attachments
+		WHERE post_id = $1 AND COALESCE(comment_id, 0) = COALESCE($2, 0)
+		RETURNING `+attachmentColumns, postID, commentID)
+	if err != nil {
+		return nil, err
+	}
+	removed, err := scanAttachments(rows)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, attachment := range attachments {
+		attachment.PostID = postID
+		attachment.CommentID = commentID
+		err := tx.QueryRowContext(ctx, `
+			INSERT INTO attachments (post_id, comment_id, position, url, thumbnail_url, filename,
+				content_type, size, width, height, duration, spoiler, alt_text, image_hash, held, created_at)
+			VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13, $14, $15, $16)
+			RETURNING id`,
+			attachment.PostID, attachment.CommentID, attachment.Position, attachment.URL, attachment.ThumbnailURL,
+			attachment.Filename, attachment.ContentType, attachment.Size, attachment.Width, attachment.Height,
+			attachment.Duration, attachment.Spoiler, attachment.AltText, attachment.ImageHash, attachment.Held, attachment.CreatedAt,
+		).Scan(&attachment.ID)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, err
+	}
+	return removed, nil
+}
+
+// GetByPostIDs returns the attachments of the given threads, covering both
+// the opening posts and their comments
+func (r *AttachmentRepository) GetByPostIDs(ctx context.Context, postIDs []int) ([]*models.Attachment, error) {
+	rows, err := r.db.QueryContext(ctx, `
+		SELECT `+attachmentColumns+`
+		FROM attachments WHERE post_id = ANY($1)
+		ORDER BY post_id, comment_id NULLS FIRST, position`, pq.Array(postIDs))
+	if err != nil {
+		return nil, err
+	}
+
+	return scanAttachments(rows)
+}
+
+// GetByCommentIDs returns the attachments of the given comments
+func (r *AttachmentRepository) GetByCommentIDs(ctx context.Context, commentIDs []int) ([]*models.Attachment, error) {
+	rows, err := r.db.QueryContext(ctx, `
+		SELECT `+attachmentColumns+`
+		FROM attachments WHERE comment_id = ANY($1)
+		ORDER BY comment_id, position`, pq.Array(commentIDs))
+	if err != nil {
+		return nil, err
+	}
+
+	return scanAttachments(rows)
+}
+
+// GetByID returns an attachment, or nil if there is none with that ID
+func (r *AttachmentRepository) GetByID(ctx context.Context, id int) (*models.Attachment, error) {
+	rows, err := r.db.QueryContext(ctx, `
+		SELECT `+attachmentColumns+`
+		FROM attachments WHERE id = $1`, id)
+	if err != nil {
+		return nil, err
+	}
+
+	attachments, err := scanAttachments(rows)
+	if err != nil || len(attachments) == 0 {
+		return nil, err
+	}
+	return attachments[0], nil
+}
+
+// GetHeld returns the attachments waiting for review, oldest first
+func (r *AttachmentRepository) GetHeld(ctx context.Context, limit, offset int) ([]*models.Attachment, error) {
+	rows, err := r.db.QueryContext(ctx, `
+		SELECT `+attachmentColumns+`
+		FROM attachments WHERE held = true
+		ORDER BY created_at, id LIMIT $1 OFFSET $2`, limit, offset)
+	if err != nil {
+		return nil, err
+	}
+
+	return scanAttachments(rows)
+}
+
+// Release clears the held flag of a held attachment and points it at the
+// public copies of its files
+func (r *AttachmentRepository) Release(ctx context.Context, id int, url, thumbnailURL string) error {
+	result, err := r.db.ExecContext(ctx, `
+		UPDATE attachments SET held = false, url = $2, thumbnail_url = $3
+		WHERE id = $1 AND held = true`, id, url, thumbnailURL)
+	if err != nil {
+		return err
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if rowsAffected == 0 {
+		return models.ErrAttachmentNotFound
+	}
+
+	return nil
+}
+
+// Delete removes an attachment and returns it, so its objects can be
+// released, or nil if there was none with that ID
+func (r *AttachmentRepository) Delete(ctx context.Context, id int) (*models.Attachment, error) {
+	rows, err := r.db.QueryContext(ctx, `
+		DELETE FROM attachments WHERE id = $1
+		RETURNING `+attachmentColumns, id)
+	if err != nil {
+		return nil, err
+	}
+
+	attachments, err := scanAttachments(rows)
+	if err != nil || len(attachments) == 0 {
+		return nil, err
+	}
+	return attachments[0], nil
+}
+
+func scanAttachments(rows *sql.Rows) ([]*models.Attachment, error) {
+	defer rows.Close()
+
+	var attachments []*models.Attachment
+	for rows.Next() {
+		attachment := &models.Attachment{}
+		var commentID sql.NullInt64
+		err := rows.Scan(
+			&attachment.ID, &attachment.PostID, &commentID, &attachment.Position, &attachment.URL,
+			&attachment.ThumbnailURL, &attachment.Filename, &attachment.ContentType, &attachment.Size,
+			&attachment.Width, &attachment.Height, &attachment.Duration, &attachment.Spoiler, &attachment.AltText,
+			&attachment.ImageHash, &attachment.Held, &attachment.CreatedAt,
+		)
+		if err != nil {
+			return nil, err
+		}
+		if commentID.Valid {
+			id := int(commentID.Int64)
+			attachment.CommentID = &id
+		}
+		attachments = append(attachments, attachment)
+	}
+
+	return attachments, rows.Err()
+}
@@ -0,0 +1,119 @@
+package repository
+
+import (
+	"1337b04rd/internal/domain/models"
+	"context"
+	"database/sql"
+	"errors"
+
+	"github.com/lib/pq"
+)
+
+type BoardRepository struct {
+	db *sql.DB
+}
+
+func NewBoardRepository(db *sql.DB) *BoardRepository {
+	return &BoardRepository{db: db}
+}
+
+func (r *BoardRepository) GetBySlug(ctx context.Context, slug string) (*models.Board, error) {
+	query := `
+		SELECT slug, name, bump_limit, max_threads, archive_enabled, reactions, max_attachments,
+			max_file_size, max_video_duration, image_ban_action, created_at
+		FROM boards WHERE slug = $1`
+
+	board := &models.Board{}
+	var reactions []string
+	err := r.db.QueryRowContext(ctx, query, slug).Scan(
+		&board.Slug, &board.Name, &board.BumpLimit, &board.MaxThreads, &board.ArchiveEnabled, pq.Array(&reactions), &board.MaxAttachments,
+		&board.MaxFileSize, &board.MaxVideoDuration, &board.ImageBanAction, &board.CreatedAt,
+	)
+
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, nil
+		}
+		return nil, err
+	}
+
+	// Boards without a configured set use the default reactions
+	board.Reactions = reactions
+	if reactions == nil {
+		board.Reactions = models.DefaultReactions
+	}
+
+	return board, nil
+}
+
+// SetReactions replaces the reaction set of a board. A nil set restores the
+// default reactions.
+func (r *BoardRepository) SetReactions(ctx context.Context, slug string, reactions []string) error {
+	var value interface{}
+	if reactions != nil {
+		value = pq.Array(reactions)
+	}
+
+	result, err := r.db.ExecContext(ctx, `UPDATE boards SET reactions = $1 WHERE slug = $2`, value, slug)
+	if err != nil {
+		return err
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if rowsAffected == 0 {
+		return models.ErrBoardNotFound
+	}
+
+	return nil
+}
+
+// SetLimits updates the limits of a board, leaving the nil ones unchanged
+func (r *BoardRepository) SetLimits(ctx context.Context, slug string, limits models.BoardLimits) error {
+	query := `
+		UPDATE boards SET
+			bump_limit = COALESCE($1, bump_limit),
+			max_threads = COALESCE($2, max_threads),
+			max_attachments = COALESCE($3, max_attachments),
+			max_file_size = COALESCE($4, max_file_size),
+			max_video_duration = COALESCE($5, max_video_duration)
+		WHERE slug = $6`
+
+	result, err := r.db.ExecContext(ctx, query,
+		limits.BumpLimit, limits.MaxThreads, limits.MaxAttachments, limits.MaxFileSize, limits.MaxVideoDuration, slug,
+	)
+	if err != nil {
+		return err
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if rowsAffected == 0 {
+		return models.ErrBoardNotFound
+	}
+
+	return nil
+}
+
+// SetImageBanAction sets what a board does with uploads matching a banned
+// image
+func (r *BoardRepository) SetImageBanAction(ctx context.Context, slug, action string) error {
+	result, err := r.db.ExecContext(ctx, `UPDATE boards SET image_ban_action = $1 WHERE slug = $2`, action, slug)
+	if err != nil {
+		return err
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if rowsAffected == 0 {
+		return models.ErrBoardNotFound
+	}
+
+	return nil
+}
@@ -0,0 +1,98 @@
+package repository
+
+import (
+	"1337b04rd/internal/domain/models"
+	"context"
+	"database/sql"
+
+	"github.com/lib/pq"
+)
+
+type CommentReferenceRepository struct {
+	db dbtx
+}
+
+func NewCommentReferenceRepository(db *sql.DB) *CommentReferenceRepository {
+	return &CommentReferenceRepository{db: db}
+}
+
+// ReplaceForComment swaps the stored references of a comment for refs
+func (r *CommentReferenceRepository) ReplaceForComment(ctx context.Context, commentID int, refs []*models.CommentReference) error {
+	tx, err := begin(ctx, r.db)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	_, err = tx.ExecContext(ctx, `DELETE FROM comment_references WHERE comment_id = $1`, commentID)
+	if err != nil {
+		return err
+	}
+
+	query := `
+		INSERT INTO comment_references (comment_id, post_id, target_id, target_board, target_post_id)
+		VALUES ($1, $2, $3, $4, $5)`
+
+	for _, ref := range refs {
+		_, err = tx.ExecContext(ctx, query,
+			commentID, ref.PostID, ref.TargetID, ref.TargetBoard, ref.TargetPostID,
+		)
+		if err != nil {
+			return err
+		}
+	}
+
+	return tx.Commit()
+}
+
+// GetByCommentIDs returns the references made by the given comments
+func (r *CommentReferenceRepository) GetByCommentIDs(ctx context.Context, commentIDs []int) ([]*models.CommentReference, error) {
+	query := `
+		SELECT comment_id, post_id, target_id, target_board, target_post_id
+		FROM comment_references WHERE comment_id = ANY($1) ORDER BY id ASC`
+
+	return r.query(ctx, query, pq.Array(commentIDs))
+}
+
+// GetByTargetIDs returns the references pointing at the given comments
+// from comments viewer may see
+func (r *CommentReferenceRepository) GetByTargetIDs(ctx context.Context, targetIDs []int, viewer models.Viewer) ([]*models.CommentReference, error) {
+	query := `
+		SELECT r.comment_id, r.post_id, r.target_id, r.target_board, r.target_post_id
+		FROM comment_references r
+		JOIN comments c ON c.id = r.comment_id
+		WHERE r.target_id = ANY($1) AND r.target_post_id IS NOT NULL AND ` + visibleTo(2) + `
+		ORDER BY r.id ASC`
+
+	return r.query(ctx, query, pq.Array(targetIDs), viewer.Staff, viewer.SessionID)
+}
+
+func (r *CommentReferenceRepository) query(ctx context.Context, query string, args ...interface{}) ([]*models.CommentReference, error) {
+	rows, err := r.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var refs []*models.CommentReference
+	for rows.Next() {
+		ref := &models.CommentReference{}
+		var targetPostID sql.NullInt64
+
+		err := rows.Scan(&ref.CommentID, &ref.PostID, &ref.TargetID, &ref.TargetBoard, &targetPostID)
+		if err != nil {
+			return nil, err
+		}
+
+		// Handle NULL values
+		if targetPostID.Valid {
+			postID := int(targetPostID.Int64)
+			ref.TargetPostID = &postID
+			ref.CrossThread = postID != ref.PostID
+		}
+
+		refs = append(refs, ref)
+	}
+
+	return refs, rows.Err()
+}
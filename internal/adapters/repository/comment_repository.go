@@ -2,56 +2,57 @@ package repository
 
 import (
 	"1337b04rd/internal/domain/models"
+	"1337b04rd/pkg/markup"
 	"context"
 	"database/sql"
 	"errors"
 )
 
 type CommentRepository struct {
-	db *sql.DB
+	db dbtx
 }
 
 func NewCommentRepository(db *sql.DB) *CommentRepository {
 	return &CommentRepository{db: db}
 }
 
-func (r *CommentRepository) Create(ctx context.Context, comment *models.Comment) error {
-	query := `
-		INSERT INTO comments (post_id, title, content, author_id, author_name, author_image, image_url, reply_to_comment_id, created_at)
-		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9)
-		RETURNING id`
-
-	err := r.db.QueryRowContext(ctx, query,
-		comment.PostID, comment.Title, comment.Content, comment.AuthorID,
-		comment.AuthorName, comment.AuthorImage, comment.ImageURL, comment.ReplyToCommentID, comment.CreatedAt,
-	).Scan(&comment.ID)
-
-	return err
-}
-
-func (r *CommentRepository) GetByID(ctx context.Context, id int) (*models.Comment, error) {
-	query := `
-		SELECT id, post_id, title, content, author_id, author_name, author_image, image_url, reply_to_comment_id, created_at
-		FROM comments WHERE id = $1`
+// commentColumns is the column list shared by every comment SELECT
+const commentColumns = `id, post_id, title, content, content_html, author_id, author_name, tripcode, author_image,
+		image_url, reply_to_comment_id, sage, reaction_counts, created_at, edited_at, version, flagged, visibility, ip_hash`
 
+func scanComment(row rowScanner) (*models.Comment, error) {
 	comment := &models.Comment{}
+	var contentHTML sql.NullString
+	var tripcode sql.NullString
 	var authorImage sql.NullString
 	var imageURL sql.NullString
 	var replyToCommentID sql.NullInt64
-	
-	err := r.db.QueryRowContext(ctx, query, id).Scan(
-		&comment.ID, &comment.PostID, &comment.Title, &comment.Content, &comment.AuthorID,
-		&comment.AuthorName, &authorImage, &imageURL, &replyToCommentID, &comment.CreatedAt,
+	var editedAt sql.NullTime
+	var reactionCounts []byte
+
+	err := row.Scan(
+		&comment.ID, &comment.PostID, &comment.Title, &comment.Content, &contentHTML, &comment.AuthorID,
+		&comment.AuthorName, &tripcode, &authorImage, &imageURL, &replyToCommentID, &comment.Sage, &reactionCounts, &comment.CreatedAt,
+		&editedAt, &comment.Version, &comment.Flagged, &comment.Visibility, &comment.IPHash,
 	)
+	if err != nil {
+		return nil, err
+	}
 
+	comment.Reactions, err = parseReactionCounts(reactionCounts)
 	if err != nil {
-		if errors.Is(err, sql.ErrNoRows) {
-			return nil, nil
-		}
 		return nil, err
 	}
+	comment.MyReactions = []string{}
 
-	// Handle NULL values
+	// Handle NULL values, rendering rows written before markup was cached
+	comment.ContentHTML = contentHTML.String
+	if !contentHTML.Valid {
+		comment.ContentHTML = markup.Render(comment.Content)
+	}
+	if tripcode.Valid {
+		comment.Tripcode = tripcode.String
+	}
 	if authorImage.Valid {
 		comment.AuthorImage = authorImage.String
 	}
@@ -62,16 +63,15 @@ func (r *CommentRepository) GetByID(ctx context.Context, id int) (*models.Commen
 		replyID := int(replyToCommentID.Int64)
 		comment.ReplyToCommentID = &replyID
 	}
+	if editedAt.Valid {
+		comment.EditedAt = editedAt.Time
+	}
 
 	return comment, nil
 }
 
-func (r *CommentRepository) GetByPostID(ctx context.Context, postID int) ([]*models.Comment, error) {
-	query := `
-		SELECT id, post_id, title, content, author_id, author_name, author_image, image_url, reply_to_comment_id, created_at
-		FROM comments WHERE post_id = $1 ORDER BY created_at ASC`
-
-	rows, err := r.db.QueryContext(ctx, query, postID)
+func (r *CommentRepository) queryComments(ctx context.Context, query string, args ...interface{}) ([]*models.Comment, error) {
+	rows, err := r.db.QueryContext(ctx, query, args...)
 	if err != nil {
 		return nil, err
 	}
@@ -79,45 +79,60 @@ func (r *CommentRepository) GetByPostID(ctx context.Context, postID int) ([]*mod
 
 	var comments []*models.Comment
 	for rows.Next() {
-		comment := &models.Comment{}
-		var authorImage sql.NullString
-		var imageURL sql.NullString
-		var replyToCommentID sql.NullInt64
-		
-		err := rows.Scan(
-			&comment.ID, &comment.PostID, &comment.Title, &comment.Content, &comment.AuthorID,
-			&comment.AuthorName, &authorImage, &imageURL, &replyToCommentID, &comment.CreatedAt,
-		)
+		comment, err := scanComment(rows)
 		if err != nil {
 			return nil, err
 		}
-		
-		// Handle NULL values
-		if authorImage.Valid {
-			comment.AuthorImage = authorImage.String
-		}
-		if imageURL.Valid {
-			comment.ImageURL = imageURL.String
-		}
-		if replyToCommentID.Valid {
-			replyID := int(replyToCommentID.Int64)
-			comment.ReplyToCommentID = &replyID
-		}
-		
 		comments = append(comments, comment)
 	}
 
-	return comments, nil
+	return comments, rows.Err()
+}
+
+func (r *CommentRepository) Create(ctx context.Context, comment *models.Comment) error {
+	query := `
+		INSERT INTO comments (post_id, title, content, content_html, author_id, author_name, tripcode, author_image, image_url, reply_to_comment_id, sage, created_at, flagged, visibility, ip_hash)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13, $14, $15)
+		RETURNING id, version`
+
+	err := r.db.QueryRowContext(ctx, query,
+		comment.PostID, comment.Title, comment.Content, comment.ContentHTML, comment.AuthorID,
+		comment.AuthorName, comment.Tripcode, comment.AuthorImage, comment.ImageURL, comment.ReplyToCommentID, comment.Sage, comment.CreatedAt,
+		comment.Flagged, comment.Visibility, comment.IPHash,
+	).Scan(&comment.ID, &comment.Version)
+
+	return err
+}
+
+func (r *CommentRepository) GetByID(ctx context.Context, id int) (*models.Comment, error) {
+	query := `SELECT ` + commentColumns + ` FROM comments WHERE id = $1`
+
+	comment, err := scanComment(r.db.QueryRowContext(ctx, query, id))
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, nil
+		}
+		return nil, err
+	}
+
+	return comment, nil
+}
+
+// GetByPostID lists the replies of a thread that viewer may see
+func (r *CommentRepository) GetByPostID(ctx context.Context, postID int, viewer models.Viewer) ([]*models.Comment, error) {
+	query := `SELECT ` + commentColumns + ` FROM comments WHERE post_id = $1 AND ` + visibleTo(2) + ` ORDER BY created_at ASC`
+
+	return r.queryComments(ctx, query, postID, viewer.Staff, viewer.SessionID)
 }
 
 func (r *CommentRepository) Update(ctx context.Context, comment *models.Comment) error {
 	query := `
-		UPDATE comments SET title = $1, content = $2, author_id = $3, author_name = $4, 
-		image_url = $5, reply_to_comment_id = $6 WHERE id = $7`
+		UPDATE comments SET title = $1, content = $2, content_html = $3, author_id = $4, author_name = $5,
+		image_url = $6, reply_to_comment_id = $7, flagged = $8, visibility = $9 WHERE id = $10`
 
 	result, err := r.db.ExecContext(ctx, query,
-		comment.Title, comment.Content, comment.AuthorID, comment.AuthorName,
-		comment.ImageURL, comment.ReplyToCommentID, comment.ID,
+		comment.Title, comment.Content, comment.ContentHTML, comment.AuthorID, comment.AuthorName,
+		comment.ImageURL, comment.ReplyToCommentID, comment.Flagged, comment.Visibility, comment.ID,
 	)
 	if err != nil {
 		return err
@@ -135,6 +150,69 @@ func (r *CommentRepository) Update(ctx context.Context, comment *models.Comment)
 	return nil
 }
 
+// Edit saves an author's edit of a comment made from comment.Version. The
+// row is locked while the version and authorship are checked, the version
+// being replaced is kept as a revision, and the comment's edited_at is set
+// to comment.EditedAt, all in one transaction. On success comment.Version is
+// the new version.
+func (r *CommentRepository) Edit(ctx context.Context, comment *models.Comment, editorID string) error {
+	tx, err := begin(ctx, r.db)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	var authorID string
+	var version int
+	err = tx.QueryRowContext(ctx, `SELECT author_id, version FROM comments WHERE id = $1 FOR UPDATE`, comment.ID).Scan(&authorID, &version)
+	if errors.Is(err, sql.ErrNoRows) {
+		return models.ErrCommentNotFound
+	}
+	if err != nil {
+		return err
+	}
+	if authorID != editorID {
+		return models.ErrNotAuthor
+	}
+	if version != comment.Version {
+		return models.ErrVersionConflict
+	}
+
+	revisionQuery := `
+		INSERT INTO comment_revisions (comment_id, title, content, image_url, editor_id, created_at)
+		SELECT id, title, content, image_url, $1, $2 FROM comments WHERE id = $3`
+
+	_, err = tx.ExecContext(ctx, revisionQuery, editorID, comment.EditedAt, comment.ID)
+	if err != nil {
+		return err
+	}
+
+	query := `
+		UPDATE comments SET title = $1, content = $2, content_html = $3, author_name = $4,
+		image_url = $5, flagged = $6, visibility = $7, edited_at = $8, version = version + 1
+		WHERE id = $9
+		RETURNING version`
+
+	err = tx.QueryRowContext(ctx, query,
+		comment.Title, comment.Content, comment.ContentHTML, comment.AuthorName,
+		comment.ImageURL, comment.Flagged, comment.Visibility, comment.EditedAt, comment.ID,
+	).Scan(&comment.Version)
+	if err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// GetRevisions returns the earlier versions of a comment, oldest first
+func (r *CommentRepository) GetRevisions(ctx context.Context, commentID int) ([]*models.Revision, error) {
+	query := `
+		SELECT id, title, content, image_url, editor_id, created_at
+		FROM comment_revisions WHERE comment_id = $1 ORDER BY id`
+
+	return queryRevisions(ctx, r.db, query, commentID)
+}
+
 func (r *CommentRepository) Delete(ctx context.Context, id int) error {
 	query := `DELETE FROM comments WHERE id = $1`
 
@@ -154,3 +232,48 @@ func (r *CommentRepository) Delete(ctx context.Context, id int) error {
 
 	return nil
 }
+
+// Unflag takes a comment out of the flagged queue
+func (r *CommentRepository) Unflag(ctx context.Context, id int) error {
+	return r.setModeration(ctx, `UPDATE comments SET flagged = false WHERE id = $1`, id)
+}
+
+// Approve shows a pending comment to everyone
+func (r *CommentRepository) Approve(ctx context.Context, id int) error {
+	return r.setModeration(ctx, `UPDATE comments SET visibility = 'visible', flagged = false WHERE id = $1`, id)
+}
+
+// setModeration runs an update of a comment's moderation state
+func (r *CommentRepository) setModeration(ctx context.Context, query string, id int) error {
+	result, err := r.db.ExecContext(ctx, query, id)
+	if err != nil {
+		return err
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+
+	if rowsAffected == 0 {
+		return models.ErrCommentNotFound
+	}
+
+	return nil
+}
+
+// GetPending returns the comments waiting for approval, oldest first
+func (r *CommentRepository) GetPending(ctx context.Context, limit, offset int) ([]*models.Comment, error) {
+	query := `SELECT ` + commentColumns + ` FROM comments WHERE visibility = 'pending'
+		ORDER BY created_at ASC, id ASC LIMIT $1 OFFSET $2`
+
+	return r.queryComments(ctx, query, limit, offset)
+}
+
+// GetFlagged returns the comments flagged by the filter rules, oldest first
+func (r *CommentRepository) GetFlagged(ctx context.Context, limit, offset int) ([]*models.Comment, error) {
+	query := `SELECT ` + commentColumns + ` FROM comments WHERE flagged = true
+		ORDER BY created_at ASC, id ASC LIMIT $1 OFFSET $2`
+
+	return r.queryComments(ctx, query, limit, offset)
+}
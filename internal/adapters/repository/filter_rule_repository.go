@@ -0,0 +1,109 @@
+package repository
+
+import (
+	"1337b04rd/internal/domain/models"
+	"context"
+	"database/sql"
+	"time"
+
+	"github.com/lib/pq"
+)
+
+type FilterRuleRepository struct {
+	db *sql.DB
+}
+
+func NewFilterRuleRepository(db *sql.DB) *FilterRuleRepository {
+	return &FilterRuleRepository{db: db}
+}
+
+// nullString stores empty strings as NULL
+func nullString(s string) sql.NullString {
+	return sql.NullString{String: s, Valid: s != ""}
+}
+
+func (r *FilterRuleRepository) Create(ctx context.Context, rule *models.FilterRule) error {
+	return r.db.QueryRowContext(ctx, `
+		INSERT INTO filter_rules (board, pattern, is_regex, action, replacement, message, enabled, created_at)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8)
+		RETURNING id`,
+		nullString(rule.Board), rule.Pattern, rule.IsRegex, rule.Action, rule.Replacement, rule.Message, rule.Enabled, rule.CreatedAt,
+	).Scan(&rule.ID)
+}
+
+// GetAll returns every rule in the order they are applied
+func (r *FilterRuleRepository) GetAll(ctx context.Context) ([]*models.FilterRule, error) {
+	rows, err := r.db.QueryContext(ctx, `
+		SELECT id, board, pattern, is_regex, action, replacement, message, enabled, hits, last_hit_at, created_at
+		FROM filter_rules ORDER BY id`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	rules := []*models.FilterRule{}
+	for rows.Next() {
+		rule := &models.FilterRule{}
+		var board sql.NullString
+		var lastHitAt sql.NullTime
+		err := rows.Scan(
+			&rule.ID, &board, &rule.Pattern, &rule.IsRegex, &rule.Action, &rule.Replacement, &rule.Message,
+			&rule.Enabled, &rule.Hits, &lastHitAt, &rule.CreatedAt,
+		)
+		if err != nil {
+			return nil, err
+		}
+		rule.Board = board.String
+		rule.LastHitAt = lastHitAt.Time
+		rules = append(rules, rule)
+	}
+
+	return rules, rows.Err()
+}
+
+// Update saves a rule's settings; its hit counters are left alone
+func (r *FilterRuleRepository) Update(ctx context.Context, rule *models.FilterRule) error {
+	result, err := r.db.ExecContext(ctx, `
+		UPDATE filter_rules SET board = $1, pattern = $2, is_regex = $3, action = $4, replacement = $5,
+		message = $6, enabled = $7 WHERE id = $8`,
+		nullString(rule.Board), rule.Pattern, rule.IsRegex, rule.Action, rule.Replacement, rule.Message, rule.Enabled, rule.ID,
+	)
+	if err != nil {
+		return err
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if rowsAffected == 0 {
+		return models.ErrFilterRuleNotFound
+	}
+
+	return nil
+}
+
+func (r *FilterRuleRepository) Delete(ctx context.Context, id int) error {
+	result, err := r.db.ExecContext(ctx, `DELETE FROM filter_rules WHERE id = $1`, id)
+	if err != nil {
+		return err
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if rowsAffected == 0 {
+		return models.ErrFilterRuleNotFound
+	}
+
+	return nil
+}
+
+// AddHits counts one hit on each of the rules
+func (r *FilterRuleRepository) AddHits(ctx context.Context, ids []int, at time.Time) error {
+	_, err := r.db.ExecContext(ctx, `
+		UPDATE filter_rules SET hits = hits + 1, last_hit_at = $2
+		WHERE id = ANY($1)`, pq.Array(ids), at)
+	return err
+}
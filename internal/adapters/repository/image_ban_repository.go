@@ -0,0 +1,62 @@
+package repository
+
+import (
+	"1337b04rd/internal/domain/models"
+	"context"
+	"database/sql"
+)
+
+type ImageBanRepository struct {
+	db *sql.DB
+}
+
+func NewImageBanRepository(db *sql.DB) *ImageBanRepository {
+	return &ImageBanRepository{db: db}
+}
+
+func (r *ImageBanRepository) Create(ctx context.Context, ban *models.ImageBan) error {
+	return r.db.QueryRowContext(ctx, `
+		INSERT INTO image_bans (hash, threshold, reason, created_at)
+		VALUES ($1, $2, $3, $4)
+		RETURNING id`, ban.Hash, ban.Threshold, ban.Reason, ban.CreatedAt,
+	).Scan(&ban.ID)
+}
+
+// GetAll returns every ban, newest first
+func (r *ImageBanRepository) GetAll(ctx context.Context) ([]*models.ImageBan, error) {
+	rows, err := r.db.QueryContext(ctx, `
+		SELECT id, hash, threshold, reason, created_at
+		FROM image_bans ORDER BY id DESC`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	bans := []*models.ImageBan{}
+	for rows.Next() {
+		ban := &models.ImageBan{}
+		if err := rows.Scan(&ban.ID, &ban.Hash, &ban.Threshold, &ban.Reason, &ban.CreatedAt); err != nil {
+			return nil, err
+		}
+		bans = append(bans, ban)
+	}
+
+	return bans, rows.Err()
+}
+
+func (r *ImageBanRepository) Delete(ctx context.Context, id int) error {
+	result, err := r.db.ExecContext(ctx, `DELETE FROM image_bans WHERE id = $1`, id)
+	if err != nil {
+		return err
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if rowsAffected == 0 {
+		return models.ErrImageBanNotFound
+	}
+
+	return nil
+}
@@ -0,0 +1,72 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+)
+
+// ObjectRepository counts the references to content-addressed objects in
+// storage
+type ObjectRepository struct {
+	db *sql.DB
+}
+
+func NewObjectRepository(db *sql.DB) *ObjectRepository {
+	return &ObjectRepository{db: db}
+}
+
+// Acquire takes a reference on an object, starting its count if it has none
+func (r *ObjectRepository) Acquire(ctx context.Context, bucket, objectName string) error {
+	_, err := r.db.ExecContext(ctx, `
+		INSERT INTO stored_objects (bucket, object_name, ref_count, created_at)
+		VALUES ($1, $2, 1, NOW())
+		ON CONFLICT (bucket, object_name) DO UPDATE SET ref_count = stored_objects.ref_count + 1`,
+		bucket, objectName)
+	return err
+}
+
+// Release drops a reference on an object. When the last one goes, remove is
+// called while the count is still locked, so a concurrent Acquire waits and
+// then starts a new count instead of sharing an object about to disappear;
+// if remove fails the reference is kept. Objects that were never counted
+// are passed to remove straight away.
+func (r *ObjectRepository) Release(ctx context.Context, bucket, objectName string, remove func() error) error {
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	var refCount int
+	err = tx.QueryRowContext(ctx, `
+		SELECT ref_count FROM stored_objects
+		WHERE bucket = $1 AND object_name = $2
+		FOR UPDATE`, bucket, objectName).Scan(&refCount)
+	if errors.Is(err, sql.ErrNoRows) {
+		return remove()
+	}
+	if err != nil {
+		return err
+	}
+
+	if refCount > 1 {
+		_, err = tx.ExecContext(ctx, `
+			UPDATE stored_objects SET ref_count = ref_count - 1
+			WHERE bucket = $1 AND object_name = $2`, bucket, objectName)
+		if err != nil {
+			return err
+		}
+		return tx.Commit()
+	}
+
+	_, err = tx.ExecContext(ctx, `
+		DELETE FROM stored_objects WHERE bucket = $1 AND object_name = $2`, bucket, objectName)
+	if err != nil {
+		return err
+	}
+	if err := remove(); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
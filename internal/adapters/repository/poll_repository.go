@@ -0,0 +1,190 @@
+package repository
+
+import (
+	"1337b04rd/internal/domain/models"
+	"context"
+	"database/sql"
+	"errors"
+	"time"
+
+	"github.com/lib/pq"
+)
+
+type PollRepository struct {
+	db dbtx
+}
+
+func NewPollRepository(db *sql.DB) *PollRepository {
+	return &PollRepository{db: db}
+}
+
+// Create inserts a poll together with its options
+func (r *PollRepository) Create(ctx context.Context, poll *models.Poll) error {
+	tx, err := begin(ctx, r.db)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	var closesAt sql.NullTime
+	if poll.ClosesAt != nil {
+		closesAt = nullTime(*poll.ClosesAt)
+	}
+
+	err = tx.QueryRowContext(ctx, `
+		INSERT INTO polls (post_id, question, multiple_choice, closes_at, created_at)
+		VALUES ($1, $2, $3, $4, $5)
+		RETURNING id`,
+		poll.PostID, poll.Question, poll.MultipleChoice, closesAt, poll.CreatedAt,
+	).Scan(&poll.ID)
+	if err != nil {
+		return err
+	}
+
+	for _, option := range poll.Options {
+		err := tx.QueryRowContext(ctx, `
+			INSERT INTO poll_options (poll_id, position, text)
+			VALUES ($1, $2, $3)
+			RETURNING id`,
+			poll.ID, option.Position, option.Text,
+		).Scan(&option.ID)
+		if err != nil {
+			return err
+		}
+	}
+
+	return tx.Commit()
+}
+
+// GetByPostIDs returns the polls of the given threads with their options
+// and vote counts
+func (r *PollRepository) GetByPostIDs(ctx context.Context, postIDs []int) ([]*models.Poll, error) {
+	rows, err := r.db.QueryContext(ctx, `
+		SELECT id, post_id, question, multiple_choice, closes_at, created_at
+		FROM polls WHERE post_id = ANY($1)`, pq.Array(postIDs))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var polls []*models.Poll
+	byID := make(map[int]*models.Poll)
+	var pollIDs []int
+	for rows.Next() {
+		poll := &models.Poll{Options: []*models.PollOption{}}
+		var closesAt sql.NullTime
+		err := rows.Scan(&poll.ID, &poll.PostID, &poll.Question, &poll.MultipleChoice, &closesAt, &poll.CreatedAt)
+		if err != nil {
+			return nil, err
+		}
+		if closesAt.Valid {
+			poll.ClosesAt = &closesAt.Time
+		}
+		polls = append(polls, poll)
+		byID[poll.ID] = poll
+		pollIDs = append(pollIDs, poll.ID)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	if len(polls) == 0 {
+		return nil, nil
+	}
+
+	optionRows, err := r.db.QueryContext(ctx, `
+		SELECT id, poll_id, position, text, votes
+		FROM poll_options WHERE poll_id = ANY($1)
+		ORDER BY poll_id, position`, pq.Array(pollIDs))
+	if err != nil {
+		return nil, err
+	}
+	defer optionRows.Close()
+
+	for optionRows.Next() {
+		option := &models.PollOption{}
+		var pollID, votes int
+		if err := optionRows.Scan(&option.ID, &pollID, &option.Position, &option.Text, &votes); err != nil {
+			return nil, err
+		}
+		option.Votes = &votes
+		if poll, ok := byID[pollID]; ok {
+			poll.Options = append(poll.Options, option)
+		}
+	}
+
+	return polls, optionRows.Err()
+}
+
+// GetVotesBySession returns the options a session chose in the given polls
+func (r *PollRepository) GetVotesBySession(ctx context.Context, sessionID string, pollIDs []int) ([]*models.PollVote, error) {
+	rows, err := r.db.QueryContext(ctx, `
+		SELECT poll_id, option_id, session_id, created_at
+		FROM poll_votes WHERE session_id = $1 AND poll_id = ANY($2)`, sessionID, pq.Array(pollIDs))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var votes []*models.PollVote
+	for rows.Next() {
+		vote := &models.PollVote{}
+		if err := rows.Scan(&vote.PollID, &vote.OptionID, &vote.SessionID, &vote.CreatedAt); err != nil {
+			return nil, err
+		}
+		votes = append(votes, vote)
+	}
+
+	return votes, rows.Err()
+}
+
+// Vote records a session's ballot and updates the option counts in one
+// transaction. The poll row is locked so a session can only vote once even
+// when submitting concurrently.
+func (r *PollRepository) Vote(ctx context.Context, pollID int, sessionID string, optionIDs []int, at time.Time) error {
+	tx, err := begin(ctx, r.db)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	var closesAt sql.NullTime
+	err = tx.QueryRowContext(ctx, `SELECT closes_at FROM polls WHERE id = $1 FOR UPDATE`, pollID).Scan(&closesAt)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return models.ErrPollNotFound
+		}
+		return err
+	}
+	if closesAt.Valid && !at.Before(closesAt.Time) {
+		return models.ErrPollClosed
+	}
+
+	var voted bool
+	err = tx.QueryRowContext(ctx,
+		`SELECT EXISTS (SELECT 1 FROM poll_votes WHERE poll_id = $1 AND session_id = $2)`, pollID, sessionID,
+	).Scan(&voted)
+	if err != nil {
+		return err
+	}
+	if voted {
+		return models.ErrAlreadyVoted
+	}
+
+	for _, optionID := range optionIDs {
+		_, err := tx.ExecContext(ctx, `
+			INSERT INTO poll_votes (poll_id, option_id, session_id, created_at)
+			VALUES ($1, $2, $3, $4)`,
+			pollID, optionID, sessionID, at,
+		)
+		if err != nil {
+			return err
+		}
+
+		_, err = tx.ExecContext(ctx, `UPDATE poll_options SET votes = votes + 1 WHERE id = $1 AND poll_id = $2`, optionID, pollID)
+		if err != nil {
+			return err
+		}
+	}
+
+	return tx.Commit()
+}
@@ -2,85 +2,99 @@ package repository
 
 import (
 	"1337b04rd/internal/domain/models"
+	"1337b04rd/pkg/markup"
 	"context"
 	"database/sql"
 	"errors"
+	"fmt"
+	"strings"
+	"time"
 )
 
 type PostRepository struct {
-	db *sql.DB
+	db dbtx
 }
 
 func NewPostRepository(db *sql.DB) *PostRepository {
 	return &PostRepository{db: db}
 }
 
-func (r *PostRepository) Create(ctx context.Context, post *models.Post) error {
-	query := `
-		INSERT INTO posts (title, content, author_id, author_name, author_image, image_url, is_archive, created_at, expires_at)
-		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9)
-		RETURNING id`
-
-	err := r.db.QueryRowContext(ctx, query,
-		post.Title, post.Content, post.AuthorID, post.AuthorName, post.AuthorImage,
-		post.ImageURL, post.IsArchive, post.CreatedAt, post.ExpiresAt,
-	).Scan(&post.ID)
+// postColumns is the column list shared by every post SELECT
+const postColumns = `id, board, title, content, content_html, author_id, author_name, tripcode, author_image,
+		image_url, is_archive, is_sticky, is_locked, reaction_counts, created_at, bumped_at, expires_at, archived_at,
+		edited_at, version, flagged, visibility, ip_hash,
+		(SELECT COUNT(*) FROM comments c WHERE c.post_id = posts.id AND c.visibility = 'visible') AS reply_count`
 
-	return err
+// visibleTo is the condition matching the posts or comments viewer may
+// see, with the viewer's staff flag as $n and session ID as $n+1
+func visibleTo(n int) string {
+	return fmt.Sprintf(`($%d OR visibility = 'visible' OR (author_id = $%d AND $%d <> ''))`, n, n+1, n+1)
 }
 
-func (r *PostRepository) GetByID(ctx context.Context, id int) (*models.Post, error) {
-	query := `
-		SELECT id, title, content, author_id, author_name, author_image, image_url, is_archive, created_at, expires_at
-		FROM posts WHERE id = $1`
+// rowScanner is implemented by both *sql.Row and *sql.Rows
+type rowScanner interface {
+	Scan(dest ...interface{}) error
+}
 
+func scanPost(row rowScanner) (*models.Post, error) {
 	post := &models.Post{}
+	var contentHTML sql.NullString
+	var tripcode sql.NullString
 	var authorImage sql.NullString
 	var imageURL sql.NullString
+	var bumpedAt sql.NullTime
 	var expiresAt sql.NullTime
-
-	err := r.db.QueryRowContext(ctx, query, id).Scan(
-		&post.ID, &post.Title, &post.Content, &post.AuthorID, &post.AuthorName, &authorImage,
-		&imageURL, &post.IsArchive, &post.CreatedAt, &expiresAt,
+	var archivedAt sql.NullTime
+	var editedAt sql.NullTime
+	var reactionCounts []byte
+
+	err := row.Scan(
+		&post.ID, &post.Board, &post.Title, &post.Content, &contentHTML, &post.AuthorID, &post.AuthorName, &tripcode,
+		&authorImage, &imageURL, &post.IsArchive, &post.IsSticky, &post.IsLocked, &reactionCounts, &post.CreatedAt, &bumpedAt, &expiresAt, &archivedAt,
+		&editedAt, &post.Version, &post.Flagged, &post.Visibility, &post.IPHash, &post.ReplyCount,
 	)
+	if err != nil {
+		return nil, err
+	}
 
+	post.Reactions, err = parseReactionCounts(reactionCounts)
 	if err != nil {
-		if errors.Is(err, sql.ErrNoRows) {
-			return nil, nil
-		}
 		return nil, err
 	}
+	post.MyReactions = []string{}
 
-	// Handle NULL values
+	// Handle NULL values, rendering rows written before markup was cached
+	post.ContentHTML = contentHTML.String
+	if !contentHTML.Valid {
+		post.ContentHTML = markup.Render(post.Content)
+	}
+	if tripcode.Valid {
+		post.Tripcode = tripcode.String
+	}
 	if authorImage.Valid {
 		post.AuthorImage = authorImage.String
 	}
 	if imageURL.Valid {
 		post.ImageURL = imageURL.String
 	}
+	post.BumpedAt = post.CreatedAt
+	if bumpedAt.Valid {
+		post.BumpedAt = bumpedAt.Time
+	}
 	if expiresAt.Valid {
 		post.ExpiresAt = expiresAt.Time
 	}
+	if archivedAt.Valid {
+		post.ArchivedAt = archivedAt.Time
+	}
+	if editedAt.Valid {
+		post.EditedAt = editedAt.Time
+	}
 
 	return post, nil
 }
 
-func (r *PostRepository) GetAll(ctx context.Context, limit, offset int, includeArchived bool) ([]*models.Post, error) {
-	var query string
-	var args []interface{}
-
-	if includeArchived {
-		query = `
-			SELECT id, title, content, author_id, author_name, author_image, image_url, is_archive, created_at, expires_at
-			FROM posts ORDER BY created_at DESC LIMIT $1 OFFSET $2`
-		args = []interface{}{limit, offset}
-	} else {
-		query = `
-			SELECT id, title, content, author_id, author_name, author_image, image_url, is_archive, created_at, expires_at
-			FROM posts WHERE is_archive = false ORDER BY created_at DESC LIMIT $1 OFFSET $2`
-		args = []interface{}{limit, offset}
-	}
-
+func (r *PostRepository) queryPosts(ctx context.Context, query string, args ...interface{}) ([]*models.Post, error) {
 	rows, err := r.db.QueryContext(ctx, query, args...)
 	if err != nil {
 		return nil, err
@@ -89,87 +103,234 @@ func (r *PostRepository) GetAll(ctx context.Context, limit, offset int, includeA
 
 	var posts []*models.Post
 	for rows.Next() {
-		post := &models.Post{}
-		var authorImage sql.NullString
-		var imageURL sql.NullString
-		var expiresAt sql.NullTime
-
-		err := rows.Scan(
-			&post.ID, &post.Title, &post.Content, &post.AuthorID, &post.AuthorName, &authorImage,
-			&imageURL, &post.IsArchive, &post.CreatedAt, &expiresAt,
-		)
+		post, err := scanPost(rows)
 		if err != nil {
 			return nil, err
 		}
+		posts = append(posts, post)
+	}
 
-		// Handle NULL values
-		if authorImage.Valid {
-			post.AuthorImage = authorImage.String
-		}
-		if imageURL.Valid {
-			post.ImageURL = imageURL.String
+	return posts, rows.Err()
+}
+
+// postOrderBy maps a sort option to its ORDER BY clause. Sticky threads
+// always come first regardless of the chosen order.
+func postOrderBy(sort models.PostSort) string {
+	switch sort {
+	case models.SortByCreated:
+		return "is_sticky DESC, created_at DESC, id DESC"
+	case models.SortByReplies:
+		return "is_sticky DESC, reply_count DESC, COALESCE(bumped_at, created_at) DESC"
+	default:
+		return "is_sticky DESC, COALESCE(bumped_at, created_at) DESC, id DESC"
+	}
+}
+
+// nullTime stores zero times as NULL
+func nullTime(t time.Time) sql.NullTime {
+	return sql.NullTime{Time: t, Valid: !t.IsZero()}
+}
+
+// Create inserts a new thread. If that takes its board over the board's
+// thread cap, the threads with the oldest bump are archived (or deleted when
+// the board has archiving turned off) in the same transaction. Sticky
+// threads are never pruned. Deleted threads come back with their files,
+// which the caller releases after committing.
+func (r *PostRepository) Create(ctx context.Context, post *models.Post) ([]*models.PrunedThread, error) {
+	tx, err := begin(ctx, r.db)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	// Locking the board row serializes concurrent posts to the same board
+	var maxThreads int
+	var archiveEnabled bool
+	err = tx.QueryRowContext(ctx,
+		`SELECT max_threads, archive_enabled FROM boards WHERE slug = $1 FOR UPDATE`, post.Board,
+	).Scan(&maxThreads, &archiveEnabled)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, models.ErrBoardNotFound
 		}
-		if expiresAt.Valid {
-			post.ExpiresAt = expiresAt.Time
+		return nil, err
+	}
+
+	query := `
+		INSERT INTO posts (board, title, content, content_html, author_id, author_name, tripcode, author_image, image_url, is_archive, created_at, bumped_at, expires_at, flagged, visibility, ip_hash)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13, $14, $15, $16)
+		RETURNING id, version`
+
+	err = tx.QueryRowContext(ctx, query,
+		post.Board, post.Title, post.Content, post.ContentHTML, post.AuthorID, post.AuthorName, post.Tripcode, post.AuthorImage,
+		post.ImageURL, post.IsArchive, post.CreatedAt, post.BumpedAt, nullTime(post.ExpiresAt), post.Flagged, post.Visibility, post.IPHash,
+	).Scan(&post.ID, &post.Version)
+	if err != nil {
+		return nil, err
+	}
+
+	var pruned []*models.PrunedThread
+	if maxThreads > 0 {
+		pruned, err = pruneThreads(ctx, tx, post.Board, maxThreads, archiveEnabled)
+		if err != nil {
+			return nil, err
 		}
+	}
 
-		posts = append(posts, post)
+	if err := tx.Commit(); err != nil {
+		return nil, err
 	}
 
-	return posts, nil
+	return pruned, nil
 }
 
-func (r *PostRepository) GetByAuthorID(ctx context.Context, authorID string, limit, offset int) ([]*models.Post, error) {
+// pruneThreads brings a board back down to maxThreads active threads
+func pruneThreads(ctx context.Context, tx dbtx, board string, maxThreads int, archive bool) ([]*models.PrunedThread, error) {
 	query := `
-		SELECT id, title, content, author_id, author_name, author_image, image_url, is_archive, created_at, expires_at
-		FROM posts WHERE author_id = $1 ORDER BY created_at DESC LIMIT $2 OFFSET $3`
+		SELECT id FROM posts
+		WHERE board = $1 AND is_archive = false AND is_sticky = false
+		ORDER BY COALESCE(bumped_at, created_at) ASC, id ASC
+		LIMIT GREATEST((SELECT COUNT(*) FROM posts WHERE board = $1 AND is_archive = false) - $2, 0)`
 
-	rows, err := r.db.QueryContext(ctx, query, authorID, limit, offset)
+	rows, err := tx.QueryContext(ctx, query, board, maxThreads)
 	if err != nil {
 		return nil, err
 	}
-	defer rows.Close()
 
-	var posts []*models.Post
+	var ids []int
 	for rows.Next() {
-		post := &models.Post{}
-		var authorImage sql.NullString
-		var imageURL sql.NullString
-		var expiresAt sql.NullTime
+		var id int
+		if err := rows.Scan(&id); err != nil {
+			rows.Close()
+			return nil, err
+		}
+		ids = append(ids, id)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
 
-		err := rows.Scan(
-			&post.ID, &post.Title, &post.Content, &post.AuthorID, &post.AuthorName, &authorImage,
-			&imageURL, &post.IsArchive, &post.CreatedAt, &expiresAt,
-		)
+	var pruned []*models.PrunedThread
+	for _, id := range ids {
+		thread := &models.PrunedThread{PostID: id, Board: board, Action: "archived"}
+		if archive {
+			_, err = tx.ExecContext(ctx, `UPDATE posts SET is_archive = true, archived_at = NOW() WHERE id = $1`, id)
+		} else {
+			thread.Action = "deleted"
+			err = deleteThread(ctx, tx, thread)
+		}
 		if err != nil {
 			return nil, err
 		}
+		pruned = append(pruned, thread)
+	}
 
-		// Handle NULL values
-		if authorImage.Valid {
-			post.AuthorImage = authorImage.String
+	return pruned, nil
+}
+
+// deleteThread deletes a pruned thread, first collecting the files of the
+// thread and its replies into it since their rows go with the thread
+func deleteThread(ctx context.Context, tx dbtx, thread *models.PrunedThread) error {
+	rows, err := tx.QueryContext(ctx, `
+		SELECT `+attachmentColumns+`
+		FROM attachments WHERE post_id = $1
+		ORDER BY comment_id NULLS FIRST, position`, thread.PostID)
+	if err != nil {
+		return err
+	}
+	thread.Attachments, err = scanAttachments(rows)
+	if err != nil {
+		return err
+	}
+
+	rows, err = tx.QueryContext(ctx, `
+		SELECT image_url FROM posts WHERE id = $1 AND image_url <> ''
+		UNION ALL
+		SELECT image_url FROM comments WHERE post_id = $1 AND image_url <> ''`, thread.PostID)
+	if err != nil {
+		return err
+	}
+	for rows.Next() {
+		var imageURL string
+		if err := rows.Scan(&imageURL); err != nil {
+			rows.Close()
+			return err
 		}
-		if imageURL.Valid {
-			post.ImageURL = imageURL.String
+		thread.ImageURLs = append(thread.ImageURLs, imageURL)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	_, err = tx.ExecContext(ctx, `DELETE FROM posts WHERE id = $1`, thread.PostID)
+	return err
+}
+
+// GetByID returns a thread if viewer may see it
+func (r *PostRepository) GetByID(ctx context.Context, id int, viewer models.Viewer) (*models.Post, error) {
+	query := `SELECT ` + postColumns + ` FROM posts WHERE id = $1 AND ` + visibleTo(2)
+
+	post, err := scanPost(r.db.QueryRowContext(ctx, query, id, viewer.Staff, viewer.SessionID))
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, nil
 		}
-		if expiresAt.Valid {
-			post.ExpiresAt = expiresAt.Time
+		return nil, err
+	}
+
+	return post, nil
+}
+
+// Lock reads a thread whatever its visibility and holds its row until the
+// unit of work it runs in ends, so the thread cannot be archived, locked or
+// deleted meanwhile. Outside a unit of work it is a plain read.
+func (r *PostRepository) Lock(ctx context.Context, id int) (*models.Post, error) {
+	query := `SELECT ` + postColumns + ` FROM posts WHERE id = $1 FOR NO KEY UPDATE`
+
+	post, err := scanPost(r.db.QueryRowContext(ctx, query, id))
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, nil
 		}
+		return nil, err
+	}
 
-		posts = append(posts, post)
+	return post, nil
+}
+
+// GetAll lists the threads viewer may see
+func (r *PostRepository) GetAll(ctx context.Context, viewer models.Viewer, limit, offset int, includeArchived bool, sort models.PostSort) ([]*models.Post, error) {
+	var query string
+
+	if includeArchived {
+		query = `SELECT ` + postColumns + ` FROM posts WHERE ` + visibleTo(3) + `
+			ORDER BY ` + postOrderBy(sort) + ` LIMIT $1 OFFSET $2`
+	} else {
+		query = `SELECT ` + postColumns + ` FROM posts WHERE is_archive = false AND ` + visibleTo(3) + `
+			ORDER BY ` + postOrderBy(sort) + ` LIMIT $1 OFFSET $2`
 	}
 
-	return posts, nil
+	return r.queryPosts(ctx, query, limit, offset, viewer.Staff, viewer.SessionID)
+}
+
+// GetByAuthorID lists the threads of an author that viewer may see
+func (r *PostRepository) GetByAuthorID(ctx context.Context, authorID string, viewer models.Viewer, limit, offset int) ([]*models.Post, error) {
+	query := `SELECT ` + postColumns + ` FROM posts WHERE author_id = $1 AND ` + visibleTo(4) + `
+		ORDER BY created_at DESC LIMIT $2 OFFSET $3`
+
+	return r.queryPosts(ctx, query, authorID, limit, offset, viewer.Staff, viewer.SessionID)
 }
 
 func (r *PostRepository) Update(ctx context.Context, post *models.Post) error {
 	query := `
-		UPDATE posts SET title = $1, content = $2, author_id = $3, author_name = $4, 
-		image_url = $5, is_archive = $6, expires_at = $7 WHERE id = $8`
+		UPDATE posts SET title = $1, content = $2, content_html = $3, author_id = $4, author_name = $5,
+		image_url = $6, is_archive = $7, expires_at = $8, flagged = $9, visibility = $10 WHERE id = $11`
 
 	result, err := r.db.ExecContext(ctx, query,
-		post.Title, post.Content, post.AuthorID, post.AuthorName,
-		post.ImageURL, post.IsArchive, post.ExpiresAt, post.ID,
+		post.Title, post.Content, post.ContentHTML, post.AuthorID, post.AuthorName,
+		post.ImageURL, post.IsArchive, nullTime(post.ExpiresAt), post.Flagged, post.Visibility, post.ID,
 	)
 	if err != nil {
 		return err
@@ -187,6 +348,92 @@ func (r *PostRepository) Update(ctx context.Context, post *models.Post) error {
 	return nil
 }
 
+// Edit saves an author's edit of a thread made from post.Version. The row
+// is locked while the version and authorship are checked, the version
+// being replaced is kept as a revision, and the thread's edited_at is set to
+// post.EditedAt, all in one transaction. On success post.Version is the new
+// version.
+func (r *PostRepository) Edit(ctx context.Context, post *models.Post, editorID string) error {
+	tx, err := begin(ctx, r.db)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	var authorID string
+	var version int
+	err = tx.QueryRowContext(ctx, `SELECT author_id, version FROM posts WHERE id = $1 FOR UPDATE`, post.ID).Scan(&authorID, &version)
+	if errors.Is(err, sql.ErrNoRows) {
+		return models.ErrPostNotFound
+	}
+	if err != nil {
+		return err
+	}
+	if authorID != editorID {
+		return models.ErrNotAuthor
+	}
+	if version != post.Version {
+		return models.ErrVersionConflict
+	}
+
+	revisionQuery := `
+		INSERT INTO post_revisions (post_id, title, content, image_url, editor_id, created_at)
+		SELECT id, title, content, image_url, $1, $2 FROM posts WHERE id = $3`
+
+	_, err = tx.ExecContext(ctx, revisionQuery, editorID, post.EditedAt, post.ID)
+	if err != nil {
+		return err
+	}
+
+	query := `
+		UPDATE posts SET title = $1, content = $2, content_html = $3, author_name = $4,
+		image_url = $5, flagged = $6, visibility = $7, edited_at = $8, version = version + 1
+		WHERE id = $9
+		RETURNING version`
+
+	err = tx.QueryRowContext(ctx, query,
+		post.Title, post.Content, post.ContentHTML, post.AuthorName,
+		post.ImageURL, post.Flagged, post.Visibility, post.EditedAt, post.ID,
+	).Scan(&post.Version)
+	if err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// GetRevisions returns the earlier versions of a thread, oldest first
+func (r *PostRepository) GetRevisions(ctx context.Context, postID int) ([]*models.Revision, error) {
+	query := `
+		SELECT id, title, content, image_url, editor_id, created_at
+		FROM post_revisions WHERE post_id = $1 ORDER BY id`
+
+	return queryRevisions(ctx, r.db, query, postID)
+}
+
+// queryRevisions runs a revision SELECT on either revision table
+func queryRevisions(ctx context.Context, db dbtx, query string, args ...interface{}) ([]*models.Revision, error) {
+	rows, err := db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var revisions []*models.Revision
+	for rows.Next() {
+		revision := &models.Revision{}
+		var imageURL sql.NullString
+		err := rows.Scan(&revision.ID, &revision.Title, &revision.Content, &imageURL, &revision.EditorID, &revision.CreatedAt)
+		if err != nil {
+			return nil, err
+		}
+		revision.ImageURL = imageURL.String
+		revisions = append(revisions, revision)
+	}
+
+	return revisions, rows.Err()
+}
+
 func (r *PostRepository) Delete(ctx context.Context, id int) error {
 	query := `DELETE FROM posts WHERE id = $1`
 
@@ -208,7 +455,7 @@ func (r *PostRepository) Delete(ctx context.Context, id int) error {
 }
 
 func (r *PostRepository) Archive(ctx context.Context, id int) error {
-	query := `UPDATE posts SET is_archive = true WHERE id = $1`
+	query := `UPDATE posts SET is_archive = true, archived_at = NOW() WHERE id = $1`
 
 	result, err := r.db.ExecContext(ctx, query, id)
 	if err != nil {
@@ -228,7 +475,7 @@ func (r *PostRepository) Archive(ctx context.Context, id int) error {
 }
 
 func (r *PostRepository) Unarchive(ctx context.Context, id int) error {
-	query := `UPDATE posts SET is_archive = false WHERE id = $1`
+	query := `UPDATE posts SET is_archive = false, archived_at = NULL WHERE id = $1`
 
 	result, err := r.db.ExecContext(ctx, query, id)
 	if err != nil {
@@ -246,3 +493,226 @@ func (r *PostRepository) Unarchive(ctx context.Context, id int) error {
 
 	return nil
 }
+
+// Bump moves a thread to the top of the bump order unless it has passed
+// its board's bump limit. A bump limit of zero or less disables the limit.
+func (r *PostRepository) Bump(ctx context.Context, id int, at time.Time) error {
+	query := `
+		UPDATE posts p SET bumped_at = $2
+		FROM boards b
+		WHERE p.id = $1 AND b.slug = p.board
+		AND (b.bump_limit <= 0 OR (SELECT COUNT(*) FROM comments c WHERE c.post_id = p.id) <= b.bump_limit)`
+
+	_, err := r.db.ExecContext(ctx, query, id, at)
+	return err
+}
+
+func (r *PostRepository) SetSticky(ctx context.Context, id int, sticky bool) error {
+	query := `UPDATE posts SET is_sticky = $1 WHERE id = $2`
+
+	result, err := r.db.ExecContext(ctx, query, sticky, id)
+	if err != nil {
+		return err
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+
+	if rowsAffected == 0 {
+		return errors.New("post not found")
+	}
+
+	return nil
+}
+
+func (r *PostRepository) SetLocked(ctx context.Context, id int, locked bool) error {
+	query := `UPDATE posts SET is_locked = $1 WHERE id = $2`
+
+	result, err := r.db.ExecContext(ctx, query, locked, id)
+	if err != nil {
+		return err
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+
+	if rowsAffected == 0 {
+		return errors.New("post not found")
+	}
+
+	return nil
+}
+
+// Unflag takes a thread out of the flagged queue
+func (r *PostRepository) Unflag(ctx context.Context, id int) error {
+	return r.setModeration(ctx, `UPDATE posts SET flagged = false WHERE id = $1`, id)
+}
+
+// Approve shows a pending thread to everyone
+func (r *PostRepository) Approve(ctx context.Context, id int) error {
+	return r.setModeration(ctx, `UPDATE posts SET visibility = 'visible', flagged = false WHERE id = $1`, id)
+}
+
+// setModeration runs an update of a thread's moderation state
+func (r *PostRepository) setModeration(ctx context.Context, query string, id int) error {
+	result, err := r.db.ExecContext(ctx, query, id)
+	if err != nil {
+		return err
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+
+	if rowsAffected == 0 {
+		return models.ErrPostNotFound
+	}
+
+	return nil
+}
+
+// GetPending returns the threads waiting for approval, oldest first
+func (r *PostRepository) GetPending(ctx context.Context, limit, offset int) ([]*models.Post, error) {
+	query := `SELECT ` + postColumns + ` FROM posts WHERE visibility = 'pending'
+		ORDER BY created_at ASC, id ASC LIMIT $1 OFFSET $2`
+
+	return r.queryPosts(ctx, query, limit, offset)
+}
+
+// GetFlagged returns the threads flagged by the filter rules, oldest first
+func (r *PostRepository) GetFlagged(ctx context.Context, limit, offset int) ([]*models.Post, error) {
+	query := `SELECT ` + postColumns + ` FROM posts WHERE flagged = true
+		ORDER BY created_at ASC, id ASC LIMIT $1 OFFSET $2`
+
+	return r.queryPosts(ctx, query, limit, offset)
+}
+
+// ArchiveExpired archives live threads past their expiry time. Sticky and
+// locked threads are exempt. It returns the number of archived threads.
+func (r *PostRepository) ArchiveExpired(ctx context.Context, now time.Time) (int, error) {
+	query := `
+		UPDATE posts SET is_archive = true, archived_at = $1
+		WHERE is_archive = false AND is_sticky = false AND is_locked = false
+		AND expires_at IS NOT NULL AND expires_at < $1`
+
+	result, err := r.db.ExecContext(ctx, query, now)
+	if err != nil {
+		return 0, err
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return 0, err
+	}
+
+	return int(rowsAffected), nil
+}
+
+// GetCatalog returns a summary of every live thread on a board in bump order
+func (r *PostRepository) GetCatalog(ctx context.Context, board string) ([]*models.CatalogEntry, error) {
+	query := `
+		SELECT id, board, title, content, image_url,
+		(SELECT COUNT(*) FROM comments c WHERE c.post_id = posts.id AND c.visibility = 'visible') AS reply_count,
+		(CASE WHEN COALESCE(image_url, '') <> '' THEN 1 ELSE 0 END) +
+		(SELECT COUNT(*) FROM comments c WHERE c.post_id = posts.id AND c.visibility = 'visible' AND COALESCE(c.image_url, '') <> '') AS image_count,
+		is_sticky, is_locked, created_at, COALESCE(bumped_at, created_at)
+		FROM posts WHERE board = $1 AND is_archive = false AND visibility = 'visible'
+		ORDER BY ` + postOrderBy(models.SortByBump)
+
+	rows, err := r.db.QueryContext(ctx, query, board)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var entries []*models.CatalogEntry
+	for rows.Next() {
+		entry := &models.CatalogEntry{}
+		var imageURL sql.NullString
+
+		err := rows.Scan(
+			&entry.ID, &entry.Board, &entry.Title, &entry.Excerpt, &imageURL, &entry.ReplyCount,
+			&entry.ImageCount, &entry.IsSticky, &entry.IsLocked, &entry.CreatedAt, &entry.BumpedAt,
+		)
+		if err != nil {
+			return nil, err
+		}
+
+		// Handle NULL values
+		if imageURL.Valid {
+			entry.Thumbnail = imageURL.String
+		}
+
+		entries = append(entries, entry)
+	}
+
+	return entries, rows.Err()
+}
+
+// archiveSearchCondition matches $n against title and content when non-empty
+func archiveSearchCondition(n int) string {
+	return fmt.Sprintf(`($%d = '' OR title ILIKE '%%' || $%d || '%%' OR content ILIKE '%%' || $%d || '%%')`, n, n, n)
+}
+
+// escapeLike escapes LIKE wildcards so search terms match literally
+func escapeLike(s string) string {
+	return strings.NewReplacer(`\`, `\\`, "%", `\%`, "_", `\_`).Replace(s)
+}
+
+// GetArchiveBuckets counts a board's archived threads per day or month of
+// creation, newest first, optionally restricted to a search term
+func (r *PostRepository) GetArchiveBuckets(ctx context.Context, board string, size models.ArchiveBucketSize, search string) ([]*models.ArchiveBucket, error) {
+	format := "YYYY-MM"
+	if size == models.BucketByDay {
+		format = "YYYY-MM-DD"
+	}
+
+	query := `
+		SELECT to_char(date_trunc($2, created_at), $3) AS period, COUNT(*)
+		FROM posts WHERE board = $1 AND is_archive = true AND visibility = 'visible' AND ` + archiveSearchCondition(4) + `
+		GROUP BY period ORDER BY period DESC`
+
+	rows, err := r.db.QueryContext(ctx, query, board, string(size), format, escapeLike(search))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var buckets []*models.ArchiveBucket
+	for rows.Next() {
+		bucket := &models.ArchiveBucket{}
+		if err := rows.Scan(&bucket.Period, &bucket.Count); err != nil {
+			return nil, err
+		}
+		buckets = append(buckets, bucket)
+	}
+
+	return buckets, rows.Err()
+}
+
+// GetArchived lists a board's archived threads created in [from, to),
+// optionally restricted to a search term. Zero times leave a side open.
+func (r *PostRepository) GetArchived(ctx context.Context, board string, from, to time.Time, search string, limit, offset int) ([]*models.Post, error) {
+	query := `SELECT ` + postColumns + ` FROM posts
+		WHERE board = $1 AND is_archive = true AND visibility = 'visible'
+		AND ($2::timestamp IS NULL OR created_at >= $2)
+		AND ($3::timestamp IS NULL OR created_at < $3)
+		AND ` + archiveSearchCondition(4) + `
+		ORDER BY created_at DESC LIMIT $5 OFFSET $6`
+
+	return r.queryPosts(ctx, query, board, nullTime(from), nullTime(to), escapeLike(search), limit, offset)
+}
+
+// GetArchivedBefore returns up to limit threads archived before cutoff
+func (r *PostRepository) GetArchivedBefore(ctx context.Context, cutoff time.Time, limit int) ([]*models.Post, error) {
+	query := `SELECT ` + postColumns + ` FROM posts
+		WHERE is_archive = true AND archived_at IS NOT NULL AND archived_at < $1
+		ORDER BY archived_at ASC LIMIT $2`
+
+	return r.queryPosts(ctx, query, cutoff, limit)
+}
@@ -0,0 +1,80 @@
+package repository
+
+import (
+	"1337b04rd/internal/domain/models"
+	"context"
+	"database/sql"
+)
+
+type QuarantineRepository struct {
+	db *sql.DB
+}
+
+func NewQuarantineRepository(db *sql.DB) *QuarantineRepository {
+	return &QuarantineRepository{db: db}
+}
+
+func (r *QuarantineRepository) Create(ctx context.Context, quarantine *models.Quarantine) error {
+	return r.db.QueryRowContext(ctx, `
+		INSERT INTO quarantines (session_id, ip_hash, reason, created_at)
+		VALUES ($1, $2, $3, $4)
+		RETURNING id`,
+		nullString(quarantine.SessionID), nullString(quarantine.IPHash), quarantine.Reason, quarantine.CreatedAt,
+	).Scan(&quarantine.ID)
+}
+
+// GetAll returns every quarantine, newest first
+func (r *QuarantineRepository) GetAll(ctx context.Context) ([]*models.Quarantine, error) {
+	rows, err := r.db.QueryContext(ctx, `
+		SELECT id, session_id, ip_hash, reason, created_at
+		FROM quarantines ORDER BY id DESC`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	quarantines := []*models.Quarantine{}
+	for rows.Next() {
+		quarantine := &models.Quarantine{}
+		var sessionID, ipHash sql.NullString
+		err := rows.Scan(&quarantine.ID, &sessionID, &ipHash, &quarantine.Reason, &quarantine.CreatedAt)
+		if err != nil {
+			return nil, err
+		}
+		quarantine.SessionID = sessionID.String
+		quarantine.IPHash = ipHash.String
+		quarantines = append(quarantines, quarantine)
+	}
+
+	return quarantines, rows.Err()
+}
+
+func (r *QuarantineRepository) Delete(ctx context.Context, id int) error {
+	result, err := r.db.ExecContext(ctx, `DELETE FROM quarantines WHERE id = $1`, id)
+	if err != nil {
+		return err
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if rowsAffected == 0 {
+		return models.ErrQuarantineNotFound
+	}
+
+	return nil
+}
+
+// Matches reports whether the session or the hashed address is
+// quarantined. Empty values never match.
+func (r *QuarantineRepository) Matches(ctx context.Context, sessionID, ipHash string) (bool, error) {
+	var matches bool
+	err := r.db.QueryRowContext(ctx, `
+		SELECT EXISTS (
+			SELECT 1 FROM quarantines
+			WHERE ($1 <> '' AND session_id = $1) OR ($2 <> '' AND ip_hash = $2)
+		)`, sessionID, ipHash,
+	).Scan(&matches)
+	return matches, err
+}
@@ -0,0 +1,180 @@
+package repository
+
+import (
+	"1337b04rd/internal/domain/models"
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+
+	"github.com/lib/pq"
+)
+
+type ReactionRepository struct {
+	db *sql.DB
+}
+
+func NewReactionRepository(db *sql.DB) *ReactionRepository {
+	return &ReactionRepository{db: db}
+}
+
+// parseReactionCounts decodes a reaction_counts column
+func parseReactionCounts(data []byte) (map[string]int, error) {
+	counts := make(map[string]int)
+	if len(data) == 0 {
+		return counts, nil
+	}
+	if err := json.Unmarshal(data, &counts); err != nil {
+		return nil, err
+	}
+	return counts, nil
+}
+
+// reactionCountsTable returns the table and row holding the counts a
+// reaction contributes to
+func reactionCountsTable(reaction *models.Reaction) (string, int) {
+	if reaction.CommentID != nil {
+		return "comments", *reaction.CommentID
+	}
+	return "posts", reaction.PostID
+}
+
+// Add stores a reaction and increments its count in the same transaction.
+// It reports false without changing anything when the session already gave
+// this reaction. The item's counts after the change are returned.
+func (r *ReactionRepository) Add(ctx context.Context, reaction *models.Reaction) (bool, map[string]int, error) {
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return false, nil, err
+	}
+	defer tx.Rollback()
+
+	query := `
+		INSERT INTO reactions (post_id, comment_id, session_id, emoji, created_at)
+		VALUES ($1, $2, $3, $4, $5)
+		ON CONFLICT DO NOTHING
+		RETURNING id`
+
+	err = tx.QueryRowContext(ctx, query,
+		reaction.PostID, reaction.CommentID, reaction.SessionID, reaction.Emoji, reaction.CreatedAt,
+	).Scan(&reaction.ID)
+	if errors.Is(err, sql.ErrNoRows) {
+		counts, err := getReactionCounts(ctx, tx, reaction)
+		return false, counts, err
+	}
+	if err != nil {
+		return false, nil, err
+	}
+
+	table, id := reactionCountsTable(reaction)
+	var data []byte
+	err = tx.QueryRowContext(ctx, `
+		UPDATE `+table+` SET reaction_counts = jsonb_set(reaction_counts, ARRAY[$2::text],
+			to_jsonb(COALESCE((reaction_counts->>$2::text)::int, 0) + 1))
+		WHERE id = $1
+		RETURNING reaction_counts`, id, reaction.Emoji,
+	).Scan(&data)
+	if err != nil {
+		return false, nil, err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return false, nil, err
+	}
+
+	counts, err := parseReactionCounts(data)
+	return true, counts, err
+}
+
+// Remove deletes a reaction and decrements its count in the same
+// transaction, dropping counts that reach zero. It reports false when the
+// session had not given this reaction.
+func (r *ReactionRepository) Remove(ctx context.Context, reaction *models.Reaction) (bool, map[string]int, error) {
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return false, nil, err
+	}
+	defer tx.Rollback()
+
+	query := `
+		DELETE FROM reactions
+		WHERE post_id = $1 AND COALESCE(comment_id, 0) = COALESCE($2, 0) AND session_id = $3 AND emoji = $4`
+
+	result, err := tx.ExecContext(ctx, query, reaction.PostID, reaction.CommentID, reaction.SessionID, reaction.Emoji)
+	if err != nil {
+		return false, nil, err
+	}
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return false, nil, err
+	}
+	if rowsAffected == 0 {
+		counts, err := getReactionCounts(ctx, tx, reaction)
+		return false, counts, err
+	}
+
+	table, id := reactionCountsTable(reaction)
+	var data []byte
+	err = tx.QueryRowContext(ctx, `
+		UPDATE `+table+` SET reaction_counts = CASE
+			WHEN COALESCE((reaction_counts->>$2::text)::int, 0) <= 1 THEN reaction_counts - $2::text
+			ELSE jsonb_set(reaction_counts, ARRAY[$2::text], to_jsonb((reaction_counts->>$2::text)::int - 1))
+		END
+		WHERE id = $1
+		RETURNING reaction_counts`, id, reaction.Emoji,
+	).Scan(&data)
+	if err != nil {
+		return false, nil, err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return false, nil, err
+	}
+
+	counts, err := parseReactionCounts(data)
+	return true, counts, err
+}
+
+func getReactionCounts(ctx context.Context, tx *sql.Tx, reaction *models.Reaction) (map[string]int, error) {
+	table, id := reactionCountsTable(reaction)
+
+	var data []byte
+	err := tx.QueryRowContext(ctx, `SELECT reaction_counts FROM `+table+` WHERE id = $1`, id).Scan(&data)
+	if err != nil {
+		return nil, err
+	}
+
+	return parseReactionCounts(data)
+}
+
+// GetBySession returns the reactions a session gave in the given threads,
+// covering both the posts and their comments
+func (r *ReactionRepository) GetBySession(ctx context.Context, sessionID string, postIDs []int) ([]*models.Reaction, error) {
+	query := `
+		SELECT id, post_id, comment_id, session_id, emoji, created_at
+		FROM reactions WHERE session_id = $1 AND post_id = ANY($2)
+		ORDER BY id`
+
+	rows, err := r.db.QueryContext(ctx, query, sessionID, pq.Array(postIDs))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var reactions []*models.Reaction
+	for rows.Next() {
+		reaction := &models.Reaction{}
+		var commentID sql.NullInt64
+		err := rows.Scan(&reaction.ID, &reaction.PostID, &commentID, &reaction.SessionID, &reaction.Emoji, &reaction.CreatedAt)
+		if err != nil {
+			return nil, err
+		}
+		if commentID.Valid {
+			id := int(commentID.Int64)
+			reaction.CommentID = &id
+		}
+		reactions = append(reactions, reaction)
+	}
+
+	return reactions, rows.Err()
+}
@@ -8,7 +8,7 @@ import (
 )
 
 type SessionRepository struct {
-	db *sql.DB
+	db dbtx
 }
 
 func NewSessionRepository(db *sql.DB) *SessionRepository {
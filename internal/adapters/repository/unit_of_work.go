@@ -0,0 +1,149 @@
+package repository
+
+import (
+	"1337b04rd/internal/domain/ports"
+	"context"
+	"database/sql"
+	"fmt"
+)
+
+// dbtx is what repositories run their queries on: the database, or the
+// transaction of a unit of work
+type dbtx interface {
+	ExecContext(ctx context.Context, query string, args ...interface{}) (sql.Result, error)
+	QueryContext(ctx context.Context, query string, args ...interface{}) (*sql.Rows, error)
+	QueryRowContext(ctx context.Context, query string, args ...interface{}) *sql.Row
+}
+
+// txScope is a transaction started by a single repository method
+type txScope interface {
+	dbtx
+	Commit() error
+	Rollback() error
+}
+
+// begin starts a transaction for a repository method that needs one. Inside
+// a unit of work it sets a savepoint on the unit's transaction instead, so
+// the method still rolls back its own writes on failure and the unit
+// decides whether they are kept.
+func begin(ctx context.Context, db dbtx) (txScope, error) {
+	switch db := db.(type) {
+	case *sql.DB:
+		return db.BeginTx(ctx, nil)
+	case *sql.Tx:
+		if _, err := db.ExecContext(ctx, `SAVEPOINT repository`); err != nil {
+			return nil, err
+		}
+		return &savepoint{Tx: db, ctx: ctx}, nil
+	default:
+		return nil, fmt.Errorf("cannot start a transaction on %T", db)
+	}
+}
+
+// savepoint is a txScope nested in a unit of work's transaction. Like
+// *sql.Tx, rolling back after a commit does nothing.
+type savepoint struct {
+	*sql.Tx
+	ctx  context.Context
+	done bool
+}
+
+func (s *savepoint) Commit() error {
+	if s.done {
+		return sql.ErrTxDone
+	}
+	s.done = true
+	_, err := s.Tx.ExecContext(s.ctx, `RELEASE SAVEPOINT repository`)
+	return err
+}
+
+func (s *savepoint) Rollback() error {
+	if s.done {
+		return sql.ErrTxDone
+	}
+	s.done = true
+	_, err := s.Tx.ExecContext(s.ctx, `ROLLBACK TO SAVEPOINT repository`)
+	return err
+}
+
+// UnitOfWork runs work against repositories sharing one transaction
+type UnitOfWork struct {
+	db *sql.DB
+}
+
+func NewUnitOfWork(db *sql.DB) *UnitOfWork {
+	return &UnitOfWork{db: db}
+}
+
+// Do runs fn in a transaction that is committed when fn succeeds and
+// rolled back when it fails or panics. After a rollback, or a commit that
+// fails, the compensations fn registered run newest first to undo what it
+// did outside the database.
+func (u *UnitOfWork) Do(ctx context.Context, fn func(work ports.Work) error) error {
+	tx, err := u.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+
+	w := &work{
+		posts:       &PostRepository{db: tx},
+		comments:    &CommentRepository{db: tx},
+		sessions:    &SessionRepository{db: tx},
+		attachments: &AttachmentRepository{db: tx},
+		uploads:     &UploadRepository{db: tx},
+		polls:       &PollRepository{db: tx},
+		references:  &CommentReferenceRepository{db: tx},
+	}
+
+	// Deferred so a panicking fn is rolled back and compensated as well
+	committed := false
+	defer func() {
+		if !committed {
+			tx.Rollback()
+			w.compensate(ctx)
+		}
+	}()
+
+	if err := fn(w); err != nil {
+		return err
+	}
+	if err := tx.Commit(); err != nil {
+		return err
+	}
+	committed = true
+	return nil
+}
+
+// work is the ports.Work of one UnitOfWork.Do call
+type work struct {
+	posts       *PostRepository
+	comments    *CommentRepository
+	sessions    *SessionRepository
+	attachments *AttachmentRepository
+	uploads     *UploadRepository
+	polls       *PollRepository
+	references  *CommentReferenceRepository
+
+	compensations []func(ctx context.Context)
+}
+
+func (w *work) Posts() ports.PostRepository                  { return w.posts }
+func (w *work) Comments() ports.CommentRepository            { return w.comments }
+func (w *work) Sessions() ports.SessionRepository            { return w.sessions }
+func (w *work) Attachments() ports.AttachmentRepository      { return w.attachments }
+func (w *work) Uploads() ports.UploadRepository              { return w.uploads }
+func (w *work) Polls() ports.PollRepository                  { return w.polls }
+func (w *work) References() ports.CommentReferenceRepository { return w.references }
+
+func (w *work) OnRollback(compensate func(ctx context.Context)) {
+	w.compensations = append(w.compensations, compensate)
+}
+
+// compensate runs the compensations newest first. They run even when ctx
+// was cancelled, which is often why the work failed.
+func (w *work) compensate(ctx context.Context) {
+	ctx = context.WithoutCancel(ctx)
+	for i := len(w.compensations) - 1; i >= 0; i-- {
+		w.compensations[i](ctx)
+	}
+}
@@ -0,0 +1,84 @@
+package repository
+
+import (
+	"1337b04rd/internal/domain/models"
+	"context"
+	"database/sql"
+	"time"
+)
+
+type UploadRepository struct {
+	db dbtx
+}
+
+func NewUploadRepository(db *sql.DB) *UploadRepository {
+	return &UploadRepository{db: db}
+}
+
+const uploadColumns = `id, session_id, bucket, object_name, filename, content_type, size, created_at, expires_at`
+
+func (r *UploadRepository) Create(ctx context.Context, upload *models.Upload) error {
+	_, err := r.db.ExecContext(ctx, `
+		INSERT INTO uploads (`+uploadColumns+`)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9)`,
+		upload.ID, upload.SessionID, upload.Bucket, upload.ObjectName, upload.Filename,
+		upload.ContentType, upload.Size, upload.CreatedAt, upload.ExpiresAt,
+	)
+	return err
+}
+
+// Claim removes and returns an unexpired upload of the session in the given
+// bucket. Each upload can be claimed once; nil is returned when there is
+// nothing to claim.
+func (r *UploadRepository) Claim(ctx context.Context, id, sessionID, bucket string, now time.Time) (*models.Upload, error) {
+	rows, err := r.db.QueryContext(ctx, `
+		DELETE FROM uploads
+		WHERE id = $1 AND session_id = $2 AND bucket = $3 AND expires_at > $4
+		RETURNING `+uploadColumns, id, sessionID, bucket, now)
+	if err != nil {
+		return nil, err
+	}
+
+	uploads, err := scanUploads(rows)
+	if err != nil || len(uploads) == 0 {
+		return nil, err
+	}
+	return uploads[0], nil
+}
+
+// GetExpired returns up to limit uploads that expired unclaimed before now
+func (r *UploadRepository) GetExpired(ctx context.Context, now time.Time, limit int) ([]*models.Upload, error) {
+	rows, err := r.db.QueryContext(ctx, `
+		SELECT `+uploadColumns+`
+		FROM uploads WHERE expires_at <= $1
+		ORDER BY expires_at LIMIT $2`, now, limit)
+	if err != nil {
+		return nil, err
+	}
+
+	return scanUploads(rows)
+}
+
+func (r *UploadRepository) Delete(ctx context.Context, id string) error {
+	_, err := r.db.ExecContext(ctx, `DELETE FROM uploads WHERE id = $1`, id)
+	return err
+}
+
+func scanUploads(rows *sql.Rows) ([]*models.Upload, error) {
+	defer rows.Close()
+
+	var uploads []*models.Upload
+	for rows.Next() {
+		upload := &models.Upload{}
+		err := rows.Scan(
+			&upload.ID, &upload.SessionID, &upload.Bucket, &upload.ObjectName, &upload.Filename,
+			&upload.ContentType, &upload.Size, &upload.CreatedAt, &upload.ExpiresAt,
+		)
+		if err != nil {
+			return nil, err
+		}
+		uploads = append(uploads, upload)
+	}
+
+	return uploads, rows.Err()
+}
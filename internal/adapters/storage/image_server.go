@@ -0,0 +1,161 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/gorilla/mux"
+)
+
+// maxObjectKeyLength matches the S3 limit on object names
+const maxObjectKeyLength = 1024
+
+// UploadPrefix starts the names of objects clients upload themselves
+// through presigned URLs. They stay private until a post or comment claims
+// them and they are stored again under their own name.
+const UploadPrefix = "upload-"
+
+// HeldPrefix starts the names of the files of attachments held for review
+// because they matched a banned image. Only moderators see them, through
+// ServeHeld, until the attachment is approved and its files are copied to
+// their public names.
+const HeldPrefix = "held-"
+
+// heldCacheControl keeps held files out of shared caches
+const heldCacheControl = "private, no-store"
+
+var ErrObjectNotFound = errors.New("object not found")
+
+// ObjectInfo is the metadata needed to serve a stored object
+type ObjectInfo struct {
+	ContentType  string
+	ETag         string
+	LastModified time.Time
+}
+
+// ObjectOpener opens stored objects for streaming
+type ObjectOpener interface {
+	OpenObject(ctx context.Context, bucket, objectName string) (io.ReadSeekCloser, *ObjectInfo, error)
+}
+
+// ImageServer serves stored objects by bucket and key. Only the buckets it
+// was created with are reachable, keys must be a single plain path segment
+// and unclaimed uploads are never served. Held files are only served by
+// ServeHeld.
+type ImageServer struct {
+	objects ObjectOpener
+
+	// cacheControl maps each served bucket to its Cache-Control header and
+	// doubles as the bucket allowlist
+	cacheControl map[string]string
+}
+
+func NewImageServer(objects ObjectOpener, cacheControl map[string]string) *ImageServer {
+	return &ImageServer{
+		objects:      objects,
+		cacheControl: cacheControl,
+	}
+}
+
+// ServeObject serves /images/{bucket}/{key}
+func (s *ImageServer) ServeObject(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	s.servePublic(w, r, vars["bucket"], vars["key"])
+}
+
+// ServeHeld serves the held file /api/admin/images/{bucket}/{key} for
+// moderators to review. Any other object is not found.
+func (s *ImageServer) ServeHeld(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	bucket, key := vars["bucket"], vars["key"]
+
+	if _, ok := s.cacheControl[bucket]; !ok || !strings.HasPrefix(key, HeldPrefix) {
+		http.Error(w, "Image not found", http.StatusNotFound)
+		return
+	}
+	s.serve(w, r, bucket, key, heldCacheControl)
+}
+
+// ServeProxy serves /images/proxy?url=<stored MinIO URL> links handed out
+// before images had their own routes. The URL is only used to find the
+// bucket and key; both are checked exactly like on ServeObject.
+func (s *ImageServer) ServeProxy(w http.ResponseWriter, r *http.Request) {
+	imageURL := r.URL.Query().Get("url")
+	if imageURL == "" {
+		http.Error(w, "Missing image URL", http.StatusBadRequest)
+		return
+	}
+
+	bucket, key, ok := ParseMinioURL(imageURL)
+	if !ok {
+		http.Error(w, "Invalid image URL", http.StatusBadRequest)
+		return
+	}
+
+	s.servePublic(w, r, bucket, key)
+}
+
+// servePublic serves an object anyone may see
+func (s *ImageServer) servePublic(w http.ResponseWriter, r *http.Request, bucket, key string) {
+	// Unknown buckets, unclaimed uploads and held files look the same as
+	// missing images
+	cacheControl, ok := s.cacheControl[bucket]
+	if !ok || strings.HasPrefix(key, UploadPrefix) || strings.HasPrefix(key, HeldPrefix) {
+		http.Error(w, "Image not found", http.StatusNotFound)
+		return
+	}
+	s.serve(w, r, bucket, key, cacheControl)
+}
+
+// serve streams an object to the client. http.ServeContent answers Range
+// requests with 206 and If-None-Match or If-Modified-Since with 304,
+// reading only the requested bytes from storage.
+func (s *ImageServer) serve(w http.ResponseWriter, r *http.Request, bucket, key, cacheControl string) {
+	if !ValidObjectKey(key) {
+		http.Error(w, "Invalid image key", http.StatusBadRequest)
+		return
+	}
+
+	obj, info, err := s.objects.OpenObject(r.Context(), bucket, key)
+	if errors.Is(err, ErrObjectNotFound) {
+		http.Error(w, "Image not found", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		http.Error(w, "Failed to read image", http.StatusBadGateway)
+		return
+	}
+	defer obj.Close()
+
+	w.Header().Set("Content-Type", info.ContentType)
+	if info.ETag != "" {
+		w.Header().Set("ETag", `"`+strings.Trim(info.ETag, `"`)+`"`)
+	}
+	w.Header().Set("Cache-Control", cacheControl)
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+
+	http.ServeContent(w, r, key, info.LastModified, obj)
+}
+
+// ValidObjectKey reports whether key is safe to look up in a bucket: a
+// non-empty, single path segment of printable UTF-8 that is not a dot
+// segment, carries no separators and does not start with a dot
+func ValidObjectKey(key string) bool {
+	if key == "" || len(key) > maxObjectKeyLength || !utf8.ValidString(key) {
+		return false
+	}
+	if strings.HasPrefix(key, ".") || strings.ContainsAny(key, `/\`) {
+		return false
+	}
+	for _, c := range key {
+		if c < 0x20 || c == 0x7F {
+			return false
+		}
+	}
+	return true
+}
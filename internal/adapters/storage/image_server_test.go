@@ -0,0 +1,228 @@
+package storage
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gorilla/mux"
+)
+
+// fakeObjects serves objects from memory and records every lookup
+type fakeObjects struct {
+	objects map[string]string
+	opened  []string
+}
+
+type nopCloser struct {
+	*strings.Reader
+}
+
+func (nopCloser) Close() error { return nil }
+
+func (f *fakeObjects) OpenObject(ctx context.Context, bucket, objectName string) (io.ReadSeekCloser, *ObjectInfo, error) {
+	f.opened = append(f.opened, bucket+"/"+objectName)
+	data, ok := f.objects[bucket+"/"+objectName]
+	if !ok {
+		return nil, nil, ErrObjectNotFound
+	}
+	return nopCloser{strings.NewReader(data)}, &ObjectInfo{
+		ContentType:  "image/png",
+		ETag:         "abc123",
+		LastModified: time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC),
+	}, nil
+}
+
+func newTestRouter() (*mux.Router, *fakeObjects) {
+	objects := &fakeObjects{objects: map[string]string{
+		"posts/1-cat.png":      "0123456789",
+		"private/secret":       "top secret",
+		"comments/2-a b.png":   "comment",
+		"posts/upload-abc.png": "unclaimed",
+		"posts/held-abc.png":   "held",
+	}}
+	server := NewImageServer(objects, map[string]string{
+		"posts":    "public, max-age=31536000, immutable",
+		"comments": "public, max-age=31536000, immutable",
+	})
+
+	router := mux.NewRouter()
+	images := router.PathPrefix("/images").Subrouter()
+	images.HandleFunc("/proxy", server.ServeProxy).Methods("GET", "HEAD")
+	images.HandleFunc("/{bucket}/{key}", server.ServeObject).Methods("GET", "HEAD")
+	router.HandleFunc("/admin/images/{bucket}/{key}", server.ServeHeld).Methods("GET", "HEAD")
+	return router, objects
+}
+
+func serve(router http.Handler, target string, header http.Header) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(http.MethodGet, "http://backend"+target, nil)
+	for name, values := range header {
+		req.Header[name] = values
+	}
+	rec := httptest.NewRecorder()
+	router.ServeHTTP(rec, req)
+	return rec
+}
+
+func TestImageServerServesAllowedObjects(t *testing.T) {
+	router, _ := newTestRouter()
+
+	rec := serve(router, "/images/posts/1-cat.png", nil)
+	if rec.Code != http.StatusOK || rec.Body.String() != "0123456789" {
+		t.Fatalf("got %d %q, want 200 with the object", rec.Code, rec.Body.String())
+	}
+	if got := rec.Header().Get("ETag"); got != `"abc123"` {
+		t.Errorf("ETag = %q", got)
+	}
+
+	rec = serve(router, "/images/comments/"+url.PathEscape("2-a b.png"), nil)
+	if rec.Code != http.StatusOK || rec.Body.String() != "comment" {
+		t.Errorf("escaped key: got %d %q", rec.Code, rec.Body.String())
+	}
+
+	rec = serve(router, "/images/posts/1-cat.png", http.Header{"Range": {"bytes=2-4"}})
+	if rec.Code != http.StatusPartialContent || rec.Body.String() != "234" {
+		t.Errorf("range: got %d %q, want 206 %q", rec.Code, rec.Body.String(), "234")
+	}
+
+	rec = serve(router, "/images/posts/1-cat.png", http.Header{"If-None-Match": {`"abc123"`}})
+	if rec.Code != http.StatusNotModified {
+		t.Errorf("If-None-Match: got %d, want 304", rec.Code)
+	}
+
+	rec = serve(router, "/images/proxy?url="+url.QueryEscape("http://localhost:9000/posts/1-cat.png"), nil)
+	if rec.Code != http.StatusOK || rec.Body.String() != "0123456789" {
+		t.Errorf("proxy: got %d %q", rec.Code, rec.Body.String())
+	}
+}
+
+func TestImageServerRejectsForeignBuckets(t *testing.T) {
+	router, objects := newTestRouter()
+
+	for _, target := range []string{
+		"/images/private/secret",
+		"/images/avatars/1-avatar",
+		"/images/proxy?url=" + url.QueryEscape("http://localhost:9000/private/secret"),
+	} {
+		rec := serve(router, target, nil)
+		if rec.Code != http.StatusNotFound {
+			t.Errorf("%s: got %d, want 404", target, rec.Code)
+		}
+	}
+
+	for _, target := range []string{
+		"/images/proxy?url=" + url.QueryEscape("http://evil.example/posts/1-cat.png"),
+		"/images/proxy?url=" + url.QueryEscape("file:///etc/passwd"),
+		"/images/proxy",
+	} {
+		rec := serve(router, target, nil)
+		if rec.Code != http.StatusBadRequest {
+			t.Errorf("%s: got %d, want 400", target, rec.Code)
+		}
+	}
+
+	if len(objects.opened) != 0 {
+		t.Errorf("storage was queried for %v", objects.opened)
+	}
+}
+
+func TestImageServerHidesUploads(t *testing.T) {
+	router, objects := newTestRouter()
+
+	for _, target := range []string{
+		"/images/posts/upload-abc.png",
+		"/images/proxy?url=" + url.QueryEscape("http://localhost:9000/posts/upload-abc.png"),
+	} {
+		rec := serve(router, target, nil)
+		if rec.Code != http.StatusNotFound {
+			t.Errorf("%s: got %d, want 404", target, rec.Code)
+		}
+	}
+
+	if len(objects.opened) != 0 {
+		t.Errorf("storage was queried for %v", objects.opened)
+	}
+}
+
+func TestImageServerServesHeldFilesToModeratorsOnly(t *testing.T) {
+	router, _ := newTestRouter()
+
+	for _, target := range []string{
+		"/images/posts/held-abc.png",
+		"/images/proxy?url=" + url.QueryEscape("http://localhost:9000/posts/held-abc.png"),
+		"/admin/images/posts/1-cat.png",
+		"/admin/images/posts/upload-abc.png",
+		"/admin/images/private/secret",
+	} {
+		rec := serve(router, target, nil)
+		if rec.Code != http.StatusNotFound {
+			t.Errorf("%s: got %d, want 404", target, rec.Code)
+		}
+	}
+
+	rec := serve(router, "/admin/images/posts/held-abc.png", nil)
+	if rec.Code != http.StatusOK || rec.Body.String() != "held" {
+		t.Fatalf("got %d %q, want 200 with the held file", rec.Code, rec.Body.String())
+	}
+	if got := rec.Header().Get("Cache-Control"); got != heldCacheControl {
+		t.Errorf("Cache-Control = %q, want %q", got, heldCacheControl)
+	}
+}
+
+func TestImageServerRejectsTraversal(t *testing.T) {
+	router, objects := newTestRouter()
+
+	for _, target := range []string{
+		"/images/posts/..%2Fprivate%2Fsecret",
+		"/images/posts/%2e%2e",
+		"/images/posts/../private/secret",
+		"/images/posts/..%5Cprivate%5Csecret",
+		"/images/posts/.hidden",
+		"/images/posts/a%00b",
+		"/images/proxy?url=" + url.QueryEscape("http://localhost:9000/posts/../private/secret"),
+		"/images/proxy?url=" + url.QueryEscape("http://localhost:9000/posts/sub/1-cat.png"),
+		"/images/proxy?url=" + url.QueryEscape(`http://localhost:9000/posts/..\private\secret`),
+	} {
+		rec := serve(router, target, nil)
+		if rec.Code == http.StatusOK || strings.Contains(rec.Body.String(), "top secret") {
+			t.Errorf("%s: got %d %q, want it rejected", target, rec.Code, rec.Body.String())
+		}
+	}
+
+	if len(objects.opened) != 0 {
+		t.Errorf("storage was queried for %v", objects.opened)
+	}
+}
+
+func TestValidObjectKey(t *testing.T) {
+	tests := []struct {
+		key  string
+		want bool
+	}{
+		{"1700000000-cat.png", true},
+		{"import-abcdef.webm", true},
+		{"ünïcode name.jpg", true},
+		{"", false},
+		{".", false},
+		{"..", false},
+		{".hidden", false},
+		{"../secret", false},
+		{"a/b", false},
+		{`a\b`, false},
+		{"a\x00b", false},
+		{"a\nb", false},
+		{"\xff\xfe", false},
+		{strings.Repeat("a", maxObjectKeyLength+1), false},
+	}
+
+	for _, tt := range tests {
+		if got := ValidObjectKey(tt.key); got != tt.want {
+			t.Errorf("ValidObjectKey(%q) = %v, want %v", tt.key, got, tt.want)
+		}
+	}
+}
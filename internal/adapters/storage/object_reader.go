@@ -0,0 +1,72 @@
+package storage
+
+import (
+	"errors"
+	"fmt"
+	"io"
+
+	"github.com/minio/minio-go/v7"
+)
+
+// objectWindow is how much of an object ObjectReader fetches at a time
+const objectWindow = 1 << 20
+
+// ObjectReader reads a stored object in place. Reads are served from a
+// window of the object fetched ahead of them, so walking the structure of a
+// file costs one ranged request per window rather than one per read, and
+// no more than a window is held in memory.
+type ObjectReader struct {
+	obj    *minio.Object
+	size   int64
+	window []byte
+	offset int64
+}
+
+// Size returns the size of the object
+func (r *ObjectReader) Size() int64 {
+	return r.size
+}
+
+// ReadAt implements io.ReaderAt
+func (r *ObjectReader) ReadAt(p []byte, off int64) (int, error) {
+	if off < 0 {
+		return 0, errors.New("negative offset")
+	}
+
+	n := 0
+	for n < len(p) {
+		if off >= r.size {
+			return n, io.EOF
+		}
+		if off < r.offset || off >= r.offset+int64(len(r.window)) {
+			if err := r.fill(off); err != nil {
+				return n, err
+			}
+		}
+		copied := copy(p[n:], r.window[off-r.offset:])
+		n += copied
+		off += int64(copied)
+	}
+	return n, nil
+}
+
+// fill fetches the window starting at off
+func (r *ObjectReader) fill(off int64) error {
+	if r.window == nil {
+		r.window = make([]byte, objectWindow)
+	}
+	read, err := r.obj.ReadAt(r.window[:min(objectWindow, r.size-off)], off)
+	r.window, r.offset = r.window[:read], off
+	if read == 0 {
+		if err == nil || err == io.EOF {
+			return io.ErrUnexpectedEOF
+		}
+		return fmt.Errorf("failed to read object: %w", err)
+	}
+	return nil
+}
+
+// Close releases the connection to the object
+func (r *ObjectReader) Close() error {
+	return r.obj.Close()
+}
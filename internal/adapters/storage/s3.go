@@ -3,9 +3,14 @@ package storage
 import (
 	"bytes"
 	"context"
+	"crypto/sha256"
+	"encoding/hex"
 	"fmt"
-	"mime/multipart"
+	"io"
 	"net/http"
+	"net/url"
+	"path"
+	"strconv"
 	"strings"
 	"time"
 
@@ -49,7 +54,8 @@ func NewMinioClient(endpoint, accessKey, secretKey string, useSSL bool) (*MinioC
 		}
 	}
 
-	// Makes buckets public
+	// Makes buckets public, except for uploads that were not claimed yet
+	// and files held for review
 	for _, bucket := range buckets {
 		policy := fmt.Sprintf(`{
 			"Version": "2012-10-17",
@@ -58,10 +64,19 @@ func NewMinioClient(endpoint, accessKey, secretKey string, useSSL bool) (*MinioC
 					"Effect": "Allow",
 					"Principal": "*",
 					"Action": "s3:GetObject",
-					"Resource": "arn:aws:s3:::%s/*"
+					"Resource": "arn:aws:s3:::%[1]s/*"
+				},
+				{
+					"Effect": "Deny",
+					"Principal": "*",
+					"Action": "s3:GetObject",
+					"Resource": [
+						"arn:aws:s3:::%[1]s/%[2]s*",
+						"arn:aws:s3:::%[1]s/%[3]s*"
+					]
 				}
 			]
-		}`, bucket)
+		}`, bucket, UploadPrefix, HeldPrefix)
 
 		err := client.SetBucketPolicy(context.Background(), bucket, policy)
 		if err != nil {
@@ -100,49 +115,40 @@ func (m *MinioClient) UploadAvatarFromURL(ctx context.Context, imageUrl string)
 	return fmt.Sprintf("http://localhost:9000/%s/%s", m.avatarBucket, objectName), nil
 }
 
-// UploadPostImage uploads a post image from multipart.File
-func (m *MinioClient) UploadPostImage(ctx context.Context, file multipart.File, filename, contentType string) (string, error) {
-	objectName := fmt.Sprintf("%d-%s", time.Now().UnixNano(), filename)
-
-	_, err := m.client.PutObject(ctx, m.postBucket, objectName, file, -1, minio.PutObjectOptions{
-		ContentType: contentType,
-	})
-	if err != nil {
-		return "", fmt.Errorf("failed to upload post image: %w", err)
-	}
-
-	// Return the MinIO URL for the stored image
-	return fmt.Sprintf("http://localhost:9000/%s/%s", m.postBucket, objectName), nil
+// contentExts maps the content types boards accept to the extension of
+// their objects
+var contentExts = map[string]string{
+	"image/jpeg":       ".jpg",
+	"image/png":        ".png",
+	"image/gif":        ".gif",
+	"video/webm":       ".webm",
+	"video/x-matroska": ".mkv",
+	"video/mp4":        ".mp4",
+	"video/quicktime":  ".mov",
 }
 
-// UploadCommentImage uploads a comment image from multipart.File
-func (m *MinioClient) UploadCommentImage(ctx context.Context, file multipart.File, filename, contentType string) (string, error) {
-	objectName := fmt.Sprintf("%d-%s", time.Now().UnixNano(), filename)
-
-	_, err := m.client.PutObject(ctx, m.commentBucket, objectName, file, -1, minio.PutObjectOptions{
-		ContentType: contentType,
-	})
-	if err != nil {
-		return "", fmt.Errorf("failed to upload comment image: %w", err)
-	}
-
-	// Return the MinIO URL for the stored image
-	return fmt.Sprintf("http://localhost:9000/%s/%s", m.commentBucket, objectName), nil
+// ContentObjectName names an object after the SHA-256 of its content, so
+// identical files map to the same object whatever they were uploaded as
+func ContentObjectName(data []byte, contentType string) string {
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:]) + contentExts[contentType]
 }
 
-// UploadCommentImageBytes uploads a comment image from bytes
-func (m *MinioClient) UploadCommentImageBytes(ctx context.Context, fileBytes []byte, filename, contentType string) (string, error) {
-	objectName := fmt.Sprintf("%d-%s", time.Now().UnixNano(), filename)
-
-	_, err := m.client.PutObject(ctx, m.commentBucket, objectName, bytes.NewReader(fileBytes), int64(len(fileBytes)), minio.PutObjectOptions{
-		ContentType: contentType,
-	})
+// HashObjectName returns the name ContentObjectName gives the content of a
+// stored object, streaming the object through the hash rather than loading
+// it
+func (m *MinioClient) HashObjectName(ctx context.Context, bucket, objectName, contentType string) (string, error) {
+	obj, err := m.client.GetObject(ctx, bucket, objectName, minio.GetObjectOptions{})
 	if err != nil {
-		return "", fmt.Errorf("failed to upload comment image: %w", err)
+		return "", fmt.Errorf("failed to get object: %w", err)
 	}
+	defer obj.Close()
 
-	// Return the MinIO URL for the stored image
-	return fmt.Sprintf("http://localhost:9000/%s/%s", m.commentBucket, objectName), nil
+	hash := sha256.New()
+	if _, err := io.Copy(hash, obj); err != nil {
+		return "", fmt.Errorf("failed to read object data: %w", err)
+	}
+	return hex.EncodeToString(hash.Sum(nil)) + contentExts[contentType], nil
 }
 
 // GetImage retrieves an image from any bucket
@@ -166,96 +172,87 @@ func (m *MinioClient) GetImage(ctx context.Context, bucket, objectName string) (
 	return buf.Bytes(), stat.ContentType, nil
 }
 
-// ServeAvatarImageHandler serves avatar images from the avatars bucket
-func (m *MinioClient) ServeAvatarImageHandler() http.HandlerFunc {
-	return func(w http.ResponseWriter, r *http.Request) {
-		filename := r.PathValue("filename")
-		data, contentType, err := m.GetImage(r.Context(), m.avatarBucket, filename)
-		if err != nil {
-			http.Error(w, "Avatar image not found", http.StatusNotFound)
-			return
-		}
-
-		w.Header().Set("Content-Type", contentType)
-		w.Header().Set("Cache-Control", "public, max-age=31536000") // Cache for 1 year
-		w.WriteHeader(http.StatusOK)
-		w.Write(data)
+// OpenObject opens an object for streaming. The returned reader fetches
+// only the ranges that are read from it.
+func (m *MinioClient) OpenObject(ctx context.Context, bucket, objectName string) (io.ReadSeekCloser, *ObjectInfo, error) {
+	obj, err := m.client.GetObject(ctx, bucket, objectName, minio.GetObjectOptions{})
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to get object: %w", err)
 	}
-}
 
-// ServePostImageHandler serves post images from the posts bucket
-func (m *MinioClient) ServePostImageHandler() http.HandlerFunc {
-	return func(w http.ResponseWriter, r *http.Request) {
-		filename := r.PathValue("filename")
-		data, contentType, err := m.GetImage(r.Context(), m.postBucket, filename)
-		if err != nil {
-			http.Error(w, "Post image not found", http.StatusNotFound)
-			return
+	stat, err := obj.Stat()
+	if err != nil {
+		obj.Close()
+		if minio.ToErrorResponse(err).Code == "NoSuchKey" {
+			return nil, nil, ErrObjectNotFound
 		}
-
-		w.Header().Set("Content-Type", contentType)
-		w.Header().Set("Cache-Control", "public, max-age=31536000") // Cache for 1 year
-		w.WriteHeader(http.StatusOK)
-		w.Write(data)
+		return nil, nil, fmt.Errorf("failed to stat object: %w", err)
 	}
-}
 
-// ServeImageFromURL serves any image from a MinIO URL
-func (m *MinioClient) ServeImageFromURL() http.HandlerFunc {
-	return func(w http.ResponseWriter, r *http.Request) {
-		// Get the MinIO URL from query parameter
-		imageURL := r.URL.Query().Get("url")
-		if imageURL == "" {
-			http.Error(w, "Missing image URL", http.StatusBadRequest)
-			return
-		}
+	return obj, &ObjectInfo{
+		ContentType:  stat.ContentType,
+		ETag:         stat.ETag,
+		LastModified: stat.LastModified,
+	}, nil
+}
 
-		// Extract bucket and filename from MinIO URL
-		// Format: http://localhost:9000/bucket/filename
-		if !strings.HasPrefix(imageURL, "http://localhost:9000/") {
-			http.Error(w, "Invalid MinIO URL", http.StatusBadRequest)
-			return
-		}
+// ReadObject opens an object for reading in place, or returns
+// ErrObjectNotFound when there is none
+func (m *MinioClient) ReadObject(ctx context.Context, bucket, objectName string) (*ObjectReader, error) {
+	obj, err := m.client.GetObject(ctx, bucket, objectName, minio.GetObjectOptions{})
+	if err != nil {
+		return nil, fmt.Errorf("failed to get object: %w", err)
+	}
 
-		path := strings.TrimPrefix(imageURL, "http://localhost:9000/")
-		parts := strings.SplitN(path, "/", 2)
-		if len(parts) != 2 {
-			http.Error(w, "Invalid URL format", http.StatusBadRequest)
-			return
+	stat, err := obj.Stat()
+	if err != nil {
+		obj.Close()
+		if minio.ToErrorResponse(err).Code == "NoSuchKey" {
+			return nil, ErrObjectNotFound
 		}
+		return nil, fmt.Errorf("failed to stat object: %w", err)
+	}
 
-		bucket := parts[0]
-		filename := parts[1]
+	return &ObjectReader{obj: obj, size: stat.Size}, nil
+}
 
-		// Get image from MinIO
-		data, contentType, err := m.GetImage(r.Context(), bucket, filename)
-		if err != nil {
-			http.Error(w, "Image not found", http.StatusNotFound)
-			return
-		}
+// PresignUpload returns a URL through which a client can PUT one object
+// into bucket until expiry. Content-Type and Content-Length are signed, so
+// the request must carry exactly the given type and size.
+func (m *MinioClient) PresignUpload(ctx context.Context, bucket, objectName, contentType string, size int64, expiry time.Duration) (string, error) {
+	headers := http.Header{}
+	headers.Set("Content-Type", contentType)
+	headers.Set("Content-Length", strconv.FormatInt(size, 10))
 
-		w.Header().Set("Content-Type", contentType)
-		w.Header().Set("Cache-Control", "public, max-age=31536000") // Cache for 1 year
-		w.WriteHeader(http.StatusOK)
-		w.Write(data)
+	u, err := m.client.PresignHeader(ctx, http.MethodPut, bucket, objectName, expiry, nil, headers)
+	if err != nil {
+		return "", fmt.Errorf("failed to presign upload: %w", err)
 	}
+	return u.String(), nil
 }
 
-// ServeCommentImageHandler serves comment images from the comments bucket
-func (m *MinioClient) ServeCommentImageHandler() http.HandlerFunc {
-	return func(w http.ResponseWriter, r *http.Request) {
-		filename := r.PathValue("filename")
-		data, contentType, err := m.GetImage(r.Context(), m.commentBucket, filename)
-		if err != nil {
-			http.Error(w, "Comment image not found", http.StatusNotFound)
-			return
+// StatObject returns the size and content type of a stored object, or
+// ErrObjectNotFound when there is none
+func (m *MinioClient) StatObject(ctx context.Context, bucket, objectName string) (int64, string, error) {
+	stat, err := m.client.StatObject(ctx, bucket, objectName, minio.StatObjectOptions{})
+	if err != nil {
+		if minio.ToErrorResponse(err).Code == "NoSuchKey" {
+			return 0, "", ErrObjectNotFound
 		}
-
-		w.Header().Set("Content-Type", contentType)
-		w.Header().Set("Cache-Control", "public, max-age=31536000") // Cache for 1 year
-		w.WriteHeader(http.StatusOK)
-		w.Write(data)
+		return 0, "", fmt.Errorf("failed to stat object: %w", err)
 	}
+	return stat.Size, stat.ContentType, nil
+}
+
+// ImageServer returns an ImageServer for the client's buckets. Avatars are
+// revalidated on every use since character images are replaced in place;
+// other objects never change once written.
+func (m *MinioClient) ImageServer() *ImageServer {
+	return NewImageServer(m, map[string]string{
+		m.avatarBucket:  "public, no-cache",
+		m.postBucket:    "public, max-age=31536000, immutable",
+		m.commentBucket: "public, max-age=31536000, immutable",
+	})
 }
 
 // UploadCharacterImageFromURL downloads a character image from a URL and stores it in the avatars bucket
@@ -292,11 +289,147 @@ func (m *MinioClient) UploadCharacterImageFromURL(ctx context.Context, imageUrl
 	return fmt.Sprintf("http://localhost:9000/%s/%s", m.avatarBucket, objectName), nil
 }
 
+// PutImageIfMissing stores data under objectName unless the bucket already
+// holds an object with that name, so repeated uploads of the same content
+// are no-ops. It returns the MinIO URL of the object either way.
+func (m *MinioClient) PutImageIfMissing(ctx context.Context, bucket, objectName string, data []byte, contentType string) (string, error) {
+	imageURL := fmt.Sprintf("http://localhost:9000/%s/%s", bucket, objectName)
+
+	_, err := m.client.StatObject(ctx, bucket, objectName, minio.StatObjectOptions{})
+	if err == nil {
+		return imageURL, nil
+	}
+	if minio.ToErrorResponse(err).Code != "NoSuchKey" {
+		return "", fmt.Errorf("failed to stat object: %w", err)
+	}
+
+	_, err = m.client.PutObject(ctx, bucket, objectName, bytes.NewReader(data), int64(len(data)), minio.PutObjectOptions{
+		ContentType: contentType,
+	})
+	if err != nil {
+		return "", fmt.Errorf("failed to upload to minio: %w", err)
+	}
+
+	return imageURL, nil
+}
+
+// CopyImageIfMissing copies the object srcName to objectName within bucket
+// unless the bucket already holds an object with that name, like
+// PutImageIfMissing. The copy is made by the server, so the data never
+// passes through the client. It returns the MinIO URL of the object either
+// way.
+func (m *MinioClient) CopyImageIfMissing(ctx context.Context, bucket, srcName, objectName, contentType string) (string, error) {
+	imageURL := ObjectURL(bucket, objectName)
+
+	_, err := m.client.StatObject(ctx, bucket, objectName, minio.StatObjectOptions{})
+	if err == nil {
+		return imageURL, nil
+	}
+	if minio.ToErrorResponse(err).Code != "NoSuchKey" {
+		return "", fmt.Errorf("failed to stat object: %w", err)
+	}
+
+	// The content type is replaced with the probed one, which can differ
+	// from the type the client uploaded the file as
+	_, err = m.client.CopyObject(ctx, minio.CopyDestOptions{
+		Bucket:          bucket,
+		Object:          objectName,
+		ContentType:     contentType,
+		ReplaceMetadata: true,
+	}, minio.CopySrcOptions{
+		Bucket: bucket,
+		Object: srcName,
+	})
+	if err != nil {
+		return "", fmt.Errorf("failed to copy object: %w", err)
+	}
+
+	return imageURL, nil
+}
+
+// PutImage stores data under objectName, replacing any existing object
+func (m *MinioClient) PutImage(ctx context.Context, bucket, objectName string, data []byte, contentType string) error {
+	_, err := m.client.PutObject(ctx, bucket, objectName, bytes.NewReader(data), int64(len(data)), minio.PutObjectOptions{
+		ContentType: contentType,
+	})
+	if err != nil {
+		return fmt.Errorf("failed to upload to minio: %w", err)
+	}
+	return nil
+}
+
+// ListObjects returns the names of every object in a bucket
+func (m *MinioClient) ListObjects(ctx context.Context, bucket string) ([]string, error) {
+	var names []string
+	for object := range m.client.ListObjects(ctx, bucket, minio.ListObjectsOptions{Recursive: true}) {
+		if object.Err != nil {
+			return nil, fmt.Errorf("failed to list bucket %s: %w", bucket, object.Err)
+		}
+		names = append(names, object.Key)
+	}
+	return names, nil
+}
+
+// Buckets returns the names of the buckets the client manages
+func (m *MinioClient) Buckets() []string {
+	return []string{m.avatarBucket, m.postBucket, m.commentBucket}
+}
+
+// IsKnownBucket reports whether bucket is one of the buckets the client manages
+func (m *MinioClient) IsKnownBucket(bucket string) bool {
+	return bucket == m.avatarBucket || bucket == m.postBucket || bucket == m.commentBucket
+}
+
 // DeleteImage deletes an image from any bucket
 func (m *MinioClient) DeleteImage(ctx context.Context, bucket, objectName string) error {
 	return m.client.RemoveObject(ctx, bucket, objectName, minio.RemoveObjectOptions{})
 }
 
+// DeleteImageByURL deletes the object behind a stored MinIO URL. URLs that
+// do not point at MinIO are ignored.
+func (m *MinioClient) DeleteImageByURL(ctx context.Context, imageURL string) error {
+	bucket, objectName, ok := ParseMinioURL(imageURL)
+	if !ok {
+		return nil
+	}
+
+	return m.DeleteImage(ctx, bucket, objectName)
+}
+
+// ObjectURL returns the stored MinIO URL of an object
+func ObjectURL(bucket, objectName string) string {
+	return fmt.Sprintf("http://localhost:9000/%s/%s", bucket, objectName)
+}
+
+// ParseMinioURL splits a stored MinIO URL into its bucket and object name
+func ParseMinioURL(imageURL string) (bucket, objectName string, ok bool) {
+	if !strings.HasPrefix(imageURL, "http://localhost:9000/") {
+		return "", "", false
+	}
+
+	parts := strings.SplitN(strings.TrimPrefix(imageURL, "http://localhost:9000/"), "/", 2)
+	if len(parts) != 2 || parts[0] == "" || parts[1] == "" {
+		return "", "", false
+	}
+
+	return parts[0], parts[1], true
+}
+
+// ObjectExt returns the lowercase extension of an object name, or "" when
+// it is not a short alphanumeric extension safe to reuse in a file name
+func ObjectExt(objectName string) string {
+	ext := strings.ToLower(path.Ext(objectName))
+	if len(ext) < 2 || len(ext) > 6 {
+		return ""
+	}
+	for _, c := range ext[1:] {
+		if (c < 'a' || c > 'z') && (c < '0' || c > '9') {
+			return ""
+		}
+	}
+	return ext
+}
+
 // GetBucketName returns the bucket name for a given type
 func (m *MinioClient) GetBucketName(imageType string) string {
 	switch imageType {
@@ -311,12 +444,23 @@ func (m *MinioClient) GetBucketName(imageType string) string {
 	}
 }
 
-// ConvertMinioURLToProxyURL converts a MinIO URL to use the backend proxy
+// ConvertMinioURLToAdminURL converts the MinIO URL of a held file to the
+// admin route moderators review it through
+func ConvertMinioURLToAdminURL(minioURL string) string {
+	bucket, objectName, ok := ParseMinioURL(minioURL)
+	if !ok || !strings.HasPrefix(objectName, HeldPrefix) {
+		return ConvertMinioURLToProxyURL(minioURL)
+	}
+	return fmt.Sprintf("http://localhost:8080/api/admin/images/%s/%s", url.PathEscape(bucket), url.PathEscape(objectName))
+}
+
+// ConvertMinioURLToProxyURL converts a MinIO URL to the backend's image route
 func ConvertMinioURLToProxyURL(minioURL string) string {
 	// Convert: http://localhost:9000/bucket/filename
-	// To:      http://localhost:8080/images/proxy?url=http://localhost:9000/bucket/filename
-	if strings.HasPrefix(minioURL, "http://localhost:9000/") {
-		return fmt.Sprintf("http://localhost:8080/images/proxy?url=%s", minioURL)
+	// To:      http://localhost:8080/images/bucket/filename
+	bucket, objectName, ok := ParseMinioURL(minioURL)
+	if !ok {
+		return minioURL // Return original if not a MinIO URL
 	}
-	return minioURL // Return original if not a MinIO URL
+	return fmt.Sprintf("http://localhost:8080/images/%s/%s", url.PathEscape(bucket), url.PathEscape(objectName))
 }
@@ -2,25 +2,47 @@ package app
 
 import (
 	"1337b04rd/config"
+	"1337b04rd/internal/adapters/events"
 	"1337b04rd/internal/adapters/externalapi"
 	"1337b04rd/internal/adapters/handler"
 	"1337b04rd/internal/adapters/repository"
 	"1337b04rd/internal/adapters/storage"
 	"1337b04rd/internal/service"
+	"1337b04rd/pkg/iphash"
 	"1337b04rd/pkg/postgres"
+	"1337b04rd/pkg/tripcode"
+	"context"
 	"database/sql"
 )
 
 type App struct {
-	DB               *sql.DB
-	Storage          *storage.MinioClient
-	PostService      *service.PostService
-	CommentService   *service.CommentService
-	SessionService   *service.SessionService
-	PostHandler      *handler.PostHandler
-	CommentHandler   *handler.CommentHandler
-	SessionHandler   *handler.SessionHandler
-	CharacterHandler *handler.CharacterHandler
+	DB                *sql.DB
+	Storage           *storage.MinioClient
+	ImageServer       *storage.ImageServer
+	Events            *events.Broker
+	PostService       *service.PostService
+	CommentService    *service.CommentService
+	SessionService    *service.SessionService
+	TransferService   *service.TransferService
+	ReactionService   *service.ReactionService
+	PollService       *service.PollService
+	UploadService     *service.UploadService
+	ImageBanService   *service.ImageBanService
+	FilterService     *service.FilterService
+	QuarantineService *service.QuarantineService
+	PostHandler       *handler.PostHandler
+	CommentHandler    *handler.CommentHandler
+	SessionHandler    *handler.SessionHandler
+	CharacterHandler  *handler.CharacterHandler
+	AdminHandler      *handler.AdminHandler
+	EventHandler      *handler.EventHandler
+	TransferHandler   *handler.TransferHandler
+	ReactionHandler   *handler.ReactionHandler
+	PollHandler       *handler.PollHandler
+	UploadHandler     *handler.UploadHandler
+	ImageBanHandler   *handler.ImageBanHandler
+	FilterHandler     *handler.FilterHandler
+	QuarantineHandler *handler.QuarantineHandler
 }
 
 func NewApp(cfg *config.Config) (*App, error) {
@@ -44,32 +66,95 @@ func NewApp(cfg *config.Config) (*App, error) {
 	// Initialize Rick and Morty client
 	rickAndMortyClient := externalapi.NewRickAndMortyClient()
 
+	// Initialize tripcode generator
+	tripcodes, err := tripcode.NewGenerator(cfg.Tripcode.Secret)
+	if err != nil {
+		return nil, err
+	}
+
+	// Initialize address hasher
+	ips, err := iphash.NewHasher(cfg.IPHash.Secret, cfg.IPHash.TrustProxy)
+	if err != nil {
+		return nil, err
+	}
+
+	// Initialize live event broker
+	eventBroker := events.NewBroker()
+
 	// Initialize repositories
 	postRepo := repository.NewPostRepository(db)
 	commentRepo := repository.NewCommentRepository(db)
+	referenceRepo := repository.NewCommentReferenceRepository(db)
 	sessionRepo := repository.NewSessionRepository(db)
+	boardRepo := repository.NewBoardRepository(db)
+	reactionRepo := repository.NewReactionRepository(db)
+	pollRepo := repository.NewPollRepository(db)
+	attachmentRepo := repository.NewAttachmentRepository(db)
+	uploadRepo := repository.NewUploadRepository(db)
+	objectRepo := repository.NewObjectRepository(db)
+	imageBanRepo := repository.NewImageBanRepository(db)
+	filterRepo := repository.NewFilterRuleRepository(db)
+	quarantineRepo := repository.NewQuarantineRepository(db)
+	unitOfWork := repository.NewUnitOfWork(db)
 
 	// Initialize services
-	postService := service.NewPostService(postRepo, commentRepo, storageClient)
-	commentService := service.NewCommentService(commentRepo, storageClient)
-	sessionService := service.NewSessionService(sessionRepo, storageClient)
+	filterService := service.NewFilterService(filterRepo, boardRepo, postRepo, commentRepo, cfg.Filter.Budget)
+	if err := filterService.ReloadRules(context.Background()); err != nil {
+		return nil, err
+	}
+	postService := service.NewPostService(unitOfWork, postRepo, commentRepo, referenceRepo, boardRepo, pollRepo, attachmentRepo, objectRepo, imageBanRepo, quarantineRepo, filterService, storageClient, cfg.Media.VideoTypes, eventBroker, cfg.Edit.Window)
+	commentService := service.NewCommentService(unitOfWork, commentRepo, postRepo, referenceRepo, boardRepo, attachmentRepo, objectRepo, imageBanRepo, quarantineRepo, filterService, storageClient, cfg.Media.VideoTypes, cfg.Edit.Window)
+	sessionService := service.NewSessionService(unitOfWork, sessionRepo, storageClient)
+	pollService := service.NewPollService(pollRepo, postRepo)
+	reactionService := service.NewReactionService(reactionRepo, postRepo, commentRepo, boardRepo, eventBroker)
+	uploadService := service.NewUploadService(uploadRepo, boardRepo, storageClient, cfg.Media.VideoTypes, cfg.Media.UploadExpiry)
+	imageBanService := service.NewImageBanService(imageBanRepo, attachmentRepo, boardRepo, objectRepo, storageClient)
+	quarantineService := service.NewQuarantineService(quarantineRepo, postRepo, commentRepo)
+	transferService := service.NewTransferService(unitOfWork, postRepo, commentRepo, referenceRepo, boardRepo, attachmentRepo, objectRepo, storageClient, eventBroker)
 
 	// Initialize handlers
-	postHandler := handler.NewPostHandler(postService)
-	commentHandler := handler.NewCommentHandler(commentService)
+	postHandler := handler.NewPostHandler(postService, reactionService, pollService, tripcodes, ips)
+	commentHandler := handler.NewCommentHandler(commentService, reactionService, tripcodes, ips)
 	sessionHandler := handler.NewSessionHandler(sessionService)
 	characterHandler := handler.NewCharacterHandler(rickAndMortyClient)
+	adminHandler := handler.NewAdminHandler(postService)
+	eventHandler := handler.NewEventHandler(eventBroker)
+	transferHandler := handler.NewTransferHandler(transferService)
+	reactionHandler := handler.NewReactionHandler(reactionService)
+	pollHandler := handler.NewPollHandler(pollService)
+	uploadHandler := handler.NewUploadHandler(uploadService)
+	imageBanHandler := handler.NewImageBanHandler(imageBanService)
+	filterHandler := handler.NewFilterHandler(filterService)
+	quarantineHandler := handler.NewQuarantineHandler(quarantineService, postService, commentService)
 
 	return &App{
-		DB:               db,
-		Storage:          storageClient,
-		PostService:      postService,
-		CommentService:   commentService,
-		SessionService:   sessionService,
-		PostHandler:      postHandler,
-		CommentHandler:   commentHandler,
-		SessionHandler:   sessionHandler,
-		CharacterHandler: characterHandler,
+		DB:                db,
+		Storage:           storageClient,
+		ImageServer:       storageClient.ImageServer(),
+		Events:            eventBroker,
+		PostService:       postService,
+		CommentService:    commentService,
+		SessionService:    sessionService,
+		TransferService:   transferService,
+		ReactionService:   reactionService,
+		PollService:       pollService,
+		UploadService:     uploadService,
+		ImageBanService:   imageBanService,
+		FilterService:     filterService,
+		QuarantineService: quarantineService,
+		PostHandler:       postHandler,
+		CommentHandler:    commentHandler,
+		SessionHandler:    sessionHandler,
+		CharacterHandler:  characterHandler,
+		AdminHandler:      adminHandler,
+		EventHandler:      eventHandler,
+		TransferHandler:   transferHandler,
+		ReactionHandler:   reactionHandler,
+		PollHandler:       pollHandler,
+		UploadHandler:     uploadHandler,
+		ImageBanHandler:   imageBanHandler,
+		FilterHandler:     filterHandler,
+		QuarantineHandler: quarantineHandler,
 	}, nil
 }
 
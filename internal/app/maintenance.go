@@ -0,0 +1,60 @@
+package app
+
+import (
+	"context"
+	"log"
+	"time"
+)
+
+// RunMaintenance periodically archives expired threads, collects unclaimed
+// uploads, reloads the filter rules and purges archived threads older than
+// retention (zero disables purging) until ctx is done.
+func (a *App) RunMaintenance(ctx context.Context, interval, retention time.Duration) {
+	if interval <= 0 {
+		log.Printf("Maintenance disabled: interval is %s", interval)
+		return
+	}
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		a.runMaintenance(ctx, retention)
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+func (a *App) runMaintenance(ctx context.Context, retention time.Duration) {
+	archived, err := a.PostService.ArchiveExpiredPosts(ctx)
+	if err != nil {
+		log.Printf("Maintenance: failed to archive expired posts: %v", err)
+	} else if archived > 0 {
+		log.Printf("Maintenance: archived %d expired posts", archived)
+	}
+
+	collected, err := a.UploadService.CollectExpiredUploads(ctx)
+	if err != nil {
+		log.Printf("Maintenance: failed to collect expired uploads: %v", err)
+	} else if collected > 0 {
+		log.Printf("Maintenance: collected %d expired uploads", collected)
+	}
+
+	// Picks up rule changes made by other instances
+	if err := a.FilterService.ReloadRules(ctx); err != nil {
+		log.Printf("Maintenance: failed to reload filter rules: %v", err)
+	}
+
+	if retention > 0 {
+		purged, err := a.PostService.PurgeArchivedPosts(ctx, time.Now().Add(-retention))
+		if err != nil {
+			log.Printf("Maintenance: failed to purge archived posts: %v", err)
+		} else if purged > 0 {
+			log.Printf("Maintenance: purged %d archived posts past retention", purged)
+		}
+	}
+}
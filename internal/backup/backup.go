@@ -0,0 +1,458 @@
+package backup
+
+import (
+	"1337b04rd/internal/adapters/storage"
+	"archive/zip"
+	"bufio"
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"time"
+)
+
+// FormatVersion is the current version of the backup archive format
+const FormatVersion = 1
+
+// manifestName is the manifest file at the root of a backup archive
+const manifestName = "manifest.json"
+
+var (
+	ErrInvalidBackup      = errors.New("invalid backup")
+	ErrDeploymentNotEmpty = errors.New("deployment is not empty")
+)
+
+// table describes a table included in backups. Tables are listed in
+// restore order, so every table comes after the tables it references.
+type table struct {
+	name    string
+	orderBy string
+	serial  bool
+}
+
+var tables = []table{
+	{name: "boards", orderBy: "slug"},
+	{name: "sessions", orderBy: "id"},
+	{name: "posts", orderBy: "id", serial: true},
+	{name: "comments", orderBy: "id", serial: true},
+	{name: "comment_references", orderBy: "id", serial: true},
+	{name: "reactions", orderBy: "id", serial: true},
+	{name: "polls", orderBy: "id", serial: true},
+	{name: "poll_options", orderBy: "id", serial: true},
+	{name: "poll_votes", orderBy: "id", serial: true},
+	{name: "attachments", orderBy: "id", serial: true},
+	{name: "uploads", orderBy: "id"},
+	{name: "stored_objects", orderBy: "bucket, object_name"},
+	{name: "image_bans", orderBy: "id", serial: true},
+	{name: "filter_rules", orderBy: "id", serial: true},
+	{name: "quarantines", orderBy: "id", serial: true},
+	{name: "post_revisions", orderBy: "id", serial: true},
+	{name: "comment_revisions", orderBy: "id", serial: true},
+}
+
+// Manifest lists the contents of a backup archive with their checksums
+type Manifest struct {
+	Version   int            `json:"version"`
+	CreatedAt time.Time      `json:"created_at"`
+	Tables    []*TableEntry  `json:"tables"`
+	Objects   []*ObjectEntry `json:"objects"`
+}
+
+// TableEntry is a table snapshot stored as one JSON row per line
+type TableEntry struct {
+	Name   string `json:"name"`
+	Path   string `json:"path"`
+	Rows   int    `json:"rows"`
+	SHA256 string `json:"sha256"`
+}
+
+// ObjectEntry is an object copied from one of the storage buckets
+type ObjectEntry struct {
+	Bucket      string `json:"bucket"`
+	Name        string `json:"name"`
+	Path        string `json:"path"`
+	ContentType string `json:"content_type"`
+	Size        int64  `json:"size"`
+	SHA256      string `json:"sha256"`
+}
+
+// Archiver writes and restores full backups of the database and the
+// object storage buckets
+type Archiver struct {
+	db      *sql.DB
+	storage *storage.MinioClient
+}
+
+func NewArchiver(db *sql.DB, storage *storage.MinioClient) *Archiver {
+	return &Archiver{
+		db:      db,
+		storage: storage,
+	}
+}
+
+// Create writes a backup archive to w. All tables are read in a single
+// repeatable-read transaction so the snapshot is consistent. The buckets are
+// copied afterwards, so images referenced by the snapshot are included
+// unless they were deleted in the meantime.
+func (a *Archiver) Create(ctx context.Context, w io.Writer) (*Manifest, error) {
+	manifest := &Manifest{
+		Version:   FormatVersion,
+		CreatedAt: time.Now().UTC(),
+		Tables:    []*TableEntry{},
+		Objects:   []*ObjectEntry{},
+	}
+	zw := zip.NewWriter(w)
+
+	tx, err := a.db.BeginTx(ctx, &sql.TxOptions{Isolation: sql.LevelRepeatableRead, ReadOnly: true})
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	for _, t := range tables {
+		entry, err := snapshotTable(ctx, tx, zw, t)
+		if err != nil {
+			return nil, fmt.Errorf("failed to back up table %s: %w", t.name, err)
+		}
+		manifest.Tables = append(manifest.Tables, entry)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, err
+	}
+
+	written := make(map[string]bool)
+	for _, bucket := range a.storage.Buckets() {
+		names, err := a.storage.ListObjects(ctx, bucket)
+		if err != nil {
+			return nil, err
+		}
+
+		for _, name := range names {
+			data, contentType, err := a.storage.GetImage(ctx, bucket, name)
+			if err != nil {
+				return nil, fmt.Errorf("failed to back up object %s/%s: %w", bucket, name, err)
+			}
+
+			// Objects are stored by checksum, which keeps arbitrary object
+			// names out of archive paths and dedupes identical content
+			sum := sha256.Sum256(data)
+			checksum := hex.EncodeToString(sum[:])
+			path := "objects/" + checksum
+			if !written[path] {
+				written[path] = true
+				entry, err := zw.Create(path)
+				if err != nil {
+					return nil, err
+				}
+				if _, err := entry.Write(data); err != nil {
+					return nil, err
+				}
+			}
+
+			manifest.Objects = append(manifest.Objects, &ObjectEntry{
+				Bucket:      bucket,
+				Name:        name,
+				Path:        path,
+				ContentType: contentType,
+				Size:        int64(len(data)),
+				SHA256:      checksum,
+			})
+		}
+	}
+
+	entry, err := zw.Create(manifestName)
+	if err != nil {
+		return nil, err
+	}
+	encoder := json.NewEncoder(entry)
+	encoder.SetIndent("", "  ")
+	if err := encoder.Encode(manifest); err != nil {
+		return nil, err
+	}
+
+	if err := zw.Close(); err != nil {
+		return nil, err
+	}
+	return manifest, nil
+}
+
+// snapshotTable writes every row of a table as a line of JSON
+func snapshotTable(ctx context.Context, tx *sql.Tx, zw *zip.Writer, t table) (*TableEntry, error) {
+	path := "db/" + t.name + ".jsonl"
+	entry, err := zw.Create(path)
+	if err != nil {
+		return nil, err
+	}
+
+	rows, err := tx.QueryContext(ctx, `SELECT row_to_json(t)::text FROM `+t.name+` t ORDER BY `+t.orderBy)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	hash := sha256.New()
+	out := io.MultiWriter(entry, hash)
+	count := 0
+	for rows.Next() {
+		var row string
+		if err := rows.Scan(&row); err != nil {
+			return nil, err
+		}
+		if _, err := io.WriteString(out, row+"\n"); err != nil {
+			return nil, err
+		}
+		count++
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return &TableEntry{
+		Name:   t.name,
+		Path:   path,
+		Rows:   count,
+		SHA256: hex.EncodeToString(hash.Sum(nil)),
+	}, nil
+}
+
+// Restore verifies a backup archive and loads it into an empty deployment.
+// Every checksum is checked before anything is written. Objects are uploaded
+// before the tables are loaded in one transaction, so a failed restore
+// leaves the database empty and can simply be retried.
+func (a *Archiver) Restore(ctx context.Context, r io.ReaderAt, size int64) (*Manifest, error) {
+	zr, err := zip.NewReader(r, size)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidBackup, err)
+	}
+
+	files := make(map[string]*zip.File, len(zr.File))
+	for _, file := range zr.File {
+		files[file.Name] = file
+	}
+
+	manifest, err := readManifest(files)
+	if err != nil {
+		return nil, err
+	}
+	if err := verify(files, manifest); err != nil {
+		return nil, err
+	}
+
+	if err := a.checkEmpty(ctx); err != nil {
+		return nil, err
+	}
+
+	known := make(map[string]bool)
+	for _, bucket := range a.storage.Buckets() {
+		known[bucket] = true
+	}
+	for _, object := range manifest.Objects {
+		if !known[object.Bucket] {
+			return nil, fmt.Errorf("%w: unknown bucket %q", ErrInvalidBackup, object.Bucket)
+		}
+
+		data, err := readFile(files[object.Path])
+		if err != nil {
+			return nil, err
+		}
+		if err := a.storage.PutImage(ctx, object.Bucket, object.Name, data, object.ContentType); err != nil {
+			return nil, fmt.Errorf("failed to restore object %s/%s: %w", object.Bucket, object.Name, err)
+		}
+	}
+
+	if err := a.loadTables(ctx, files, manifest); err != nil {
+		return nil, err
+	}
+
+	return manifest, nil
+}
+
+func readManifest(files map[string]*zip.File) (*Manifest, error) {
+	file, ok := files[manifestName]
+	if !ok {
+		return nil, fmt.Errorf("%w: missing %s", ErrInvalidBackup, manifestName)
+	}
+	data, err := readFile(file)
+	if err != nil {
+		return nil, err
+	}
+
+	var manifest Manifest
+	if err := json.Unmarshal(data, &manifest); err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidBackup, err)
+	}
+	if manifest.Version != FormatVersion {
+		return nil, fmt.Errorf("%w: unsupported version %d", ErrInvalidBackup, manifest.Version)
+	}
+
+	return &manifest, nil
+}
+
+// verify checks that every file listed in the manifest is present and
+// matches its checksum, and that only known tables are listed
+func verify(files map[string]*zip.File, manifest *Manifest) error {
+	known := make(map[string]bool, len(tables))
+	for _, t := range tables {
+		known[t.name] = true
+	}
+
+	check := func(path, checksum string) error {
+		file, ok := files[path]
+		if !ok {
+			return fmt.Errorf("%w: missing %s", ErrInvalidBackup, path)
+		}
+		rc, err := file.Open()
+		if err != nil {
+			return fmt.Errorf("%w: %s: %v", ErrInvalidBackup, path, err)
+		}
+		defer rc.Close()
+
+		hash := sha256.New()
+		if _, err := io.Copy(hash, rc); err != nil {
+			return fmt.Errorf("%w: %s: %v", ErrInvalidBackup, path, err)
+		}
+		if hex.EncodeToString(hash.Sum(nil)) != checksum {
+			return fmt.Errorf("%w: checksum mismatch for %s", ErrInvalidBackup, path)
+		}
+		return nil
+	}
+
+	for _, entry := range manifest.Tables {
+		if !known[entry.Name] {
+			return fmt.Errorf("%w: unknown table %q", ErrInvalidBackup, entry.Name)
+		}
+		if err := check(entry.Path, entry.SHA256); err != nil {
+			return err
+		}
+	}
+
+	verified := make(map[string]bool)
+	for _, object := range manifest.Objects {
+		if verified[object.Path] {
+			continue
+		}
+		if err := check(object.Path, object.SHA256); err != nil {
+			return err
+		}
+		verified[object.Path] = true
+	}
+
+	return nil
+}
+
+// checkEmpty refuses to restore over existing content. The seeded default
+// board does not count; boards are replaced wholesale on restore.
+func (a *Archiver) checkEmpty(ctx context.Context) error {
+	for _, t := range tables {
+		if t.name == "boards" {
+			continue
+		}
+
+		var exists bool
+		err := a.db.QueryRowContext(ctx, `SELECT EXISTS (SELECT 1 FROM `+t.name+`)`).Scan(&exists)
+		if err != nil {
+			return err
+		}
+		if exists {
+			return fmt.Errorf("%w: table %s has rows", ErrDeploymentNotEmpty, t.name)
+		}
+	}
+
+	return nil
+}
+
+// loadTables inserts every table snapshot in one transaction and moves the
+// ID sequences past the restored rows
+func (a *Archiver) loadTables(ctx context.Context, files map[string]*zip.File, manifest *Manifest) error {
+	entries := make(map[string]*TableEntry, len(manifest.Tables))
+	for _, entry := range manifest.Tables {
+		entries[entry.Name] = entry
+	}
+
+	tx, err := a.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.ExecContext(ctx, `DELETE FROM boards`); err != nil {
+		return err
+	}
+
+	for _, t := range tables {
+		entry, ok := entries[t.name]
+		if !ok {
+			log.Printf("Warning: Backup has no snapshot of table %s", t.name)
+			continue
+		}
+
+		count, err := loadTable(ctx, tx, files[entry.Path], t)
+		if err != nil {
+			return fmt.Errorf("failed to restore table %s: %w", t.name, err)
+		}
+		if count != entry.Rows {
+			return fmt.Errorf("%w: table %s has %d rows, manifest lists %d", ErrInvalidBackup, t.name, count, entry.Rows)
+		}
+
+		if t.serial {
+			_, err := tx.ExecContext(ctx, `SELECT setval(pg_get_serial_sequence('`+t.name+`', 'id'), COALESCE(MAX(id), 1), MAX(id) IS NOT NULL) FROM `+t.name)
+			if err != nil {
+				return err
+			}
+		}
+	}
+
+	return tx.Commit()
+}
+
+func loadTable(ctx context.Context, tx *sql.Tx, file *zip.File, t table) (int, error) {
+	rc, err := file.Open()
+	if err != nil {
+		return 0, err
+	}
+	defer rc.Close()
+
+	stmt, err := tx.PrepareContext(ctx, `INSERT INTO `+t.name+` SELECT * FROM json_populate_record(NULL::`+t.name+`, $1)`)
+	if err != nil {
+		return 0, err
+	}
+	defer stmt.Close()
+
+	reader := bufio.NewReader(rc)
+	count := 0
+	for {
+		line, err := reader.ReadBytes('\n')
+		if len(bytes.TrimSpace(line)) > 0 {
+			if _, execErr := stmt.ExecContext(ctx, string(line)); execErr != nil {
+				return count, execErr
+			}
+			count++
+		}
+		if err == io.EOF {
+			return count, nil
+		}
+		if err != nil {
+			return count, err
+		}
+	}
+}
+
+func readFile(file *zip.File) ([]byte, error) {
+	if file == nil {
+		return nil, fmt.Errorf("%w: missing file", ErrInvalidBackup)
+	}
+	rc, err := file.Open()
+	if err != nil {
+		return nil, err
+	}
+	defer rc.Close()
+
+	return io.ReadAll(rc)
+}
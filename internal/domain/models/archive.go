@@ -0,0 +1,44 @@
+package models
+
+import "time"
+
+// ArchiveBucket counts the archived threads created within one period
+type ArchiveBucket struct {
+	Period string `json:"period"`
+	Count  int    `json:"count"`
+}
+
+// ArchiveBucketSize selects how archived threads are grouped by date
+type ArchiveBucketSize string
+
+const (
+	BucketByDay   ArchiveBucketSize = "day"
+	BucketByMonth ArchiveBucketSize = "month"
+)
+
+// ParseArchiveBucketSize validates a bucket query value, defaulting to month
+func ParseArchiveBucketSize(value string) (ArchiveBucketSize, error) {
+	switch ArchiveBucketSize(value) {
+	case "", BucketByMonth:
+		return BucketByMonth, nil
+	case BucketByDay:
+		return BucketByDay, nil
+	default:
+		return "", ErrInvalidPeriod
+	}
+}
+
+// ParseArchivePeriod turns "2006-01" or "2006-01-02" into the half-open
+// time range it covers. An empty period covers all time.
+func ParseArchivePeriod(value string) (from, to time.Time, err error) {
+	if value == "" {
+		return time.Time{}, time.Time{}, nil
+	}
+	if day, err := time.Parse("2006-01-02", value); err == nil {
+		return day, day.AddDate(0, 0, 1), nil
+	}
+	if month, err := time.Parse("2006-01", value); err == nil {
+		return month, month.AddDate(0, 1, 0), nil
+	}
+	return time.Time{}, time.Time{}, ErrInvalidPeriod
+}
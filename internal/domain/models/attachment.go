@@ -0,0 +1,55 @@
+package models
+
+import "time"
+
+const (
+	// MaxAttachmentSize bounds the size of a single uploaded file in bytes
+	// on any board; boards set their own, lower limits
+	MaxAttachmentSize = 64 << 20
+
+	// MaxAltTextLength bounds the alt text of an attachment in characters
+	MaxAltTextLength = 1000
+)
+
+// Attachment is a file uploaded with a post or comment. Attachments of the
+// opening post have no CommentID.
+type Attachment struct {
+	ID           int     `json:"id"`
+	PostID       int     `json:"post_id"`
+	CommentID    *int    `json:"comment_id,omitempty"`
+	Position     int     `json:"position"`
+	URL          string  `json:"url"`
+	ThumbnailURL string  `json:"thumbnail_url"`
+	Filename     string  `json:"filename"`
+	ContentType  string  `json:"content_type"`
+	Size         int64   `json:"size"`
+	Width        int     `json:"width"`
+	Height       int     `json:"height"`
+	Duration     float64 `json:"duration,omitempty"`
+	Spoiler      bool    `json:"spoiler"`
+	AltText      string  `json:"alt_text"`
+
+	// ImageHash is the perceptual hash of the image or video poster, empty
+	// for clips without one. Held attachments matched a banned image and
+	// stay hidden until a moderator approves them.
+	ImageHash string    `json:"image_hash,omitempty"`
+	Held      bool      `json:"held,omitempty"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// AttachmentUpload is a file submitted with a post or comment before it is
+// stored. Files sent to storage ahead of time are referenced by UploadID;
+// their data is filled in when the upload is claimed.
+type AttachmentUpload struct {
+	UploadID    string
+	Filename    string
+	ContentType string
+	Data        []byte
+	Spoiler     bool
+	AltText     string
+
+	// ObjectURL is the MinIO URL of a claimed upload's object, which is
+	// read in place instead of Data and removed once the file is stored
+	// under its content hash
+	ObjectURL string
+}
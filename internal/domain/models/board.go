@@ -0,0 +1,30 @@
+package models
+
+import "time"
+
+// DefaultBoard is the board posts are created on when none is given
+const DefaultBoard = "b"
+
+type Board struct {
+	Slug             string    `json:"slug"`
+	Name             string    `json:"name"`
+	BumpLimit        int       `json:"bump_limit"`
+	MaxThreads       int       `json:"max_threads"`
+	ArchiveEnabled   bool      `json:"archive_enabled"`
+	Reactions        []string  `json:"reactions"`
+	MaxAttachments   int       `json:"max_attachments"`
+	MaxFileSize      int64     `json:"max_file_size"`
+	MaxVideoDuration int       `json:"max_video_duration"`
+	ImageBanAction   string    `json:"image_ban_action"`
+	CreatedAt        time.Time `json:"created_at"`
+}
+
+// BoardLimits changes the limits of a board; nil fields are left as they
+// are. A bump limit or thread cap of 0 turns it off.
+type BoardLimits struct {
+	BumpLimit        *int   `json:"bump_limit"`
+	MaxThreads       *int   `json:"max_threads"`
+	MaxAttachments   *int   `json:"max_attachments"`
+	MaxFileSize      *int64 `json:"max_file_size"`
+	MaxVideoDuration *int   `json:"max_video_duration"`
+}
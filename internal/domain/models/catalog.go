@@ -0,0 +1,18 @@
+package models
+
+import "time"
+
+// CatalogEntry is the compact summary of a live thread shown in a catalog
+type CatalogEntry struct {
+	ID         int       `json:"id"`
+	Board      string    `json:"board"`
+	Title      string    `json:"title"`
+	Excerpt    string    `json:"excerpt"`
+	Thumbnail  string    `json:"thumbnail"`
+	ReplyCount int       `json:"reply_count"`
+	ImageCount int       `json:"image_count"`
+	IsSticky   bool      `json:"is_sticky"`
+	IsLocked   bool      `json:"is_locked"`
+	CreatedAt  time.Time `json:"created_at"`
+	BumpedAt   time.Time `json:"bumped_at"`
+}
@@ -3,14 +3,33 @@ package models
 import "time"
 
 type Comment struct {
-	ID               int       `json:"id"`
-	PostID           int       `json:"post_id"`
-	Title            string    `json:"title"`
-	Content          string    `json:"content"`
-	AuthorID         string    `json:"author_id"`
-	AuthorName       string    `json:"author_name"`
-	AuthorImage      string    `json:"author_image"`
-	ImageURL         string    `json:"image_url"`
-	ReplyToCommentID *int      `json:"reply_to_comment_id,omitempty"`
-	CreatedAt        time.Time `json:"created_at"`
+	ID               int                 `json:"id"`
+	PostID           int                 `json:"post_id"`
+	Title            string              `json:"title"`
+	Content          string              `json:"content"`
+	ContentHTML      string              `json:"content_html"`
+	AuthorID         string              `json:"author_id"`
+	AuthorName       string              `json:"author_name"`
+	Tripcode         string              `json:"tripcode,omitempty"`
+	AuthorImage      string              `json:"author_image"`
+	ImageURL         string              `json:"image_url"`
+	Attachments      []*Attachment       `json:"attachments"`
+	ReplyToCommentID *int                `json:"reply_to_comment_id,omitempty"`
+	Sage             bool                `json:"sage"`
+	Quotes           []*CommentReference `json:"quotes"`
+	Backlinks        []*CommentReference `json:"backlinks"`
+	Reactions        map[string]int      `json:"reactions"`
+	MyReactions      []string            `json:"my_reactions"`
+	CreatedAt        time.Time           `json:"created_at"`
+	EditedAt         time.Time           `json:"edited_at"`
+
+	// Version counts the comment's edits; updates must name the version
+	// they were based on
+	Version int `json:"version"`
+
+	// Moderation state; none of it is shown to readers, so an author
+	// whose content is held back cannot tell
+	Flagged    bool   `json:"-"`
+	Visibility string `json:"-"`
+	IPHash     string `json:"-"`
 }
@@ -0,0 +1,11 @@
+package models
+
+// CommentReference links a comment to another comment it quotes with ">>id"
+type CommentReference struct {
+	CommentID    int    `json:"comment_id"`
+	PostID       int    `json:"post_id"`
+	TargetID     int    `json:"target_id"`
+	TargetBoard  string `json:"target_board,omitempty"`
+	TargetPostID *int   `json:"target_post_id,omitempty"`
+	CrossThread  bool   `json:"cross_thread"`
+}
@@ -0,0 +1,41 @@
+package models
+
+import "errors"
+
+var (
+	ErrBoardNotFound   = errors.New("board not found")
+	ErrInvalidLimits   = errors.New("invalid board limits")
+	ErrPostNotFound    = errors.New("post not found")
+	ErrInvalidSort     = errors.New("invalid sort order")
+	ErrThreadLocked    = errors.New("thread is locked")
+	ErrThreadArchived  = errors.New("thread is archived")
+	ErrInvalidPeriod   = errors.New("invalid archive period")
+	ErrInvalidExport   = errors.New("invalid thread export")
+	ErrCommentNotFound = errors.New("comment not found")
+	ErrInvalidReaction = errors.New("reaction is not allowed on this board")
+	ErrInvalidPoll     = errors.New("invalid poll")
+	ErrPollNotFound    = errors.New("poll not found")
+	ErrPollClosed      = errors.New("poll is closed")
+	ErrAlreadyVoted    = errors.New("session already voted")
+	ErrInvalidVote     = errors.New("invalid vote")
+
+	ErrTooManyAttachments = errors.New("too many attachments")
+	ErrInvalidAttachment  = errors.New("invalid attachment")
+	ErrUploadNotFound     = errors.New("upload not found")
+	ErrBannedImage        = errors.New("image is banned")
+
+	ErrInvalidImageBan    = errors.New("invalid image ban")
+	ErrImageBanNotFound   = errors.New("image ban not found")
+	ErrAttachmentNotFound = errors.New("attachment not found")
+
+	ErrContentRejected    = errors.New("content rejected")
+	ErrInvalidFilterRule  = errors.New("invalid filter rule")
+	ErrFilterRuleNotFound = errors.New("filter rule not found")
+
+	ErrInvalidQuarantine  = errors.New("invalid quarantine")
+	ErrQuarantineNotFound = errors.New("quarantine not found")
+
+	ErrEditWindowClosed = errors.New("edit window has closed")
+	ErrVersionConflict  = errors.New("edited since the given version")
+	ErrNotAuthor        = errors.New("not the author")
+)
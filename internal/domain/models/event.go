@@ -0,0 +1,26 @@
+package models
+
+// Event types pushed to live clients
+const (
+	EventThreadPruned     = "thread_pruned"
+	EventReactionsUpdated = "reactions_updated"
+)
+
+// Event is a notification pushed to live clients
+type Event struct {
+	Type  string      `json:"type"`
+	Board string      `json:"board,omitempty"`
+	Data  interface{} `json:"data"`
+}
+
+// PrunedThread describes a thread removed to keep a board under its cap
+type PrunedThread struct {
+	PostID int    `json:"post_id"`
+	Board  string `json:"board"`
+	Action string `json:"action"` // "archived" or "deleted"
+
+	// Attachments and ImageURLs are the files of a deleted thread and its
+	// replies, to be released once the deletion is committed
+	Attachments []*Attachment `json:"-"`
+	ImageURLs   []string      `json:"-"`
+}
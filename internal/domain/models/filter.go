@@ -0,0 +1,45 @@
+package models
+
+import "time"
+
+// What a filter rule does with content it matches
+const (
+	FilterReplace = "replace"
+	FilterReject  = "reject"
+	FilterFlag    = "flag"
+	FilterHide    = "hide"
+)
+
+// FilterRule matches a literal phrase or a regular expression in the title
+// and content of new and edited posts and comments. Rules without a board
+// apply everywhere.
+type FilterRule struct {
+	ID          int       `json:"id"`
+	Board       string    `json:"board,omitempty"`
+	Pattern     string    `json:"pattern"`
+	IsRegex     bool      `json:"regex"`
+	Action      string    `json:"action"`
+	Replacement string    `json:"replacement,omitempty"`
+	Message     string    `json:"message,omitempty"`
+	Enabled     bool      `json:"enabled"`
+	Hits        int64     `json:"hits"`
+	LastHitAt   time.Time `json:"last_hit_at"`
+	CreatedAt   time.Time `json:"created_at"`
+}
+
+// FilterVerdict is what the filter rules decided about a piece of content
+// besides replacing text in it
+type FilterVerdict struct {
+	// Flagged content shows up in the moderation queue
+	Flagged bool
+
+	// Hidden content is held back from everyone but its author until a
+	// moderator approves it
+	Hidden bool
+}
+
+// ModerationQueue lists the posts and comments waiting for a moderator
+type ModerationQueue struct {
+	Posts    []*Post    `json:"posts"`
+	Comments []*Comment `json:"comments"`
+}
@@ -0,0 +1,28 @@
+package models
+
+import "time"
+
+const (
+	// DefaultImageBanThreshold is the Hamming distance within which an
+	// image matches a ban when the moderator gives none
+	DefaultImageBanThreshold = 6
+
+	// MaxImageBanThreshold keeps bans from matching unrelated images
+	MaxImageBanThreshold = 20
+)
+
+// What a board does with uploads that match a banned image
+const (
+	ImageBanReject = "reject"
+	ImageBanReview = "review"
+)
+
+// ImageBan bans every image whose perceptual hash is within Threshold bits
+// of Hash
+type ImageBan struct {
+	ID        int       `json:"id"`
+	Hash      string    `json:"hash"`
+	Threshold int       `json:"threshold"`
+	Reason    string    `json:"reason"`
+	CreatedAt time.Time `json:"created_at"`
+}
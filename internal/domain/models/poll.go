@@ -0,0 +1,92 @@
+package models
+
+import (
+	"fmt"
+	"strings"
+	"time"
+	"unicode/utf8"
+)
+
+const (
+	PollMinOptions        = 2
+	PollMaxOptions        = 10
+	PollMaxQuestionLength = 300
+	PollMaxOptionLength   = 200
+)
+
+// Poll is a question attached to a thread. Vote counts are only filled in
+// when the viewer may see them, i.e. after voting or once the poll closed.
+type Poll struct {
+	ID             int           `json:"id"`
+	PostID         int           `json:"post_id"`
+	Question       string        `json:"question"`
+	MultipleChoice bool          `json:"multiple_choice"`
+	Options        []*PollOption `json:"options"`
+	ClosesAt       *time.Time    `json:"closes_at,omitempty"`
+	Closed         bool          `json:"closed"`
+	Voted          bool          `json:"voted"`
+	ResultsVisible bool          `json:"results_visible"`
+	TotalVotes     *int          `json:"total_votes,omitempty"`
+	CreatedAt      time.Time     `json:"created_at"`
+}
+
+type PollOption struct {
+	ID       int    `json:"id"`
+	Position int    `json:"position"`
+	Text     string `json:"text"`
+	Votes    *int   `json:"votes,omitempty"`
+	Selected bool   `json:"selected"`
+}
+
+// PollVote is one option chosen by a session
+type PollVote struct {
+	PollID    int       `json:"poll_id"`
+	OptionID  int       `json:"option_id"`
+	SessionID string    `json:"-"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// IsClosed reports whether the poll stopped accepting votes at now
+func (p *Poll) IsClosed(now time.Time) bool {
+	return p.ClosesAt != nil && !now.Before(*p.ClosesAt)
+}
+
+// Validate trims the question and options of a new poll and checks them
+// against the poll limits
+func (p *Poll) Validate(now time.Time) error {
+	p.Question = strings.TrimSpace(p.Question)
+	if p.Question == "" {
+		return fmt.Errorf("%w: question is required", ErrInvalidPoll)
+	}
+	if utf8.RuneCountInString(p.Question) > PollMaxQuestionLength {
+		return fmt.Errorf("%w: question is longer than %d characters", ErrInvalidPoll, PollMaxQuestionLength)
+	}
+
+	seen := make(map[string]bool, len(p.Options))
+	options := p.Options[:0]
+	for _, option := range p.Options {
+		option.Text = strings.TrimSpace(option.Text)
+		if option.Text == "" {
+			continue
+		}
+		if utf8.RuneCountInString(option.Text) > PollMaxOptionLength {
+			return fmt.Errorf("%w: option is longer than %d characters", ErrInvalidPoll, PollMaxOptionLength)
+		}
+		if seen[option.Text] {
+			return fmt.Errorf("%w: duplicate option %q", ErrInvalidPoll, option.Text)
+		}
+		seen[option.Text] = true
+		option.Position = len(options)
+		options = append(options, option)
+	}
+	p.Options = options
+
+	if len(p.Options) < PollMinOptions || len(p.Options) > PollMaxOptions {
+		return fmt.Errorf("%w: a poll needs %d to %d options", ErrInvalidPoll, PollMinOptions, PollMaxOptions)
+	}
+	if p.ClosesAt != nil && !p.ClosesAt.After(now) {
+		return fmt.Errorf("%w: close time must be in the future", ErrInvalidPoll)
+	}
+
+	return nil
+}
@@ -2,16 +2,60 @@ package models
 
 import "time"
 
+// PostSort selects the ordering of thread listings
+type PostSort string
+
+const (
+	SortByBump    PostSort = "bump"
+	SortByCreated PostSort = "created"
+	SortByReplies PostSort = "replies"
+)
+
+// ParsePostSort validates a sort query value, defaulting to bump order
+func ParsePostSort(value string) (PostSort, error) {
+	switch PostSort(value) {
+	case "", SortByBump:
+		return SortByBump, nil
+	case SortByCreated, SortByReplies:
+		return PostSort(value), nil
+	default:
+		return "", ErrInvalidSort
+	}
+}
+
 type Post struct {
-	ID          int        `json:"id"`
-	Title       string     `json:"title"`
-	Content     string     `json:"content"`
-	AuthorID    string     `json:"author_id"`
-	AuthorName  string     `json:"author_name"`
-	AuthorImage string     `json:"author_image"`
-	ImageURL    string     `json:"image_url"`
-	Comments    []*Comment `json:"comments"`
-	IsArchive   bool       `json:"is_archive"`
-	CreatedAt   time.Time  `json:"created_at"`
-	ExpiresAt   time.Time  `json:"expires_at"`
+	ID          int            `json:"id"`
+	Board       string         `json:"board"`
+	Title       string         `json:"title"`
+	Content     string         `json:"content"`
+	ContentHTML string         `json:"content_html"`
+	AuthorID    string         `json:"author_id"`
+	AuthorName  string         `json:"author_name"`
+	Tripcode    string         `json:"tripcode,omitempty"`
+	AuthorImage string         `json:"author_image"`
+	ImageURL    string         `json:"image_url"`
+	Attachments []*Attachment  `json:"attachments"`
+	Comments    []*Comment     `json:"comments"`
+	ReplyCount  int            `json:"reply_count"`
+	Reactions   map[string]int `json:"reactions"`
+	MyReactions []string       `json:"my_reactions"`
+	Poll        *Poll          `json:"poll,omitempty"`
+	IsArchive   bool           `json:"is_archive"`
+	IsSticky    bool           `json:"is_sticky"`
+	IsLocked    bool           `json:"is_locked"`
+	CreatedAt   time.Time      `json:"created_at"`
+	BumpedAt    time.Time      `json:"bumped_at"`
+	ExpiresAt   time.Time      `json:"expires_at"`
+	ArchivedAt  time.Time      `json:"archived_at"`
+	EditedAt    time.Time      `json:"edited_at"`
+
+	// Version counts the thread's edits; updates must name the version
+	// they were based on
+	Version int `json:"version"`
+
+	// Moderation state; none of it is shown to readers, so an author
+	// whose content is held back cannot tell
+	Flagged    bool   `json:"-"`
+	Visibility string `json:"-"`
+	IPHash     string `json:"-"`
 }
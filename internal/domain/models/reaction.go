@@ -0,0 +1,24 @@
+package models
+
+import "time"
+
+// DefaultReactions is the reaction set of boards that do not configure one
+var DefaultReactions = []string{"👍", "❤️", "😂", "😮", "😢"}
+
+// Reaction is one session's reaction to a post or, when CommentID is set,
+// to a comment in the thread PostID
+type Reaction struct {
+	ID        int       `json:"id"`
+	PostID    int       `json:"post_id"`
+	CommentID *int      `json:"comment_id,omitempty"`
+	SessionID string    `json:"-"`
+	Emoji     string    `json:"emoji"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// ReactionUpdate is the live event payload sent when reaction counts change
+type ReactionUpdate struct {
+	PostID    int            `json:"post_id"`
+	CommentID *int           `json:"comment_id,omitempty"`
+	Reactions map[string]int `json:"reactions"`
+}
@@ -0,0 +1,32 @@
+package models
+
+import "time"
+
+// Revision is an earlier version of a post or comment, saved when it was
+// edited
+type Revision struct {
+	ID      int    `json:"id"`
+	Title   string `json:"title"`
+	Content string `json:"content"`
+
+	// ImageURL is the version's first attachment; files released by a
+	// later edit are no longer served
+	ImageURL string `json:"image_url"`
+
+	// EditorID is the session that made the edit replacing this version,
+	// and CreatedAt is when it was made
+	EditorID  string    `json:"editor_id"`
+	CreatedAt time.Time `json:"created_at"`
+
+	// TitleDiff and ContentDiff turn this version into the next one, or
+	// into the current post or comment for the latest revision
+	TitleDiff   []*DiffLine `json:"title_diff"`
+	ContentDiff []*DiffLine `json:"content_diff"`
+}
+
+// DiffLine is one line of a revision diff; Op is "equal", "insert" or
+// "delete"
+type DiffLine struct {
+	Op   string `json:"op"`
+	Text string `json:"text"`
+}
@@ -0,0 +1,26 @@
+package models
+
+import "time"
+
+// ThreadExportVersion is the current version of the thread export format
+const ThreadExportVersion = 1
+
+// ThreadExport is the thread.json manifest at the root of a thread export
+// archive. IDs and image URLs are the ones of the exporting deployment.
+type ThreadExport struct {
+	Version    int                 `json:"version"`
+	ExportedAt time.Time           `json:"exported_at"`
+	Post       *Post               `json:"post"`
+	Comments   []*Comment          `json:"comments"`
+	References []*CommentReference `json:"references"`
+	Images     []*ExportedImage    `json:"images"`
+}
+
+// ExportedImage maps a stored image URL to its copy inside the archive
+type ExportedImage struct {
+	URL         string `json:"url"`
+	Bucket      string `json:"bucket"`
+	Path        string `json:"path"`
+	ContentType string `json:"content_type"`
+	SHA256      string `json:"sha256"`
+}
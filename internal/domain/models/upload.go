@@ -0,0 +1,36 @@
+package models
+
+import "time"
+
+// Upload is a file the client puts straight into storage through a
+// presigned URL. It is claimed, and its row removed, when a post or comment
+// references it; uploads left unclaimed past ExpiresAt are collected.
+type Upload struct {
+	ID          string    `json:"id"`
+	SessionID   string    `json:"-"`
+	Bucket      string    `json:"-"`
+	ObjectName  string    `json:"-"`
+	Filename    string    `json:"filename"`
+	ContentType string    `json:"content_type"`
+	Size        int64     `json:"size"`
+	CreatedAt   time.Time `json:"created_at"`
+	ExpiresAt   time.Time `json:"expires_at"`
+}
+
+// UploadTarget is the kind of message an upload will be attached to
+type UploadTarget string
+
+const (
+	UploadTargetPost    UploadTarget = "post"
+	UploadTargetComment UploadTarget = "comment"
+)
+
+// PresignedUpload tells the client where and how to send the file of an
+// upload. The request must carry exactly the given headers, since they are
+// part of the signature.
+type PresignedUpload struct {
+	*Upload
+	URL     string            `json:"url"`
+	Method  string            `json:"method"`
+	Headers map[string]string `json:"headers"`
+}
@@ -0,0 +1,41 @@
+package models
+
+import "time"
+
+// Who can see a post or comment
+const (
+	// VisibilityVisible content is shown to everyone
+	VisibilityVisible = "visible"
+
+	// VisibilityPending content is only shown to its author and moderators
+	// until a moderator approves it
+	VisibilityPending = "pending"
+)
+
+// Viewer is who posts and comments are read for. Pending content is only
+// returned to its author and to staff.
+type Viewer struct {
+	SessionID string
+	Staff     bool
+}
+
+// Staff sees all content; it is used by moderators and for reads the
+// services make on their own behalf
+var Staff = Viewer{Staff: true}
+
+// CanSee reports whether the viewer may see content with the given
+// visibility and author
+func (v Viewer) CanSee(visibility, authorID string) bool {
+	return v.Staff || visibility != VisibilityPending || (v.SessionID != "" && v.SessionID == authorID)
+}
+
+// Quarantine holds back everything a session or a hashed client address
+// posts until a moderator approves it. Exactly one of SessionID and IPHash
+// is set.
+type Quarantine struct {
+	ID        int       `json:"id"`
+	SessionID string    `json:"session_id,omitempty"`
+	IPHash    string    `json:"ip_hash,omitempty"`
+	Reason    string    `json:"reason"`
+	CreatedAt time.Time `json:"created_at"`
+}
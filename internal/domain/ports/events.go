@@ -0,0 +1,7 @@
+package ports
+
+import "1337b04rd/internal/domain/models"
+
+type EventPublisher interface {
+	Publish(event models.Event)
+}
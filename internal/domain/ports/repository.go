@@ -2,26 +2,117 @@ package ports
 
 import (
 	"context"
+	"time"
 	"1337b04rd/internal/domain/models"
 )
 
 type PostRepository interface {
-	Create(ctx context.Context, post *models.Post) error
-	GetByID(ctx context.Context, id int) (*models.Post, error)
-	GetAll(ctx context.Context, limit, offset int, includeArchived bool) ([]*models.Post, error)
-	GetByAuthorID(ctx context.Context, authorID string, limit, offset int) ([]*models.Post, error)
+	Create(ctx context.Context, post *models.Post) ([]*models.PrunedThread, error)
+	GetByID(ctx context.Context, id int, viewer models.Viewer) (*models.Post, error)
+	Lock(ctx context.Context, id int) (*models.Post, error)
+	GetAll(ctx context.Context, viewer models.Viewer, limit, offset int, includeArchived bool, sort models.PostSort) ([]*models.Post, error)
+	GetByAuthorID(ctx context.Context, authorID string, viewer models.Viewer, limit, offset int) ([]*models.Post, error)
 	Update(ctx context.Context, post *models.Post) error
+	Edit(ctx context.Context, post *models.Post, editorID string) error
+	GetRevisions(ctx context.Context, postID int) ([]*models.Revision, error)
 	Delete(ctx context.Context, id int) error
 	Archive(ctx context.Context, id int) error
 	Unarchive(ctx context.Context, id int) error
+	Bump(ctx context.Context, id int, at time.Time) error
+	SetSticky(ctx context.Context, id int, sticky bool) error
+	SetLocked(ctx context.Context, id int, locked bool) error
+	ArchiveExpired(ctx context.Context, now time.Time) (int, error)
+	GetCatalog(ctx context.Context, board string) ([]*models.CatalogEntry, error)
+	GetArchiveBuckets(ctx context.Context, board string, size models.ArchiveBucketSize, search string) ([]*models.ArchiveBucket, error)
+	GetArchived(ctx context.Context, board string, from, to time.Time, search string, limit, offset int) ([]*models.Post, error)
+	GetArchivedBefore(ctx context.Context, cutoff time.Time, limit int) ([]*models.Post, error)
+	Unflag(ctx context.Context, id int) error
+	Approve(ctx context.Context, id int) error
+	GetFlagged(ctx context.Context, limit, offset int) ([]*models.Post, error)
+	GetPending(ctx context.Context, limit, offset int) ([]*models.Post, error)
 }
 
 type CommentRepository interface {
 	Create(ctx context.Context, comment *models.Comment) error
 	GetByID(ctx context.Context, id int) (*models.Comment, error)
-	GetByPostID(ctx context.Context, postID int) ([]*models.Comment, error)
+	GetByPostID(ctx context.Context, postID int, viewer models.Viewer) ([]*models.Comment, error)
 	Update(ctx context.Context, comment *models.Comment) error
+	Edit(ctx context.Context, comment *models.Comment, editorID string) error
+	GetRevisions(ctx context.Context, commentID int) ([]*models.Revision, error)
 	Delete(ctx context.Context, id int) error
+	Unflag(ctx context.Context, id int) error
+	Approve(ctx context.Context, id int) error
+	GetFlagged(ctx context.Context, limit, offset int) ([]*models.Comment, error)
+	GetPending(ctx context.Context, limit, offset int) ([]*models.Comment, error)
+}
+
+type CommentReferenceRepository interface {
+	ReplaceForComment(ctx context.Context, commentID int, refs []*models.CommentReference) error
+	GetByCommentIDs(ctx context.Context, commentIDs []int) ([]*models.CommentReference, error)
+	GetByTargetIDs(ctx context.Context, targetIDs []int, viewer models.Viewer) ([]*models.CommentReference, error)
+}
+
+type BoardRepository interface {
+	GetBySlug(ctx context.Context, slug string) (*models.Board, error)
+	SetReactions(ctx context.Context, slug string, reactions []string) error
+	SetLimits(ctx context.Context, slug string, limits models.BoardLimits) error
+	SetImageBanAction(ctx context.Context, slug, action string) error
+}
+
+type ReactionRepository interface {
+	Add(ctx context.Context, reaction *models.Reaction) (bool, map[string]int, error)
+	Remove(ctx context.Context, reaction *models.Reaction) (bool, map[string]int, error)
+	GetBySession(ctx context.Context, sessionID string, postIDs []int) ([]*models.Reaction, error)
+}
+
+type PollRepository interface {
+	Create(ctx context.Context, poll *models.Poll) error
+	GetByPostIDs(ctx context.Context, postIDs []int) ([]*models.Poll, error)
+	GetVotesBySession(ctx context.Context, sessionID string, pollIDs []int) ([]*models.PollVote, error)
+	Vote(ctx context.Context, pollID int, sessionID string, optionIDs []int, at time.Time) error
+}
+
+type AttachmentRepository interface {
+	Replace(ctx context.Context, postID int, commentID *int, attachments []*models.Attachment) ([]*models.Attachment, error)
+	GetByPostIDs(ctx context.Context, postIDs []int) ([]*models.Attachment, error)
+	GetByCommentIDs(ctx context.Context, commentIDs []int) ([]*models.Attachment, error)
+	GetByID(ctx context.Context, id int) (*models.Attachment, error)
+	GetHeld(ctx context.Context, limit, offset int) ([]*models.Attachment, error)
+	Release(ctx context.Context, id int, url, thumbnailURL string) error
+	Delete(ctx context.Context, id int) (*models.Attachment, error)
+}
+
+type ImageBanRepository interface {
+	Create(ctx context.Context, ban *models.ImageBan) error
+	GetAll(ctx context.Context) ([]*models.ImageBan, error)
+	Delete(ctx context.Context, id int) error
+}
+
+type FilterRuleRepository interface {
+	Create(ctx context.Context, rule *models.FilterRule) error
+	GetAll(ctx context.Context) ([]*models.FilterRule, error)
+	Update(ctx context.Context, rule *models.FilterRule) error
+	Delete(ctx context.Context, id int) error
+	AddHits(ctx context.Context, ids []int, at time.Time) error
+}
+
+type QuarantineRepository interface {
+	Create(ctx context.Context, quarantine *models.Quarantine) error
+	GetAll(ctx context.Context) ([]*models.Quarantine, error)
+	Delete(ctx context.Context, id int) error
+	Matches(ctx context.Context, sessionID, ipHash string) (bool, error)
+}
+
+type UploadRepository interface {
+	Create(ctx context.Context, upload *models.Upload) error
+	Claim(ctx context.Context, id, sessionID, bucket string, now time.Time) (*models.Upload, error)
+	GetExpired(ctx context.Context, now time.Time, limit int) ([]*models.Upload, error)
+	Delete(ctx context.Context, id string) error
+}
+
+type ObjectRepository interface {
+	Acquire(ctx context.Context, bucket, objectName string) error
+	Release(ctx context.Context, bucket, objectName string, remove func() error) error
 }
 
 type SessionRepository interface {
@@ -31,3 +122,24 @@ type SessionRepository interface {
 	Delete(ctx context.Context, id string) error
 	CleanupExpired(ctx context.Context) error
 }
+
+// Work is the repositories of one unit of work, bound to its transaction
+type Work interface {
+	Posts() PostRepository
+	Comments() CommentRepository
+	Sessions() SessionRepository
+	Attachments() AttachmentRepository
+	Uploads() UploadRepository
+	Polls() PollRepository
+	References() CommentReferenceRepository
+
+	// OnRollback registers compensate to undo something done outside the
+	// database, such as storing a file, if the work is rolled back
+	OnRollback(compensate func(ctx context.Context))
+}
+
+// UnitOfWork runs fn with repositories sharing one transaction, committed
+// only if fn succeeds
+type UnitOfWork interface {
+	Do(ctx context.Context, fn func(work Work) error) error
+}
@@ -3,28 +3,96 @@ package ports
 import (
 	"1337b04rd/internal/domain/models"
 	"context"
-	"mime/multipart"
+	"io"
+	"time"
 )
 
 type PostService interface {
-	CreatePost(ctx context.Context, post *models.Post, imageFile multipart.File, imageHeader *multipart.FileHeader) error
-	GetPost(ctx context.Context, id int) (*models.Post, error)
-	GetPosts(ctx context.Context, limit, offset int, includeArchived bool) ([]*models.Post, error)
-	GetPostsByAuthor(ctx context.Context, authorID string, limit, offset int) ([]*models.Post, error)
-	UpdatePost(ctx context.Context, post *models.Post, imageFile multipart.File, imageHeader *multipart.FileHeader) error
+	CreatePost(ctx context.Context, post *models.Post, uploads []*models.AttachmentUpload) error
+	GetPost(ctx context.Context, id int, viewer models.Viewer) (*models.Post, error)
+	GetPosts(ctx context.Context, viewer models.Viewer, limit, offset int, includeArchived bool, sort models.PostSort) ([]*models.Post, error)
+	GetPostsByAuthor(ctx context.Context, authorID string, viewer models.Viewer, limit, offset int) ([]*models.Post, error)
+	UpdatePost(ctx context.Context, post *models.Post, uploads []*models.AttachmentUpload) error
+	GetPostRevisions(ctx context.Context, id int, viewer models.Viewer) ([]*models.Revision, error)
 	DeletePost(ctx context.Context, id int) error
 	ArchivePost(ctx context.Context, id int) error
 	UnarchivePost(ctx context.Context, id int) error
+	SetSticky(ctx context.Context, id int, sticky bool) error
+	SetLocked(ctx context.Context, id int, locked bool) error
+	SetBoardLimits(ctx context.Context, board string, limits models.BoardLimits) error
+	ArchiveExpiredPosts(ctx context.Context) (int, error)
+	GetCatalog(ctx context.Context, board string) ([]*models.CatalogEntry, error)
+	GetArchiveBuckets(ctx context.Context, board string, size models.ArchiveBucketSize, search string) ([]*models.ArchiveBucket, error)
+	GetArchivedPosts(ctx context.Context, board string, from, to time.Time, search string, limit, offset int) ([]*models.Post, error)
+	PurgeArchivedPosts(ctx context.Context, cutoff time.Time) (int, error)
 }
 
 type CommentService interface {
-	CreateComment(ctx context.Context, comment *models.Comment, imageFile multipart.File, imageHeader *multipart.FileHeader) error
-	GetComment(ctx context.Context, id int) (*models.Comment, error)
-	GetCommentsByPost(ctx context.Context, postID int) ([]*models.Comment, error)
-	UpdateComment(ctx context.Context, comment *models.Comment, imageFile multipart.File, imageHeader *multipart.FileHeader) error
+	CreateComment(ctx context.Context, comment *models.Comment, uploads []*models.AttachmentUpload) error
+	GetComment(ctx context.Context, id int, viewer models.Viewer) (*models.Comment, error)
+	GetCommentsByPost(ctx context.Context, postID int, viewer models.Viewer) ([]*models.Comment, error)
+	UpdateComment(ctx context.Context, comment *models.Comment, uploads []*models.AttachmentUpload) error
+	GetCommentRevisions(ctx context.Context, id int, viewer models.Viewer) ([]*models.Revision, error)
 	DeleteComment(ctx context.Context, id int) error
 }
 
+type ReactionService interface {
+	AddReaction(ctx context.Context, reaction *models.Reaction) (map[string]int, error)
+	RemoveReaction(ctx context.Context, reaction *models.Reaction) (map[string]int, error)
+	GetBoardReactions(ctx context.Context, board string) ([]string, error)
+	SetBoardReactions(ctx context.Context, board string, reactions []string) error
+	LoadSessionReactions(ctx context.Context, sessionID string, posts []*models.Post) error
+	LoadSessionCommentReactions(ctx context.Context, sessionID string, comments []*models.Comment) error
+}
+
+type PollService interface {
+	GetPoll(ctx context.Context, postID int, sessionID string) (*models.Poll, error)
+	Vote(ctx context.Context, postID int, sessionID string, optionIDs []int) (*models.Poll, error)
+	LoadPolls(ctx context.Context, sessionID string, posts []*models.Post) error
+}
+
+type UploadService interface {
+	CreateUpload(ctx context.Context, sessionID string, target models.UploadTarget, board, filename, contentType string, size int64) (*models.PresignedUpload, error)
+	CollectExpiredUploads(ctx context.Context) (int, error)
+}
+
+type ImageBanService interface {
+	GetImageBans(ctx context.Context) ([]*models.ImageBan, error)
+	CreateImageBan(ctx context.Context, hash string, attachmentID, threshold int, reason string) (*models.ImageBan, error)
+	DeleteImageBan(ctx context.Context, id int) error
+	GetHeldAttachments(ctx context.Context, limit, offset int) ([]*models.Attachment, error)
+	ApproveAttachment(ctx context.Context, id int) error
+	RejectAttachment(ctx context.Context, id int) error
+	SetBoardImageBanAction(ctx context.Context, board, action string) error
+}
+
+// ContentFilter runs the filter rules of a board over the text fields of a
+// post or comment, replacing matched text in place
+type ContentFilter interface {
+	Apply(ctx context.Context, board string, fields ...*string) (*models.FilterVerdict, error)
+}
+
+type FilterService interface {
+	ContentFilter
+	GetFilterRules(ctx context.Context) ([]*models.FilterRule, error)
+	CreateFilterRule(ctx context.Context, rule *models.FilterRule) error
+	UpdateFilterRule(ctx context.Context, rule *models.FilterRule) error
+	DeleteFilterRule(ctx context.Context, id int) error
+	ReloadRules(ctx context.Context) error
+	GetFlagged(ctx context.Context, limit, offset int) (*models.ModerationQueue, error)
+	UnflagPost(ctx context.Context, id int) error
+	UnflagComment(ctx context.Context, id int) error
+}
+
+type QuarantineService interface {
+	GetQuarantines(ctx context.Context) ([]*models.Quarantine, error)
+	CreateQuarantine(ctx context.Context, sessionID string, postID, commentID int, byIP bool, reason string) (*models.Quarantine, error)
+	DeleteQuarantine(ctx context.Context, id int) error
+	GetPending(ctx context.Context, limit, offset int) (*models.ModerationQueue, error)
+	ApprovePost(ctx context.Context, id int) error
+	ApproveComment(ctx context.Context, id int) error
+}
+
 type SessionService interface {
 	CreateSession(ctx context.Context, session *models.Session) error
 	GetSession(ctx context.Context, id string) (*models.Session, error)
@@ -32,3 +100,8 @@ type SessionService interface {
 	DeleteSession(ctx context.Context, id string) error
 	CleanupExpiredSessions(ctx context.Context) error
 }
+
+type TransferService interface {
+	ExportThread(ctx context.Context, postID int, w io.Writer) error
+	ImportThread(ctx context.Context, r io.ReaderAt, size int64, board string) (*models.Post, error)
+}
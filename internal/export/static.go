@@ -0,0 +1,343 @@
+package export
+
+import (
+	"1337b04rd/internal/adapters/storage"
+	"1337b04rd/internal/domain/models"
+	"1337b04rd/internal/domain/ports"
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"embed"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"html/template"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"time"
+)
+
+//go:embed templates
+var templateFS embed.FS
+
+var templates = template.Must(template.New("").Funcs(template.FuncMap{
+	// Content HTML comes from the markup renderer, which escapes all user input
+	"safeHTML": func(s string) template.HTML { return template.HTML(s) },
+}).ParseFS(templateFS, "templates/*.html"))
+
+// exportPageSize is how many archived threads are listed per query
+const exportPageSize = 100
+
+// manifestFile records every thread exported for a board across runs, so
+// the index stays complete when a later run only covers recent threads
+const manifestFile = "threads.json"
+
+// StaticOptions selects what a static export covers
+type StaticOptions struct {
+	Board  string
+	Since  time.Time
+	OutDir string
+}
+
+// StaticResult summarizes a static export run
+type StaticResult struct {
+	ThreadsWritten   int
+	ThreadsUnchanged int
+	ImagesCopied     int
+}
+
+// StaticExporter renders archived threads into a self-contained static site
+type StaticExporter struct {
+	postService    ports.PostService
+	commentService ports.CommentService
+	storage        *storage.MinioClient
+}
+
+func NewStaticExporter(postService ports.PostService, commentService ports.CommentService, storage *storage.MinioClient) *StaticExporter {
+	return &StaticExporter{
+		postService:    postService,
+		commentService: commentService,
+		storage:        storage,
+	}
+}
+
+type threadEntry struct {
+	ID         int       `json:"id"`
+	Title      string    `json:"title"`
+	Page       string    `json:"page"`
+	ReplyCount int       `json:"reply_count"`
+	CreatedAt  time.Time `json:"created_at"`
+}
+
+type commentNode struct {
+	Comment  *models.Comment
+	Children []*commentNode
+}
+
+// Export writes one page per archived thread of the board created since
+// opts.Since, copies their images and rebuilds the board index. Pages whose
+// content is unchanged and images already on disk are left alone, so
+// re-running an export only does incremental work.
+func (e *StaticExporter) Export(ctx context.Context, opts StaticOptions) (*StaticResult, error) {
+	boardDir := filepath.Join(opts.OutDir, opts.Board)
+	if err := os.MkdirAll(filepath.Join(boardDir, "images"), 0o755); err != nil {
+		return nil, fmt.Errorf("failed to create output directory: %w", err)
+	}
+
+	manifest, err := readManifest(boardDir)
+	if err != nil {
+		return nil, err
+	}
+
+	result := &StaticResult{}
+	for offset := 0; ; offset += exportPageSize {
+		posts, err := e.postService.GetArchivedPosts(ctx, opts.Board, opts.Since, time.Time{}, "", exportPageSize, offset)
+		if err != nil {
+			return nil, fmt.Errorf("failed to list archived posts: %w", err)
+		}
+
+		for _, post := range posts {
+			entry, err := e.exportThread(ctx, boardDir, post.ID, result)
+			if err != nil {
+				return nil, fmt.Errorf("failed to export post %d: %w", post.ID, err)
+			}
+			manifest[entry.ID] = entry
+		}
+
+		if len(posts) < exportPageSize {
+			break
+		}
+	}
+
+	if err := writeManifest(boardDir, manifest); err != nil {
+		return nil, err
+	}
+	if err := writeIndex(boardDir, opts.Board, manifest); err != nil {
+		return nil, err
+	}
+
+	css, err := templateFS.ReadFile("templates/style.css")
+	if err != nil {
+		return nil, err
+	}
+	if _, err := writeIfChanged(filepath.Join(boardDir, "style.css"), css); err != nil {
+		return nil, err
+	}
+
+	return result, nil
+}
+
+func (e *StaticExporter) exportThread(ctx context.Context, boardDir string, postID int, result *StaticResult) (*threadEntry, error) {
+	post, err := e.postService.GetPost(ctx, postID, models.Viewer{})
+	if err != nil {
+		return nil, err
+	}
+
+	comments, err := e.commentService.GetCommentsByPost(ctx, postID, models.Viewer{})
+	if err != nil {
+		return nil, err
+	}
+
+	// Point every image and attachment at a local copy
+	images := []*string{&post.ImageURL, &post.AuthorImage}
+	images = append(images, attachmentFiles(post.Attachments)...)
+	for _, comment := range comments {
+		images = append(images, &comment.ImageURL, &comment.AuthorImage)
+		images = append(images, attachmentFiles(comment.Attachments)...)
+	}
+	for _, image := range images {
+		*image, err = e.copyImage(ctx, boardDir, *image, result)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	var page bytes.Buffer
+	err = templates.ExecuteTemplate(&page, "thread.html", map[string]interface{}{
+		"Post":     post,
+		"Comments": buildCommentTree(comments),
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to render thread: %w", err)
+	}
+
+	pageName := fmt.Sprintf("%d.html", post.ID)
+	written, err := writeIfChanged(filepath.Join(boardDir, pageName), page.Bytes())
+	if err != nil {
+		return nil, err
+	}
+	if written {
+		result.ThreadsWritten++
+	} else {
+		result.ThreadsUnchanged++
+	}
+
+	return &threadEntry{
+		ID:         post.ID,
+		Title:      post.Title,
+		Page:       pageName,
+		ReplyCount: len(comments),
+		CreatedAt:  post.CreatedAt,
+	}, nil
+}
+
+// copyImage downloads a stored image into the site and returns its path
+// relative to the board directory. Images already on disk are not fetched
+// again; non-MinIO URLs are returned unchanged.
+func (e *StaticExporter) copyImage(ctx context.Context, boardDir, imageURL string, result *StaticResult) (string, error) {
+	bucket, objectName, ok := storage.ParseMinioURL(imageURL)
+	if !ok {
+		return imageURL, nil
+	}
+
+	// Object names embed client filenames, so never use them as paths
+	sum := sha256.Sum256([]byte(bucket + "/" + objectName))
+	localName := hex.EncodeToString(sum[:12]) + storage.ObjectExt(objectName)
+	relPath := "images/" + localName
+	fullPath := filepath.Join(boardDir, "images", localName)
+
+	if _, err := os.Stat(fullPath); err == nil {
+		return relPath, nil
+	}
+
+	data, _, err := e.storage.GetImage(ctx, bucket, objectName)
+	if err != nil {
+		log.Printf("Warning: Failed to copy image %s: %v", imageURL, err)
+		return "", nil
+	}
+	if err := writeFileAtomic(fullPath, data); err != nil {
+		return "", err
+	}
+
+	result.ImagesCopied++
+	return relPath, nil
+}
+
+// attachmentFiles returns the file and thumbnail URLs of attachments for
+// rewriting in place
+func attachmentFiles(attachments []*models.Attachment) []*string {
+	files := make([]*string, 0, 2*len(attachments))
+	for _, attachment := range attachments {
+		files = append(files, &attachment.URL, &attachment.ThumbnailURL)
+	}
+	return files
+}
+
+// buildCommentTree nests comments under the comment they reply to
+func buildCommentTree(comments []*models.Comment) []*commentNode {
+	nodes := make(map[int]*commentNode, len(comments))
+	for _, comment := range comments {
+		nodes[comment.ID] = &commentNode{Comment: comment}
+	}
+
+	var roots []*commentNode
+	for _, comment := range comments {
+		node := nodes[comment.ID]
+		if comment.ReplyToCommentID != nil {
+			if parent, ok := nodes[*comment.ReplyToCommentID]; ok {
+				parent.Children = append(parent.Children, node)
+				continue
+			}
+		}
+		roots = append(roots, node)
+	}
+
+	return roots
+}
+
+func readManifest(boardDir string) (map[int]*threadEntry, error) {
+	manifest := make(map[int]*threadEntry)
+
+	data, err := os.ReadFile(filepath.Join(boardDir, manifestFile))
+	if errors.Is(err, os.ErrNotExist) {
+		return manifest, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read manifest: %w", err)
+	}
+
+	var entries []*threadEntry
+	if err := json.Unmarshal(data, &entries); err != nil {
+		return nil, fmt.Errorf("failed to parse manifest: %w", err)
+	}
+	for _, entry := range entries {
+		manifest[entry.ID] = entry
+	}
+
+	return manifest, nil
+}
+
+func sortedEntries(manifest map[int]*threadEntry) []*threadEntry {
+	entries := make([]*threadEntry, 0, len(manifest))
+	for _, entry := range manifest {
+		entries = append(entries, entry)
+	}
+	sort.Slice(entries, func(i, j int) bool {
+		if !entries[i].CreatedAt.Equal(entries[j].CreatedAt) {
+			return entries[i].CreatedAt.After(entries[j].CreatedAt)
+		}
+		return entries[i].ID > entries[j].ID
+	})
+	return entries
+}
+
+func writeManifest(boardDir string, manifest map[int]*threadEntry) error {
+	data, err := json.MarshalIndent(sortedEntries(manifest), "", "  ")
+	if err != nil {
+		return err
+	}
+	_, err = writeIfChanged(filepath.Join(boardDir, manifestFile), data)
+	return err
+}
+
+func writeIndex(boardDir, board string, manifest map[int]*threadEntry) error {
+	var page bytes.Buffer
+	err := templates.ExecuteTemplate(&page, "index.html", map[string]interface{}{
+		"Board":   board,
+		"Threads": sortedEntries(manifest),
+	})
+	if err != nil {
+		return fmt.Errorf("failed to render index: %w", err)
+	}
+
+	_, err = writeIfChanged(filepath.Join(boardDir, "index.html"), page.Bytes())
+	return err
+}
+
+// writeIfChanged writes data to path unless the file already holds it
+func writeIfChanged(path string, data []byte) (bool, error) {
+	existing, err := os.ReadFile(path)
+	if err == nil && bytes.Equal(existing, data) {
+		return false, nil
+	}
+	if err := writeFileAtomic(path, data); err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
+// writeFileAtomic writes through a temporary file so an interrupted export
+// never leaves a truncated file behind
+func writeFileAtomic(path string, data []byte) error {
+	tmp, err := os.CreateTemp(filepath.Dir(path), ".tmp-*")
+	if err != nil {
+		return fmt.Errorf("failed to create temporary file: %w", err)
+	}
+	defer os.Remove(tmp.Name())
+
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return fmt.Errorf("failed to write %s: %w", path, err)
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	if err := os.Chmod(tmp.Name(), 0o644); err != nil {
+		return err
+	}
+
+	return os.Rename(tmp.Name(), path)
+}
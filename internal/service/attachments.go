@@ -0,0 +1,410 @@
+package service
+
+import (
+	"1337b04rd/internal/adapters/storage"
+	"1337b04rd/internal/domain/models"
+	"1337b04rd/internal/domain/ports"
+	"1337b04rd/pkg/imagehash"
+	"1337b04rd/pkg/media"
+	"1337b04rd/pkg/thumbnail"
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"strings"
+	"time"
+	"unicode/utf8"
+)
+
+// maxFilenameLength matches the filename column of the attachments table
+const maxFilenameLength = 255
+
+// uploadContent is the file of an upload, read in place
+type uploadContent interface {
+	io.ReaderAt
+	Size() int64
+	Close() error
+}
+
+// formContent is the file of an upload posted with the form
+type formContent struct {
+	*bytes.Reader
+}
+
+func (formContent) Close() error {
+	return nil
+}
+
+// openUpload returns the file of an upload: its data when it was posted
+// with the form, or a reader over the object of a claimed upload, which
+// fetches only the parts that are read
+func openUpload(ctx context.Context, objects *storage.MinioClient, file *models.AttachmentUpload) (uploadContent, error) {
+	if file.ObjectURL == "" {
+		return formContent{bytes.NewReader(file.Data)}, nil
+	}
+
+	bucket, objectName, ok := storage.ParseMinioURL(file.ObjectURL)
+	if !ok {
+		return nil, fmt.Errorf("invalid upload object URL %s", file.ObjectURL)
+	}
+	return objects.ReadObject(ctx, bucket, objectName)
+}
+
+// storeAttachments checks the uploads against the board's limits, the
+// accepted video types and the banned images, then stores each file
+// together with its thumbnail in bucket, taking a reference on every
+// object. Files matching a ban are rejected, or held for review if the
+// board says so. The returned attachments are not saved yet. On error
+// every reference taken is released again. Claimed uploads are checked in
+// place and copied to their content hash by the storage server; their
+// objects are left for the caller to remove once the work is committed.
+func storeAttachments(ctx context.Context, objects *storage.MinioClient, objectRepo ports.ObjectRepository, imageBanRepo ports.ImageBanRepository, bucket string, board *models.Board, videoTypes []string, uploads []*models.AttachmentUpload, now time.Time) ([]*models.Attachment, error) {
+	if len(uploads) > board.MaxAttachments {
+		return nil, fmt.Errorf("%w: /%s/ allows at most %d per post", models.ErrTooManyAttachments, board.Slug, board.MaxAttachments)
+	}
+
+	// Check every file before anything is uploaded
+	attachments := make([]*models.Attachment, 0, len(uploads))
+	probes := make([]*media.Info, 0, len(uploads))
+	contents := make([]uploadContent, 0, len(uploads))
+	defer func() {
+		for _, content := range contents {
+			content.Close()
+		}
+	}()
+	for i, file := range uploads {
+		content, err := openUpload(ctx, objects, file)
+		if err != nil {
+			return nil, err
+		}
+		contents = append(contents, content)
+
+		if content.Size() > board.MaxFileSize {
+			return nil, fmt.Errorf("%w: %s is larger than the %d KB allowed on /%s/", models.ErrInvalidAttachment, file.Filename, board.MaxFileSize>>10, board.Slug)
+		}
+		if utf8.RuneCountInString(file.AltText) > models.MaxAltTextLength {
+			return nil, fmt.Errorf("%w: alt text of %s is longer than %d characters", models.ErrInvalidAttachment, file.Filename, models.MaxAltTextLength)
+		}
+
+		// The stored content type comes from the file itself, not the client
+		info, err := media.Probe(content, content.Size())
+		if errors.Is(err, media.ErrUnsupported) || errors.Is(err, media.ErrMalformed) || errors.Is(err, media.ErrTooLarge) {
+			return nil, fmt.Errorf("%w: %s is not a supported image or video", models.ErrInvalidAttachment, file.Filename)
+		}
+		if err != nil {
+			return nil, err
+		}
+		if info.Video && !containsString(videoTypes, info.ContentType) {
+			return nil, fmt.Errorf("%w: %s videos are not accepted", models.ErrInvalidAttachment, info.ContentType)
+		}
+		if info.Video || info.Animated {
+			if info.Video && info.Duration <= 0 {
+				return nil, fmt.Errorf("%w: the length of %s could not be determined", models.ErrInvalidAttachment, file.Filename)
+			}
+			if info.Duration > time.Duration(board.MaxVideoDuration)*time.Second {
+				return nil, fmt.Errorf("%w: %s is longer than the %d seconds allowed on /%s/", models.ErrInvalidAttachment, file.Filename, board.MaxVideoDuration, board.Slug)
+			}
+		}
+
+		probes = append(probes, info)
+		attachments = append(attachments, &models.Attachment{
+			Position:    i,
+			Filename:    truncate(file.Filename, maxFilenameLength),
+			ContentType: info.ContentType,
+			Size:        content.Size(),
+			Width:       info.Width,
+			Height:      info.Height,
+			Duration:    info.Duration.Seconds(),
+			Spoiler:     file.Spoiler,
+			AltText:     file.AltText,
+			CreatedAt:   now,
+		})
+	}
+
+	// Render the previews and hash them against the banned images before
+	// anything is stored
+	var bans []*models.ImageBan
+	thumbs := make([][]byte, len(attachments))
+	for i, attachment := range attachments {
+		// Clips get a thumbnail only when their container embeds a poster
+		// frame; images and GIFs are previewed by their first frame
+		if probes[i].Video {
+			if probes[i].Poster != nil {
+				poster, err := thumbnail.Generate(probes[i].Poster, thumbnail.MaxSize)
+				if err != nil {
+					log.Printf("Warning: Failed to render poster frame of %s: %v", attachment.Filename, err)
+				}
+				thumbs[i] = poster
+			}
+		} else {
+			thumb, err := thumbnail.GenerateFrom(io.NewSectionReader(contents[i], 0, contents[i].Size()), thumbnail.MaxSize)
+			if err != nil {
+				return nil, fmt.Errorf("%w: %s could not be decoded", models.ErrInvalidAttachment, attachment.Filename)
+			}
+			thumbs[i] = thumb
+		}
+		if thumbs[i] == nil {
+			continue
+		}
+
+		// Hashing the preview rather than the original makes re-encoded
+		// copies of any size land on nearly the same pixels
+		hash, err := imagehash.Compute(thumbs[i])
+		if err != nil {
+			return nil, err
+		}
+		attachment.ImageHash = hash.String()
+
+		if bans == nil {
+			if bans, err = imageBanRepo.GetAll(ctx); err != nil {
+				return nil, err
+			}
+		}
+		if ban := matchImageBan(bans, hash); ban != nil {
+			if board.ImageBanAction != models.ImageBanReview {
+				return nil, fmt.Errorf("%w: %s matches a banned image", models.ErrBannedImage, attachment.Filename)
+			}
+			attachment.Held = true
+		}
+	}
+
+	for i, attachment := range attachments {
+		// Held files stay private until a moderator approves them
+		prefix := ""
+		if attachment.Held {
+			prefix = storage.HeldPrefix
+		}
+
+		var err error
+		if uploads[i].ObjectURL != "" {
+			attachment.URL, err = storeClaimedObject(ctx, objects, objectRepo, uploads[i].ObjectURL, prefix, attachment.ContentType)
+		} else {
+			attachment.URL, err = storeNamedObject(ctx, objects, objectRepo, bucket, prefix+storage.ContentObjectName(uploads[i].Data, attachment.ContentType), uploads[i].Data, attachment.ContentType)
+		}
+		if err != nil {
+			releaseAttachmentObjects(ctx, objects, objectRepo, attachments)
+			return nil, err
+		}
+		if thumbs[i] != nil {
+			attachment.ThumbnailURL, err = storeNamedObject(ctx, objects, objectRepo, bucket, prefix+storage.ContentObjectName(thumbs[i], "image/jpeg"), thumbs[i], "image/jpeg")
+			if err != nil {
+				releaseAttachmentObjects(ctx, objects, objectRepo, attachments)
+				return nil, err
+			}
+		}
+	}
+
+	return attachments, nil
+}
+
+// imageURL returns the URL of the first attachment not held for review,
+// which doubles as the image of its post or comment
+func imageURL(attachments []*models.Attachment) string {
+	for _, attachment := range attachments {
+		if !attachment.Held {
+			return attachment.URL
+		}
+	}
+	return ""
+}
+
+// matchImageBan returns the first ban within whose threshold hash falls
+func matchImageBan(bans []*models.ImageBan, hash imagehash.Hash) *models.ImageBan {
+	for _, ban := range bans {
+		banned, err := imagehash.Parse(ban.Hash)
+		if err != nil {
+			continue
+		}
+		if imagehash.Distance(hash, banned) <= ban.Threshold {
+			return ban
+		}
+	}
+	return nil
+}
+
+// releaseAttachmentObjects drops the references attachments hold on their
+// files, logging the ones that could not be released
+func releaseAttachmentObjects(ctx context.Context, objects *storage.MinioClient, objectRepo ports.ObjectRepository, attachments []*models.Attachment) {
+	for _, attachment := range attachments {
+		for _, objectURL := range []string{attachment.URL, attachment.ThumbnailURL} {
+			if objectURL == "" {
+				continue
+			}
+			if err := releaseObject(ctx, objects, objectRepo, objectURL); err != nil {
+				log.Printf("Warning: Failed to release attachment object %s: %v", objectURL, err)
+			}
+		}
+	}
+}
+
+// storeObject stores data in bucket under its content hash and takes a
+// reference on the object. Identical files share one object, which is only
+// written the first time.
+func storeObject(ctx context.Context, objects *storage.MinioClient, objectRepo ports.ObjectRepository, bucket string, data []byte, contentType string) (string, error) {
+	return storeNamedObject(ctx, objects, objectRepo, bucket, storage.ContentObjectName(data, contentType), data, contentType)
+}
+
+// storeNamedObject is storeObject for a content hash name that may carry a
+// prefix, such as storage.HeldPrefix
+func storeNamedObject(ctx context.Context, objects *storage.MinioClient, objectRepo ports.ObjectRepository, bucket, objectName string, data []byte, contentType string) (string, error) {
+	return acquireObject(ctx, objectRepo, bucket, objectName, func() (string, error) {
+		return objects.PutImageIfMissing(ctx, bucket, objectName, data, contentType)
+	})
+}
+
+// storeClaimedObject is storeNamedObject for the object of a claimed
+// upload. The object is hashed as a stream and copied to its prefixed
+// content hash by the storage server, so the file is never held in memory.
+func storeClaimedObject(ctx context.Context, objects *storage.MinioClient, objectRepo ports.ObjectRepository, objectURL, prefix, contentType string) (string, error) {
+	bucket, srcName, ok := storage.ParseMinioURL(objectURL)
+	if !ok {
+		return "", fmt.Errorf("invalid upload object URL %s", objectURL)
+	}
+
+	objectName, err := objects.HashObjectName(ctx, bucket, srcName, contentType)
+	if err != nil {
+		return "", err
+	}
+	objectName = prefix + objectName
+	return acquireObject(ctx, objectRepo, bucket, objectName, func() (string, error) {
+		return objects.CopyImageIfMissing(ctx, bucket, srcName, objectName, contentType)
+	})
+}
+
+// publishHeldObject copies a held file to its public name and takes a
+// reference on the copy. Files stored before held files were kept apart
+// are public already; for them ok is false and nothing is done.
+func publishHeldObject(ctx context.Context, objects *storage.MinioClient, objectRepo ports.ObjectRepository, objectURL, contentType string) (publicURL string, ok bool, err error) {
+	bucket, heldName, isMinio := storage.ParseMinioURL(objectURL)
+	if !isMinio || !strings.HasPrefix(heldName, storage.HeldPrefix) {
+		return objectURL, false, nil
+	}
+
+	objectName := strings.TrimPrefix(heldName, storage.HeldPrefix)
+	publicURL, err = acquireObject(ctx, objectRepo, bucket, objectName, func() (string, error) {
+		return objects.CopyImageIfMissing(ctx, bucket, heldName, objectName, contentType)
+	})
+	if err != nil {
+		return "", false, err
+	}
+	return publicURL, true, nil
+}
+
+// acquireObject takes a reference on an object and then writes it with
+// store, dropping the reference again if that fails
+func acquireObject(ctx context.Context, objectRepo ports.ObjectRepository, bucket, objectName string, store func() (string, error)) (string, error) {
+	if err := objectRepo.Acquire(ctx, bucket, objectName); err != nil {
+		return "", err
+	}
+
+	objectURL, err := store()
+	if err != nil {
+		if releaseErr := objectRepo.Release(ctx, bucket, objectName, func() error { return nil }); releaseErr != nil {
+			log.Printf("Warning: Failed to release object %s after upload failed: %v", objectName, releaseErr)
+		}
+		return "", err
+	}
+	return objectURL, nil
+}
+
+// releaseObject drops a reference taken by storeObject and deletes the
+// object along with the last one. Objects stored before they were counted
+// have a single owner and are deleted right away. URLs that do not point at
+// MinIO are ignored.
+func releaseObject(ctx context.Context, objects *storage.MinioClient, objectRepo ports.ObjectRepository, objectURL string) error {
+	bucket, objectName, ok := storage.ParseMinioURL(objectURL)
+	if !ok {
+		return nil
+	}
+
+	return objectRepo.Release(ctx, bucket, objectName, func() error {
+		return objects.DeleteImage(ctx, bucket, objectName)
+	})
+}
+
+// releaseObjects releases objects stored with storeObject, logging the ones
+// that could not be released
+func releaseObjects(ctx context.Context, objects *storage.MinioClient, objectRepo ports.ObjectRepository, objectURLs []string) {
+	for _, objectURL := range objectURLs {
+		if err := releaseObject(ctx, objects, objectRepo, objectURL); err != nil {
+			log.Printf("Warning: Failed to release object %s: %v", objectURL, err)
+		}
+	}
+}
+
+// loadAttachments fills in Attachments for the posts and their loaded
+// comments, leaving out the ones held for review
+func loadAttachments(ctx context.Context, attachmentRepo ports.AttachmentRepository, posts []*models.Post) error {
+	if len(posts) == 0 {
+		return nil
+	}
+
+	postIDs := make([]int, 0, len(posts))
+	postsByID := make(map[int]*models.Post, len(posts))
+	commentsByID := make(map[int]*models.Comment)
+	for _, post := range posts {
+		post.Attachments = []*models.Attachment{}
+		postIDs = append(postIDs, post.ID)
+		postsByID[post.ID] = post
+		for _, comment := range post.Comments {
+			comment.Attachments = []*models.Attachment{}
+			commentsByID[comment.ID] = comment
+		}
+	}
+
+	attachments, err := attachmentRepo.GetByPostIDs(ctx, postIDs)
+	if err != nil {
+		return err
+	}
+
+	for _, attachment := range attachments {
+		if attachment.Held {
+			continue
+		}
+		if attachment.CommentID != nil {
+			if comment, ok := commentsByID[*attachment.CommentID]; ok {
+				comment.Attachments = append(comment.Attachments, attachment)
+			}
+			continue
+		}
+		if post, ok := postsByID[attachment.PostID]; ok {
+			post.Attachments = append(post.Attachments, attachment)
+		}
+	}
+
+	return nil
+}
+
+// loadCommentAttachments fills in Attachments for the given comments,
+// leaving out the ones held for review
+func loadCommentAttachments(ctx context.Context, attachmentRepo ports.AttachmentRepository, comments []*models.Comment) error {
+	if len(comments) == 0 {
+		return nil
+	}
+
+	ids := make([]int, 0, len(comments))
+	byID := make(map[int]*models.Comment, len(comments))
+	for _, comment := range comments {
+		comment.Attachments = []*models.Attachment{}
+		ids = append(ids, comment.ID)
+		byID[comment.ID] = comment
+	}
+
+	attachments, err := attachmentRepo.GetByCommentIDs(ctx, ids)
+	if err != nil {
+		return err
+	}
+
+	for _, attachment := range attachments {
+		if attachment.Held {
+			continue
+		}
+		if comment, ok := byID[*attachment.CommentID]; ok {
+			comment.Attachments = append(comment.Attachments, attachment)
+		}
+	}
+
+	return nil
+}
@@ -4,61 +4,213 @@ import (
 	"1337b04rd/internal/adapters/storage"
 	"1337b04rd/internal/domain/models"
 	"1337b04rd/internal/domain/ports"
+	"1337b04rd/pkg/markup"
 	"context"
-	"errors"
-	"mime/multipart"
 	"time"
 )
 
 type CommentService struct {
-	commentRepo ports.CommentRepository
-	storage     *storage.MinioClient
+	uow            ports.UnitOfWork
+	commentRepo    ports.CommentRepository
+	postRepo       ports.PostRepository
+	referenceRepo  ports.CommentReferenceRepository
+	boardRepo      ports.BoardRepository
+	attachmentRepo ports.AttachmentRepository
+	objectRepo     ports.ObjectRepository
+	imageBanRepo   ports.ImageBanRepository
+	quarantineRepo ports.QuarantineRepository
+	filter         ports.ContentFilter
+	storage        *storage.MinioClient
+	videoTypes     []string
+
+	// editWindow is how long after posting authors may edit a comment;
+	// zero or less leaves edits open
+	editWindow time.Duration
 }
 
-func NewCommentService(commentRepo ports.CommentRepository, storage *storage.MinioClient) *CommentService {
+func NewCommentService(uow ports.UnitOfWork, commentRepo ports.CommentRepository, postRepo ports.PostRepository, referenceRepo ports.CommentReferenceRepository, boardRepo ports.BoardRepository, attachmentRepo ports.AttachmentRepository, objectRepo ports.ObjectRepository, imageBanRepo ports.ImageBanRepository, quarantineRepo ports.QuarantineRepository, filter ports.ContentFilter, storage *storage.MinioClient, videoTypes []string, editWindow time.Duration) *CommentService {
 	return &CommentService{
-		commentRepo: commentRepo,
-		storage:     storage,
+		uow:            uow,
+		commentRepo:    commentRepo,
+		postRepo:       postRepo,
+		referenceRepo:  referenceRepo,
+		boardRepo:      boardRepo,
+		attachmentRepo: attachmentRepo,
+		objectRepo:     objectRepo,
+		imageBanRepo:   imageBanRepo,
+		quarantineRepo: quarantineRepo,
+		filter:         filter,
+		storage:        storage,
+		videoTypes:     videoTypes,
+		editWindow:     editWindow,
 	}
 }
 
-func (s *CommentService) CreateComment(ctx context.Context, comment *models.Comment, imageFile multipart.File, imageHeader *multipart.FileHeader) error {
+func (s *CommentService) CreateComment(ctx context.Context, comment *models.Comment, uploads []*models.AttachmentUpload) error {
+	// Replies are only accepted on existing, unlocked threads the author
+	// can see
+	post, err := s.postRepo.GetByID(ctx, comment.PostID, models.Viewer{SessionID: comment.AuthorID})
+	if err != nil {
+		return err
+	}
+	if err := checkReplyTarget(post, comment.AuthorID); err != nil {
+		return err
+	}
+
 	// Set creation time
 	comment.CreatedAt = time.Now()
 
-	// Handle image upload if provided
-	if imageFile != nil && imageHeader != nil {
-		imageURL, err := s.storage.UploadCommentImage(ctx, imageFile, imageHeader.Filename, imageHeader.Header.Get("Content-Type"))
+	// Run the word filters of the thread's board before anything is stored
+	verdict, err := s.filter.Apply(ctx, post.Board, &comment.Title, &comment.Content)
+	if err != nil {
+		return err
+	}
+	comment.Flagged = verdict.Flagged
+	comment.Visibility, err = initialVisibility(ctx, s.quarantineRepo, comment.AuthorID, comment.IPHash, verdict.Hidden)
+	if err != nil {
+		return err
+	}
+
+	// Cache the rendered markup alongside the raw content
+	comment.ContentHTML = markup.Render(comment.Content)
+
+	board, err := s.getBoard(ctx, post.Board)
+	if err != nil {
+		return err
+	}
+	err = s.uow.Do(ctx, func(work ports.Work) error {
+		err := claimUploads(ctx, work.Uploads(), s.storage, s.storage.GetBucketName("comment"), comment.AuthorID, uploads, comment.CreatedAt)
 		if err != nil {
 			return err
 		}
-		comment.ImageURL = imageURL
-	}
 
-	// Create comment in database
-	err := s.commentRepo.Create(ctx, comment)
+		// Store the attachments; the first one doubles as the comment
+		// image. Their files are released again if the reply is not saved.
+		attachments, err := storeAttachments(ctx, s.storage, s.objectRepo, s.imageBanRepo, s.storage.GetBucketName("comment"), board, s.videoTypes, uploads, comment.CreatedAt)
+		if err != nil {
+			return err
+		}
+		work.OnRollback(func(ctx context.Context) {
+			releaseAttachmentObjects(ctx, s.storage, s.objectRepo, attachments)
+		})
+		comment.ImageURL = imageURL(attachments)
+
+		// Hold the thread until the reply is saved, so it cannot be
+		// archived, locked or deleted in between
+		post, err := work.Posts().Lock(ctx, comment.PostID)
+		if err != nil {
+			return err
+		}
+		if err := checkReplyTarget(post, comment.AuthorID); err != nil {
+			return err
+		}
+
+		// Create comment in database
+		if err := work.Comments().Create(ctx, comment); err != nil {
+			return err
+		}
+
+		if len(attachments) > 0 {
+			if _, err := work.Attachments().Replace(ctx, comment.PostID, &comment.ID, attachments); err != nil {
+				return err
+			}
+		}
+		comment.Attachments = attachments
+
+		// Store ">>id" quote references from the content
+		err = saveCommentReferences(ctx, work.Comments(), work.Posts(), work.References(), comment)
+		if err != nil {
+			return err
+		}
+
+		// Bump the thread unless the reply was saged; pending replies must
+		// not give themselves away by bumping either
+		if !comment.Sage && comment.Visibility == models.VisibilityVisible {
+			return work.Posts().Bump(ctx, comment.PostID, comment.CreatedAt)
+		}
+		return nil
+	})
 	if err != nil {
 		return err
 	}
+	removeClaimedObjects(ctx, s.storage, uploads)
+
+	comment.Backlinks = []*models.CommentReference{}
+	return nil
+}
 
+// checkReplyTarget checks that a thread takes replies from authorID
+func checkReplyTarget(post *models.Post, authorID string) error {
+	if post == nil || !(models.Viewer{SessionID: authorID}).CanSee(post.Visibility, post.AuthorID) {
+		return models.ErrPostNotFound
+	}
+	if post.IsArchive {
+		return models.ErrThreadArchived
+	}
+	if post.IsLocked {
+		return models.ErrThreadLocked
+	}
 	return nil
 }
 
-func (s *CommentService) GetComment(ctx context.Context, id int) (*models.Comment, error) {
+// getBoard looks up the board a thread lives on
+func (s *CommentService) getBoard(ctx context.Context, slug string) (*models.Board, error) {
+	board, err := s.boardRepo.GetBySlug(ctx, slug)
+	if err != nil {
+		return nil, err
+	}
+	if board == nil {
+		return nil, models.ErrBoardNotFound
+	}
+	return board, nil
+}
+
+// GetComment returns a comment if viewer may see it
+func (s *CommentService) GetComment(ctx context.Context, id int, viewer models.Viewer) (*models.Comment, error) {
 	comment, err := s.commentRepo.GetByID(ctx, id)
 	if err != nil {
 		return nil, err
 	}
 
-	if comment == nil {
-		return nil, errors.New("comment not found")
+	if comment == nil || !viewer.CanSee(comment.Visibility, comment.AuthorID) {
+		return nil, models.ErrCommentNotFound
+	}
+
+	err = loadCommentReferences(ctx, s.referenceRepo, []*models.Comment{comment}, viewer)
+	if err != nil {
+		return nil, err
+	}
+
+	err = loadCommentAttachments(ctx, s.attachmentRepo, []*models.Comment{comment})
+	if err != nil {
+		return nil, err
 	}
 
 	return comment, nil
 }
 
-func (s *CommentService) GetCommentsByPost(ctx context.Context, postID int) ([]*models.Comment, error) {
-	comments, err := s.commentRepo.GetByPostID(ctx, postID)
+// GetCommentsByPost returns the replies viewer may see in a thread, which
+// is not found unless viewer may see the thread itself
+func (s *CommentService) GetCommentsByPost(ctx context.Context, postID int, viewer models.Viewer) ([]*models.Comment, error) {
+	post, err := s.postRepo.GetByID(ctx, postID, viewer)
+	if err != nil {
+		return nil, err
+	}
+	if post == nil {
+		return nil, models.ErrPostNotFound
+	}
+
+	comments, err := s.commentRepo.GetByPostID(ctx, postID, viewer)
+	if err != nil {
+		return nil, err
+	}
+
+	err = loadCommentReferences(ctx, s.referenceRepo, comments, viewer)
+	if err != nil {
+		return nil, err
+	}
+
+	err = loadCommentAttachments(ctx, s.attachmentRepo, comments)
 	if err != nil {
 		return nil, err
 	}
@@ -66,54 +218,180 @@ func (s *CommentService) GetCommentsByPost(ctx context.Context, postID int) ([]*
 	return comments, nil
 }
 
-func (s *CommentService) UpdateComment(ctx context.Context, comment *models.Comment, imageFile multipart.File, imageHeader *multipart.FileHeader) error {
+// UpdateComment saves an author's edit of a comment. comment.AuthorID is the
+// editing session and comment.Version the version the edit was made from.
+func (s *CommentService) UpdateComment(ctx context.Context, comment *models.Comment, uploads []*models.AttachmentUpload) error {
 	// Check if comment exists
 	existingComment, err := s.commentRepo.GetByID(ctx, comment.ID)
 	if err != nil {
 		return err
 	}
 
-	if existingComment == nil {
-		return errors.New("comment not found")
+	if existingComment == nil || !(models.Viewer{SessionID: comment.AuthorID}).CanSee(existingComment.Visibility, existingComment.AuthorID) {
+		return models.ErrCommentNotFound
+	}
+
+	// Stale or foreign edits are turned away before any files are stored;
+	// the repository checks both again when it writes the edit
+	if existingComment.AuthorID != comment.AuthorID {
+		return models.ErrNotAuthor
+	}
+	if existingComment.Version != comment.Version {
+		return models.ErrVersionConflict
+	}
+
+	// Replies in archived threads are read-only
+	post, err := s.postRepo.GetByID(ctx, existingComment.PostID, models.Staff)
+	if err != nil {
+		return err
+	}
+	if post == nil {
+		return models.ErrPostNotFound
+	}
+	if post.IsArchive {
+		return models.ErrThreadArchived
+	}
+
+	now := time.Now()
+	if s.editWindow > 0 && now.Sub(existingComment.CreatedAt) > s.editWindow {
+		return models.ErrEditWindowClosed
+	}
+
+	// Run the word filters on the edit; an edit never clears an earlier
+	// verdict
+	verdict, err := s.filter.Apply(ctx, post.Board, &comment.Title, &comment.Content)
+	if err != nil {
+		return err
+	}
+	comment.Flagged = existingComment.Flagged || verdict.Flagged
+	comment.Visibility = existingComment.Visibility
+	if verdict.Hidden {
+		comment.Visibility = models.VisibilityPending
 	}
 
-	// Handle image upload if provided
-	if imageFile != nil && imageHeader != nil {
-		imageURL, err := s.storage.UploadCommentImage(ctx, imageFile, imageHeader.Filename, imageHeader.Header.Get("Content-Type"))
+	// Keep existing attachments if no new files were provided
+	comment.ImageURL = existingComment.ImageURL
+	var board *models.Board
+	if len(uploads) > 0 {
+		board, err = s.getBoard(ctx, post.Board)
 		if err != nil {
 			return err
 		}
-		comment.ImageURL = imageURL
-	} else {
-		// Keep existing image if no new image provided
-		comment.ImageURL = existingComment.ImageURL
 	}
 
-	// Update comment in database
-	err = s.commentRepo.Update(ctx, comment)
+	// Cache the rendered markup alongside the raw content
+	comment.ContentHTML = markup.Render(comment.Content)
+	comment.EditedAt = now
+	comment.PostID = existingComment.PostID
+
+	var removed []*models.Attachment
+	err = s.uow.Do(ctx, func(work ports.Work) error {
+		if len(uploads) > 0 {
+			err := claimUploads(ctx, work.Uploads(), s.storage, s.storage.GetBucketName("comment"), comment.AuthorID, uploads, now)
+			if err != nil {
+				return err
+			}
+			attachments, err := storeAttachments(ctx, s.storage, s.objectRepo, s.imageBanRepo, s.storage.GetBucketName("comment"), board, s.videoTypes, uploads, now)
+			if err != nil {
+				return err
+			}
+			work.OnRollback(func(ctx context.Context) {
+				releaseAttachmentObjects(ctx, s.storage, s.objectRepo, attachments)
+			})
+			removed, err = work.Attachments().Replace(ctx, comment.PostID, &comment.ID, attachments)
+			if err != nil {
+				return err
+			}
+			comment.ImageURL = imageURL(attachments)
+		}
+
+		// Save the edit, keeping the previous version as a revision
+		if err := work.Comments().Edit(ctx, comment, comment.AuthorID); err != nil {
+			return err
+		}
+
+		// Re-parse quote references from the edited content
+		return saveCommentReferences(ctx, work.Comments(), work.Posts(), work.References(), comment)
+	})
 	if err != nil {
 		return err
 	}
+	removeClaimedObjects(ctx, s.storage, uploads)
 
-	return nil
-}
+	// Replaced files are only released once the comment points at the new ones
+	releaseAttachmentObjects(ctx, s.storage, s.objectRepo, removed)
 
-func (s *CommentService) DeleteComment(ctx context.Context, id int) error {
-	// Check if comment exists
-	existingComment, err := s.commentRepo.GetByID(ctx, id)
+	err = loadCommentReferences(ctx, s.referenceRepo, []*models.Comment{comment}, models.Viewer{SessionID: comment.AuthorID})
 	if err != nil {
 		return err
 	}
 
-	if existingComment == nil {
-		return errors.New("comment not found")
+	return loadCommentAttachments(ctx, s.attachmentRepo, []*models.Comment{comment})
+}
+
+// GetCommentRevisions returns the earlier versions of a comment viewer may
+// see, oldest first, each with its changes to the next version
+func (s *CommentService) GetCommentRevisions(ctx context.Context, id int, viewer models.Viewer) ([]*models.Revision, error) {
+	comment, err := s.commentRepo.GetByID(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	if comment == nil || !viewer.CanSee(comment.Visibility, comment.AuthorID) {
+		return nil, models.ErrCommentNotFound
+	}
+
+	revisions, err := s.commentRepo.GetRevisions(ctx, id)
+	if err != nil {
+		return nil, err
 	}
+	return diffRevisions(revisions, comment.Title, comment.Content), nil
+}
+
+func (s *CommentService) DeleteComment(ctx context.Context, id int) error {
+	var removed []*models.Attachment
+	err := s.uow.Do(ctx, func(work ports.Work) error {
+		existingComment, err := work.Comments().GetByID(ctx, id)
+		if err != nil {
+			return err
+		}
+		if existingComment == nil {
+			return models.ErrCommentNotFound
+		}
+
+		// Deleting a comment cascades to its replies, so the attachments to
+		// release are the ones of the thread that are gone afterwards. The
+		// thread is held so no reply comes or goes in between.
+		if _, err := work.Posts().Lock(ctx, existingComment.PostID); err != nil {
+			return err
+		}
+		before, err := work.Attachments().GetByPostIDs(ctx, []int{existingComment.PostID})
+		if err != nil {
+			return err
+		}
 
-	// Delete comment from database
-	err = s.commentRepo.Delete(ctx, id)
+		if err := work.Comments().Delete(ctx, id); err != nil {
+			return err
+		}
+
+		after, err := work.Attachments().GetByPostIDs(ctx, []int{existingComment.PostID})
+		if err != nil {
+			return err
+		}
+		remaining := make(map[int]bool, len(after))
+		for _, attachment := range after {
+			remaining[attachment.ID] = true
+		}
+		for _, attachment := range before {
+			if !remaining[attachment.ID] {
+				removed = append(removed, attachment)
+			}
+		}
+		return nil
+	})
 	if err != nil {
 		return err
 	}
 
+	releaseAttachmentObjects(ctx, s.storage, s.objectRepo, removed)
 	return nil
 }
@@ -0,0 +1,331 @@
+package service
+
+import (
+	"1337b04rd/internal/domain/models"
+	"1337b04rd/internal/domain/ports"
+	"context"
+	"fmt"
+	"log"
+	"regexp"
+	"strings"
+	"sync/atomic"
+	"time"
+	"unicode/utf8"
+)
+
+const (
+	// maxFilterPatternLength keeps rules small enough to compile and run
+	// quickly; Go regular expressions run in linear time, but their size
+	// still multiplies the cost of every match
+	maxFilterPatternLength = 500
+
+	// maxFilterTextLength bounds replacements and rejection messages
+	maxFilterTextLength = 500
+
+	// defaultRejectMessage is shown when a rejecting rule has no message
+	defaultRejectMessage = "your post contains a filtered phrase"
+)
+
+// compiledRule is a filter rule ready to be matched
+type compiledRule struct {
+	rule *models.FilterRule
+	re   *regexp.Regexp
+}
+
+// filterResult is the outcome of running the rules over copies of the
+// filtered fields
+type filterResult struct {
+	fields   []string
+	verdict  models.FilterVerdict
+	rejected *models.FilterRule
+	hits     []int
+	timedOut bool
+}
+
+// FilterService runs the word filters over new and edited posts and
+// comments. The compiled rules are kept in memory and swapped out whole on
+// every change, so requests never wait on a reload.
+type FilterService struct {
+	filterRepo  ports.FilterRuleRepository
+	boardRepo   ports.BoardRepository
+	postRepo    ports.PostRepository
+	commentRepo ports.CommentRepository
+
+	// budget bounds how long the rules may take on one post or comment;
+	// zero or less leaves them unbounded
+	budget time.Duration
+
+	rules atomic.Pointer[[]*compiledRule]
+}
+
+func NewFilterService(filterRepo ports.FilterRuleRepository, boardRepo ports.BoardRepository, postRepo ports.PostRepository, commentRepo ports.CommentRepository, budget time.Duration) *FilterService {
+	return &FilterService{
+		filterRepo:  filterRepo,
+		boardRepo:   boardRepo,
+		postRepo:    postRepo,
+		commentRepo: commentRepo,
+		budget:      budget,
+	}
+}
+
+// compileRule compiles a rule's pattern. Literal patterns match anywhere
+// in the text, ignoring case.
+func compileRule(rule *models.FilterRule) (*regexp.Regexp, error) {
+	if rule.IsRegex {
+		return regexp.Compile(rule.Pattern)
+	}
+	return regexp.Compile("(?i)" + regexp.QuoteMeta(rule.Pattern))
+}
+
+// ReloadRules loads the enabled rules from the database. Rules whose
+// pattern no longer compiles are skipped.
+func (s *FilterService) ReloadRules(ctx context.Context) error {
+	rules, err := s.filterRepo.GetAll(ctx)
+	if err != nil {
+		return err
+	}
+
+	compiled := make([]*compiledRule, 0, len(rules))
+	for _, rule := range rules {
+		if !rule.Enabled {
+			continue
+		}
+		re, err := compileRule(rule)
+		if err != nil {
+			log.Printf("Warning: Skipping filter rule %d: %v", rule.ID, err)
+			continue
+		}
+		compiled = append(compiled, &compiledRule{rule: rule, re: re})
+	}
+
+	s.rules.Store(&compiled)
+	return nil
+}
+
+// Apply runs the rules of board and the global rules over fields in the
+// order they were created. Matched text is replaced in place, and the
+// first matching rejecting rule returns ErrContentRejected with its
+// message. Content that takes longer than the budget is left as it was and
+// flagged for moderation instead.
+func (s *FilterService) Apply(ctx context.Context, board string, fields ...*string) (*models.FilterVerdict, error) {
+	rules := s.rules.Load()
+	if rules == nil || len(*rules) == 0 {
+		return &models.FilterVerdict{}, nil
+	}
+
+	texts := make([]string, len(fields))
+	for i, field := range fields {
+		texts[i] = *field
+	}
+
+	budgetCtx, cancel := context.WithCancel(ctx)
+	if s.budget > 0 {
+		budgetCtx, cancel = context.WithTimeout(ctx, s.budget)
+	}
+	defer cancel()
+
+	// The rules run on their own goroutine so a slow match cannot hold up
+	// the request past the budget; it notices the deadline between rules
+	// and its result is dropped
+	done := make(chan *filterResult, 1)
+	go func() {
+		done <- evaluateRules(budgetCtx, *rules, board, texts)
+	}()
+
+	var result *filterResult
+	select {
+	case result = <-done:
+	case <-budgetCtx.Done():
+		result = &filterResult{timedOut: true}
+	}
+
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	if result.timedOut {
+		log.Printf("Warning: Filter rules on /%s/ exceeded their %s budget, flagging the content", board, s.budget)
+		return &models.FilterVerdict{Flagged: true}, nil
+	}
+
+	if len(result.hits) > 0 {
+		if err := s.filterRepo.AddHits(ctx, result.hits, time.Now()); err != nil {
+			log.Printf("Warning: Failed to count filter rule hits: %v", err)
+		}
+	}
+
+	if result.rejected != nil {
+		message := result.rejected.Message
+		if message == "" {
+			message = defaultRejectMessage
+		}
+		return nil, fmt.Errorf("%w: %s", models.ErrContentRejected, message)
+	}
+
+	for i, field := range fields {
+		*field = result.fields[i]
+	}
+	return &result.verdict, nil
+}
+
+// evaluateRules matches rules against texts, replacing matches in place,
+// until a rule rejects the content or ctx is done
+func evaluateRules(ctx context.Context, rules []*compiledRule, board string, texts []string) *filterResult {
+	result := &filterResult{fields: texts}
+	for _, compiled := range rules {
+		if ctx.Err() != nil {
+			result.timedOut = true
+			return result
+		}
+
+		rule := compiled.rule
+		if rule.Board != "" && rule.Board != board {
+			continue
+		}
+
+		hit := false
+		for i, text := range texts {
+			if rule.Action == models.FilterReplace {
+				var replaced string
+				if rule.IsRegex {
+					replaced = compiled.re.ReplaceAllString(text, rule.Replacement)
+				} else {
+					replaced = compiled.re.ReplaceAllLiteralString(text, rule.Replacement)
+				}
+				if replaced != text {
+					texts[i] = replaced
+					hit = true
+				}
+			} else if compiled.re.MatchString(text) {
+				hit = true
+			}
+		}
+		if !hit {
+			continue
+		}
+
+		result.hits = append(result.hits, rule.ID)
+		switch rule.Action {
+		case models.FilterReject:
+			result.rejected = rule
+			return result
+		case models.FilterFlag:
+			result.verdict.Flagged = true
+		case models.FilterHide:
+			result.verdict.Hidden = true
+		}
+	}
+	return result
+}
+
+func (s *FilterService) GetFilterRules(ctx context.Context) ([]*models.FilterRule, error) {
+	return s.filterRepo.GetAll(ctx)
+}
+
+// validateRule checks a rule before it is saved
+func (s *FilterService) validateRule(ctx context.Context, rule *models.FilterRule) error {
+	if rule.Pattern == "" {
+		return fmt.Errorf("%w: pattern is required", models.ErrInvalidFilterRule)
+	}
+	if len(rule.Pattern) > maxFilterPatternLength {
+		return fmt.Errorf("%w: pattern is longer than %d bytes", models.ErrInvalidFilterRule, maxFilterPatternLength)
+	}
+	if _, err := compileRule(rule); err != nil {
+		return fmt.Errorf("%w: %v", models.ErrInvalidFilterRule, err)
+	}
+
+	switch rule.Action {
+	case models.FilterReplace:
+		rule.Message = ""
+	case models.FilterReject:
+		rule.Replacement = ""
+	case models.FilterFlag, models.FilterHide:
+		rule.Replacement = ""
+		rule.Message = ""
+	default:
+		return fmt.Errorf("%w: action must be one of %s", models.ErrInvalidFilterRule,
+			strings.Join([]string{models.FilterReplace, models.FilterReject, models.FilterFlag, models.FilterHide}, ", "))
+	}
+	rule.Message = strings.TrimSpace(rule.Message)
+	if utf8.RuneCountInString(rule.Replacement) > maxFilterTextLength || utf8.RuneCountInString(rule.Message) > maxFilterTextLength {
+		return fmt.Errorf("%w: replacement and message are limited to %d characters", models.ErrInvalidFilterRule, maxFilterTextLength)
+	}
+
+	if rule.Board != "" {
+		board, err := s.boardRepo.GetBySlug(ctx, rule.Board)
+		if err != nil {
+			return err
+		}
+		if board == nil {
+			return models.ErrBoardNotFound
+		}
+	}
+	return nil
+}
+
+// CreateFilterRule saves a new rule and puts it to use right away
+func (s *FilterService) CreateFilterRule(ctx context.Context, rule *models.FilterRule) error {
+	if err := s.validateRule(ctx, rule); err != nil {
+		return err
+	}
+
+	rule.CreatedAt = time.Now()
+	if err := s.filterRepo.Create(ctx, rule); err != nil {
+		return err
+	}
+	return s.ReloadRules(ctx)
+}
+
+// UpdateFilterRule replaces a rule's settings, keeping its hit counters
+func (s *FilterService) UpdateFilterRule(ctx context.Context, rule *models.FilterRule) error {
+	if err := s.validateRule(ctx, rule); err != nil {
+		return err
+	}
+
+	if err := s.filterRepo.Update(ctx, rule); err != nil {
+		return err
+	}
+	return s.ReloadRules(ctx)
+}
+
+func (s *FilterService) DeleteFilterRule(ctx context.Context, id int) error {
+	if err := s.filterRepo.Delete(ctx, id); err != nil {
+		return err
+	}
+	return s.ReloadRules(ctx)
+}
+
+// GetFlagged returns the flagged posts and comments, oldest first
+func (s *FilterService) GetFlagged(ctx context.Context, limit, offset int) (*models.ModerationQueue, error) {
+	posts, err := s.postRepo.GetFlagged(ctx, limit, offset)
+	if err != nil {
+		return nil, err
+	}
+	comments, err := s.commentRepo.GetFlagged(ctx, limit, offset)
+	if err != nil {
+		return nil, err
+	}
+
+	return moderationQueue(posts, comments), nil
+}
+
+// moderationQueue lists posts and comments for moderators, as empty lists
+// rather than null when there are none
+func moderationQueue(posts []*models.Post, comments []*models.Comment) *models.ModerationQueue {
+	if posts == nil {
+		posts = []*models.Post{}
+	}
+	if comments == nil {
+		comments = []*models.Comment{}
+	}
+	return &models.ModerationQueue{Posts: posts, Comments: comments}
+}
+
+// UnflagPost takes a thread out of the flagged queue
+func (s *FilterService) UnflagPost(ctx context.Context, id int) error {
+	return s.postRepo.Unflag(ctx, id)
+}
+
+// UnflagComment takes a comment out of the flagged queue
+func (s *FilterService) UnflagComment(ctx context.Context, id int) error {
+	return s.commentRepo.Unflag(ctx, id)
+}
@@ -0,0 +1,154 @@
+package service
+
+import (
+	"1337b04rd/internal/adapters/storage"
+	"1337b04rd/internal/domain/models"
+	"1337b04rd/internal/domain/ports"
+	"1337b04rd/pkg/imagehash"
+	"context"
+	"fmt"
+	"strings"
+	"time"
+	"unicode/utf8"
+)
+
+// maxBanReasonLength bounds the moderator's note on an image ban
+const maxBanReasonLength = 500
+
+// ImageBanService manages the banned images and the attachments held for
+// review because they matched one
+type ImageBanService struct {
+	imageBanRepo   ports.ImageBanRepository
+	attachmentRepo ports.AttachmentRepository
+	boardRepo      ports.BoardRepository
+	objectRepo     ports.ObjectRepository
+	storage        *storage.MinioClient
+}
+
+func NewImageBanService(imageBanRepo ports.ImageBanRepository, attachmentRepo ports.AttachmentRepository, boardRepo ports.BoardRepository, objectRepo ports.ObjectRepository, storage *storage.MinioClient) *ImageBanService {
+	return &ImageBanService{
+		imageBanRepo:   imageBanRepo,
+		attachmentRepo: attachmentRepo,
+		boardRepo:      boardRepo,
+		objectRepo:     objectRepo,
+		storage:        storage,
+	}
+}
+
+func (s *ImageBanService) GetImageBans(ctx context.Context) ([]*models.ImageBan, error) {
+	return s.imageBanRepo.GetAll(ctx)
+}
+
+// CreateImageBan bans images within threshold bits of a hash. The hash is
+// taken from the attachment when attachmentID is set, so moderators can ban
+// an image straight from the post it was spammed in.
+func (s *ImageBanService) CreateImageBan(ctx context.Context, hash string, attachmentID, threshold int, reason string) (*models.ImageBan, error) {
+	if attachmentID > 0 {
+		attachment, err := s.attachmentRepo.GetByID(ctx, attachmentID)
+		if err != nil {
+			return nil, err
+		}
+		if attachment == nil {
+			return nil, models.ErrAttachmentNotFound
+		}
+		if attachment.ImageHash == "" {
+			return nil, fmt.Errorf("%w: attachment %d has no image to ban", models.ErrInvalidImageBan, attachmentID)
+		}
+		hash = attachment.ImageHash
+	}
+
+	parsed, err := imagehash.Parse(strings.ToLower(hash))
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", models.ErrInvalidImageBan, err)
+	}
+	if threshold < 0 || threshold > models.MaxImageBanThreshold {
+		return nil, fmt.Errorf("%w: threshold must be between 0 and %d", models.ErrInvalidImageBan, models.MaxImageBanThreshold)
+	}
+	reason = strings.TrimSpace(reason)
+	if utf8.RuneCountInString(reason) > maxBanReasonLength {
+		return nil, fmt.Errorf("%w: reason is longer than %d characters", models.ErrInvalidImageBan, maxBanReasonLength)
+	}
+
+	ban := &models.ImageBan{
+		Hash:      parsed.String(),
+		Threshold: threshold,
+		Reason:    reason,
+		CreatedAt: time.Now(),
+	}
+	if err := s.imageBanRepo.Create(ctx, ban); err != nil {
+		return nil, err
+	}
+	return ban, nil
+}
+
+// DeleteImageBan lifts a ban. Attachments it held stay held until reviewed.
+func (s *ImageBanService) DeleteImageBan(ctx context.Context, id int) error {
+	return s.imageBanRepo.Delete(ctx, id)
+}
+
+// GetHeldAttachments returns the review queue, oldest first
+func (s *ImageBanService) GetHeldAttachments(ctx context.Context, limit, offset int) ([]*models.Attachment, error) {
+	return s.attachmentRepo.GetHeld(ctx, limit, offset)
+}
+
+// ApproveAttachment shows a held attachment with its post or comment. Its
+// files are copied to their public names first and the private ones are
+// released once the attachment points at the copies.
+func (s *ImageBanService) ApproveAttachment(ctx context.Context, id int) error {
+	attachment, err := s.attachmentRepo.GetByID(ctx, id)
+	if err != nil {
+		return err
+	}
+	if attachment == nil || !attachment.Held {
+		return models.ErrAttachmentNotFound
+	}
+
+	var published, held []string
+	urls := []*string{&attachment.URL, &attachment.ThumbnailURL}
+	contentTypes := []string{attachment.ContentType, "image/jpeg"}
+	for i, objectURL := range urls {
+		if *objectURL == "" {
+			continue
+		}
+		publicURL, ok, err := publishHeldObject(ctx, s.storage, s.objectRepo, *objectURL, contentTypes[i])
+		if err != nil {
+			releaseObjects(ctx, s.storage, s.objectRepo, published)
+			return err
+		}
+		if ok {
+			published = append(published, publicURL)
+			held = append(held, *objectURL)
+			*objectURL = publicURL
+		}
+	}
+
+	if err := s.attachmentRepo.Release(ctx, id, attachment.URL, attachment.ThumbnailURL); err != nil {
+		releaseObjects(ctx, s.storage, s.objectRepo, published)
+		return err
+	}
+	releaseObjects(ctx, s.storage, s.objectRepo, held)
+	return nil
+}
+
+// RejectAttachment removes a held attachment and releases its files
+func (s *ImageBanService) RejectAttachment(ctx context.Context, id int) error {
+	attachment, err := s.attachmentRepo.Delete(ctx, id)
+	if err != nil {
+		return err
+	}
+	if attachment == nil {
+		return models.ErrAttachmentNotFound
+	}
+
+	releaseAttachmentObjects(ctx, s.storage, s.objectRepo, []*models.Attachment{attachment})
+	return nil
+}
+
+// SetBoardImageBanAction sets whether uploads matching a banned image are
+// rejected or held for review on a board
+func (s *ImageBanService) SetBoardImageBanAction(ctx context.Context, board, action string) error {
+	if action != models.ImageBanReject && action != models.ImageBanReview {
+		return fmt.Errorf("%w: action must be %q or %q", models.ErrInvalidImageBan, models.ImageBanReject, models.ImageBanReview)
+	}
+	return s.boardRepo.SetImageBanAction(ctx, board, action)
+}
@@ -0,0 +1,179 @@
+package service
+
+import (
+	"1337b04rd/internal/domain/models"
+	"1337b04rd/internal/domain/ports"
+	"context"
+	"time"
+)
+
+type PollService struct {
+	pollRepo ports.PollRepository
+	postRepo ports.PostRepository
+}
+
+func NewPollService(pollRepo ports.PollRepository, postRepo ports.PostRepository) *PollService {
+	return &PollService{
+		pollRepo: pollRepo,
+		postRepo: postRepo,
+	}
+}
+
+// GetPoll returns the poll of a thread as seen by the given session. Polls
+// of threads the session may not see are not found.
+func (s *PollService) GetPoll(ctx context.Context, postID int, sessionID string) (*models.Poll, error) {
+	post, err := s.postRepo.GetByID(ctx, postID, models.Viewer{SessionID: sessionID})
+	if err != nil {
+		return nil, err
+	}
+	if post == nil {
+		return nil, models.ErrPollNotFound
+	}
+
+	polls, err := s.pollRepo.GetByPostIDs(ctx, []int{postID})
+	if err != nil {
+		return nil, err
+	}
+	if len(polls) == 0 {
+		return nil, models.ErrPollNotFound
+	}
+
+	if err := s.applyViewer(ctx, sessionID, polls); err != nil {
+		return nil, err
+	}
+	return polls[0], nil
+}
+
+// Vote casts a session's ballot in a thread's poll. Single choice polls take
+// exactly one option; each session can vote only once.
+func (s *PollService) Vote(ctx context.Context, postID int, sessionID string, optionIDs []int) (*models.Poll, error) {
+	post, err := s.postRepo.GetByID(ctx, postID, models.Viewer{SessionID: sessionID})
+	if err != nil {
+		return nil, err
+	}
+	if post == nil {
+		return nil, models.ErrPostNotFound
+	}
+	if post.IsArchive {
+		return nil, models.ErrThreadArchived
+	}
+
+	polls, err := s.pollRepo.GetByPostIDs(ctx, []int{postID})
+	if err != nil {
+		return nil, err
+	}
+	if len(polls) == 0 {
+		return nil, models.ErrPollNotFound
+	}
+	poll := polls[0]
+
+	now := time.Now()
+	if poll.IsClosed(now) {
+		return nil, models.ErrPollClosed
+	}
+
+	valid := make(map[int]bool, len(poll.Options))
+	for _, option := range poll.Options {
+		valid[option.ID] = true
+	}
+	var chosen []int
+	seen := make(map[int]bool, len(optionIDs))
+	for _, id := range optionIDs {
+		if !valid[id] {
+			return nil, models.ErrInvalidVote
+		}
+		if !seen[id] {
+			seen[id] = true
+			chosen = append(chosen, id)
+		}
+	}
+	if len(chosen) == 0 || (!poll.MultipleChoice && len(chosen) > 1) {
+		return nil, models.ErrInvalidVote
+	}
+
+	if err := s.pollRepo.Vote(ctx, poll.ID, sessionID, chosen, now); err != nil {
+		return nil, err
+	}
+
+	return s.GetPoll(ctx, postID, sessionID)
+}
+
+// LoadPolls attaches their polls to the given posts as seen by the session
+func (s *PollService) LoadPolls(ctx context.Context, sessionID string, posts []*models.Post) error {
+	if len(posts) == 0 {
+		return nil
+	}
+
+	postIDs := make([]int, 0, len(posts))
+	byID := make(map[int]*models.Post, len(posts))
+	for _, post := range posts {
+		postIDs = append(postIDs, post.ID)
+		byID[post.ID] = post
+	}
+
+	polls, err := s.pollRepo.GetByPostIDs(ctx, postIDs)
+	if err != nil {
+		return err
+	}
+	if err := s.applyViewer(ctx, sessionID, polls); err != nil {
+		return err
+	}
+
+	for _, poll := range polls {
+		if post, ok := byID[poll.PostID]; ok {
+			post.Poll = poll
+		}
+	}
+	return nil
+}
+
+// applyViewer marks the session's choices and hides the vote counts of
+// polls the session has not voted in while they are still open
+func (s *PollService) applyViewer(ctx context.Context, sessionID string, polls []*models.Poll) error {
+	if len(polls) == 0 {
+		return nil
+	}
+
+	byID := make(map[int]*models.Poll, len(polls))
+	pollIDs := make([]int, 0, len(polls))
+	for _, poll := range polls {
+		byID[poll.ID] = poll
+		pollIDs = append(pollIDs, poll.ID)
+	}
+
+	selected := make(map[int]bool)
+	if sessionID != "" {
+		votes, err := s.pollRepo.GetVotesBySession(ctx, sessionID, pollIDs)
+		if err != nil {
+			return err
+		}
+		for _, vote := range votes {
+			selected[vote.OptionID] = true
+			if poll, ok := byID[vote.PollID]; ok {
+				poll.Voted = true
+			}
+		}
+	}
+
+	now := time.Now()
+	for _, poll := range polls {
+		poll.Closed = poll.IsClosed(now)
+		poll.ResultsVisible = poll.Voted || poll.Closed
+
+		total := 0
+		for _, option := range poll.Options {
+			option.Selected = selected[option.ID]
+			if option.Votes != nil {
+				total += *option.Votes
+			}
+			if !poll.ResultsVisible {
+				option.Votes = nil
+			}
+		}
+		if poll.ResultsVisible {
+			poll.TotalVotes = &total
+		}
+	}
+
+	return nil
+}
@@ -4,153 +4,373 @@ import (
 	"1337b04rd/internal/adapters/storage"
 	"1337b04rd/internal/domain/models"
 	"1337b04rd/internal/domain/ports"
+	"1337b04rd/pkg/markup"
 	"context"
-	"errors"
-	"mime/multipart"
+	"fmt"
+	"log"
 	"time"
+	"unicode/utf8"
+)
+
+const (
+	catalogTitleLength   = 64
+	catalogExcerptLength = 160
+
+	// purgeBatchSize bounds how many threads one purge query loads
+	purgeBatchSize = 100
 )
 
 type PostService struct {
-	postRepo    ports.PostRepository
-	commentRepo ports.CommentRepository
-	storage     *storage.MinioClient
+	uow            ports.UnitOfWork
+	postRepo       ports.PostRepository
+	commentRepo    ports.CommentRepository
+	referenceRepo  ports.CommentReferenceRepository
+	boardRepo      ports.BoardRepository
+	pollRepo       ports.PollRepository
+	attachmentRepo ports.AttachmentRepository
+	objectRepo     ports.ObjectRepository
+	imageBanRepo   ports.ImageBanRepository
+	quarantineRepo ports.QuarantineRepository
+	filter         ports.ContentFilter
+	storage        *storage.MinioClient
+	videoTypes     []string
+	events         ports.EventPublisher
+
+	// editWindow is how long after posting authors may edit a thread;
+	// zero or less leaves edits open
+	editWindow time.Duration
 }
 
-func NewPostService(postRepo ports.PostRepository, commentRepo ports.CommentRepository, storage *storage.MinioClient) *PostService {
+func NewPostService(uow ports.UnitOfWork, postRepo ports.PostRepository, commentRepo ports.CommentRepository, referenceRepo ports.CommentReferenceRepository, boardRepo ports.BoardRepository, pollRepo ports.PollRepository, attachmentRepo ports.AttachmentRepository, objectRepo ports.ObjectRepository, imageBanRepo ports.ImageBanRepository, quarantineRepo ports.QuarantineRepository, filter ports.ContentFilter, storage *storage.MinioClient, videoTypes []string, events ports.EventPublisher, editWindow time.Duration) *PostService {
 	return &PostService{
-		postRepo:    postRepo,
-		commentRepo: commentRepo,
-		storage:     storage,
+		uow:            uow,
+		postRepo:       postRepo,
+		commentRepo:    commentRepo,
+		referenceRepo:  referenceRepo,
+		boardRepo:      boardRepo,
+		pollRepo:       pollRepo,
+		attachmentRepo: attachmentRepo,
+		objectRepo:     objectRepo,
+		imageBanRepo:   imageBanRepo,
+		quarantineRepo: quarantineRepo,
+		filter:         filter,
+		storage:        storage,
+		videoTypes:     videoTypes,
+		events:         events,
+		editWindow:     editWindow,
 	}
 }
 
-func (s *PostService) CreatePost(ctx context.Context, post *models.Post, imageFile multipart.File, imageHeader *multipart.FileHeader) error {
-	// Set creation time
+func (s *PostService) CreatePost(ctx context.Context, post *models.Post, uploads []*models.AttachmentUpload) error {
+	// Make sure the target board exists
+	if post.Board == "" {
+		post.Board = models.DefaultBoard
+	}
+	board, err := s.boardRepo.GetBySlug(ctx, post.Board)
+	if err != nil {
+		return err
+	}
+	if board == nil {
+		return models.ErrBoardNotFound
+	}
+
+	// Set creation time; a new thread starts out freshly bumped
 	post.CreatedAt = time.Now()
+	post.BumpedAt = post.CreatedAt
 
-	// Handle image upload if provided
-	if imageFile != nil && imageHeader != nil {
-		imageURL, err := s.storage.UploadPostImage(ctx, imageFile, imageHeader.Filename, imageHeader.Header.Get("Content-Type"))
-		if err != nil {
+	// Check the poll before anything is stored
+	if post.Poll != nil {
+		if err := post.Poll.Validate(post.CreatedAt); err != nil {
 			return err
 		}
-		post.ImageURL = imageURL
 	}
 
-	// Create post in database
-	err := s.postRepo.Create(ctx, post)
+	// Run the word filters before anything is stored
+	verdict, err := s.filter.Apply(ctx, post.Board, &post.Title, &post.Content)
+	if err != nil {
+		return err
+	}
+	post.Flagged = verdict.Flagged
+	post.Visibility, err = initialVisibility(ctx, s.quarantineRepo, post.AuthorID, post.IPHash, verdict.Hidden)
+	if err != nil {
+		return err
+	}
+
+	// Cache the rendered markup alongside the raw content
+	post.ContentHTML = markup.Render(post.Content)
+
+	var pruned []*models.PrunedThread
+	err = s.uow.Do(ctx, func(work ports.Work) error {
+		err := claimUploads(ctx, work.Uploads(), s.storage, s.storage.GetBucketName("post"), post.AuthorID, uploads, post.CreatedAt)
+		if err != nil {
+			return err
+		}
+
+		// Store the attachments; the first one doubles as the thread image.
+		// Their files are released again if the thread is not saved.
+		attachments, err := storeAttachments(ctx, s.storage, s.objectRepo, s.imageBanRepo, s.storage.GetBucketName("post"), board, s.videoTypes, uploads, post.CreatedAt)
+		if err != nil {
+			return err
+		}
+		work.OnRollback(func(ctx context.Context) {
+			releaseAttachmentObjects(ctx, s.storage, s.objectRepo, attachments)
+		})
+		post.ImageURL = imageURL(attachments)
+
+		// Create post in database, pruning the board if it went over its cap
+		pruned, err = work.Posts().Create(ctx, post)
+		if err != nil {
+			return err
+		}
+
+		if len(attachments) > 0 {
+			if _, err := work.Attachments().Replace(ctx, post.ID, nil, attachments); err != nil {
+				return err
+			}
+		}
+		post.Attachments = attachments
+
+		if post.Poll != nil {
+			post.Poll.PostID = post.ID
+			post.Poll.CreatedAt = post.CreatedAt
+			if err := work.Polls().Create(ctx, post.Poll); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
 	if err != nil {
 		return err
 	}
+	removeClaimedObjects(ctx, s.storage, uploads)
+
+	releasePrunedThreads(ctx, s.storage, s.objectRepo, pruned)
+	for _, thread := range pruned {
+		s.events.Publish(models.Event{Type: models.EventThreadPruned, Board: thread.Board, Data: thread})
+	}
 
 	return nil
 }
 
-func (s *PostService) GetPost(ctx context.Context, id int) (*models.Post, error) {
-	post, err := s.postRepo.GetByID(ctx, id)
+// GetPost returns a thread with the replies viewer may see
+func (s *PostService) GetPost(ctx context.Context, id int, viewer models.Viewer) (*models.Post, error) {
+	post, err := s.postRepo.GetByID(ctx, id, viewer)
 	if err != nil {
 		return nil, err
 	}
 
 	if post == nil {
-		return nil, errors.New("post not found")
+		return nil, models.ErrPostNotFound
 	}
 
 	// Load comments for the post
-	comments, err := s.commentRepo.GetByPostID(ctx, id)
+	comments, err := s.commentRepo.GetByPostID(ctx, id, viewer)
 	if err != nil {
 		return nil, err
 	}
+	if err := loadCommentReferences(ctx, s.referenceRepo, comments, viewer); err != nil {
+		return nil, err
+	}
 
 	post.Comments = comments
+	if err := loadAttachments(ctx, s.attachmentRepo, []*models.Post{post}); err != nil {
+		return nil, err
+	}
 	return post, nil
 }
 
-func (s *PostService) GetPosts(ctx context.Context, limit, offset int, includeArchived bool) ([]*models.Post, error) {
-	posts, err := s.postRepo.GetAll(ctx, limit, offset, includeArchived)
+func (s *PostService) GetPosts(ctx context.Context, viewer models.Viewer, limit, offset int, includeArchived bool, sort models.PostSort) ([]*models.Post, error) {
+	posts, err := s.postRepo.GetAll(ctx, viewer, limit, offset, includeArchived, sort)
 	if err != nil {
 		return nil, err
 	}
 
 	// Load comments for each post
 	for _, post := range posts {
-		comments, err := s.commentRepo.GetByPostID(ctx, post.ID)
+		comments, err := s.commentRepo.GetByPostID(ctx, post.ID, viewer)
 		if err != nil {
 			return nil, err
 		}
+		if err := loadCommentReferences(ctx, s.referenceRepo, comments, viewer); err != nil {
+			return nil, err
+		}
 		post.Comments = comments
 	}
 
+	if err := loadAttachments(ctx, s.attachmentRepo, posts); err != nil {
+		return nil, err
+	}
 	return posts, nil
 }
 
-func (s *PostService) GetPostsByAuthor(ctx context.Context, authorID string, limit, offset int) ([]*models.Post, error) {
-	posts, err := s.postRepo.GetByAuthorID(ctx, authorID, limit, offset)
+func (s *PostService) GetPostsByAuthor(ctx context.Context, authorID string, viewer models.Viewer, limit, offset int) ([]*models.Post, error) {
+	posts, err := s.postRepo.GetByAuthorID(ctx, authorID, viewer, limit, offset)
 	if err != nil {
 		return nil, err
 	}
 
 	// Load comments for each post
 	for _, post := range posts {
-		comments, err := s.commentRepo.GetByPostID(ctx, post.ID)
+		comments, err := s.commentRepo.GetByPostID(ctx, post.ID, viewer)
 		if err != nil {
 			return nil, err
 		}
+		if err := loadCommentReferences(ctx, s.referenceRepo, comments, viewer); err != nil {
+			return nil, err
+		}
 		post.Comments = comments
 	}
 
+	if err := loadAttachments(ctx, s.attachmentRepo, posts); err != nil {
+		return nil, err
+	}
 	return posts, nil
 }
 
-func (s *PostService) UpdatePost(ctx context.Context, post *models.Post, imageFile multipart.File, imageHeader *multipart.FileHeader) error {
+// UpdatePost saves an author's edit of a thread. post.AuthorID is the
+// editing session and post.Version the version the edit was made from.
+func (s *PostService) UpdatePost(ctx context.Context, post *models.Post, uploads []*models.AttachmentUpload) error {
 	// Check if post exists
-	existingPost, err := s.postRepo.GetByID(ctx, post.ID)
+	existingPost, err := s.postRepo.GetByID(ctx, post.ID, models.Viewer{SessionID: post.AuthorID})
 	if err != nil {
 		return err
 	}
 
 	if existingPost == nil {
-		return errors.New("post not found")
+		return models.ErrPostNotFound
+	}
+
+	// Stale or foreign edits are turned away before any files are stored;
+	// the repository checks both again when it writes the edit
+	if existingPost.AuthorID != post.AuthorID {
+		return models.ErrNotAuthor
+	}
+	if existingPost.Version != post.Version {
+		return models.ErrVersionConflict
+	}
+
+	// Archived threads are read-only
+	if existingPost.IsArchive {
+		return models.ErrThreadArchived
 	}
 
-	// Handle image upload if provided
-	if imageFile != nil && imageHeader != nil {
-		imageURL, err := s.storage.UploadPostImage(ctx, imageFile, imageHeader.Filename, imageHeader.Header.Get("Content-Type"))
+	now := time.Now()
+	if s.editWindow > 0 && now.Sub(existingPost.CreatedAt) > s.editWindow {
+		return models.ErrEditWindowClosed
+	}
+
+	// Fields that are not editable carry over from the stored post
+	post.IsArchive = existingPost.IsArchive
+	post.ExpiresAt = existingPost.ExpiresAt
+
+	// Run the word filters on the edit; an edit never clears an earlier
+	// verdict
+	verdict, err := s.filter.Apply(ctx, existingPost.Board, &post.Title, &post.Content)
+	if err != nil {
+		return err
+	}
+	post.Flagged = existingPost.Flagged || verdict.Flagged
+	post.Visibility = existingPost.Visibility
+	if verdict.Hidden {
+		post.Visibility = models.VisibilityPending
+	}
+
+	// Keep existing attachments if no new files were provided
+	post.ImageURL = existingPost.ImageURL
+	var board *models.Board
+	if len(uploads) > 0 {
+		board, err = s.boardRepo.GetBySlug(ctx, existingPost.Board)
 		if err != nil {
 			return err
 		}
-		post.ImageURL = imageURL
-	} else {
-		// Keep existing image if no new image provided
-		post.ImageURL = existingPost.ImageURL
+		if board == nil {
+			return models.ErrBoardNotFound
+		}
 	}
 
-	// Update post in database
-	err = s.postRepo.Update(ctx, post)
+	// Cache the rendered markup alongside the raw content
+	post.ContentHTML = markup.Render(post.Content)
+	post.EditedAt = now
+
+	var removed []*models.Attachment
+	err = s.uow.Do(ctx, func(work ports.Work) error {
+		if len(uploads) > 0 {
+			err := claimUploads(ctx, work.Uploads(), s.storage, s.storage.GetBucketName("post"), post.AuthorID, uploads, now)
+			if err != nil {
+				return err
+			}
+			attachments, err := storeAttachments(ctx, s.storage, s.objectRepo, s.imageBanRepo, s.storage.GetBucketName("post"), board, s.videoTypes, uploads, now)
+			if err != nil {
+				return err
+			}
+			work.OnRollback(func(ctx context.Context) {
+				releaseAttachmentObjects(ctx, s.storage, s.objectRepo, attachments)
+			})
+			removed, err = work.Attachments().Replace(ctx, post.ID, nil, attachments)
+			if err != nil {
+				return err
+			}
+			post.ImageURL = imageURL(attachments)
+		}
+
+		// Save the edit, keeping the previous version as a revision
+		return work.Posts().Edit(ctx, post, post.AuthorID)
+	})
 	if err != nil {
 		return err
 	}
+	removeClaimedObjects(ctx, s.storage, uploads)
 
-	return nil
+	// Replaced files are only released once the post points at the new ones
+	releaseAttachmentObjects(ctx, s.storage, s.objectRepo, removed)
+
+	return loadAttachments(ctx, s.attachmentRepo, []*models.Post{post})
 }
 
-func (s *PostService) DeletePost(ctx context.Context, id int) error {
-	// Check if post exists
-	existingPost, err := s.postRepo.GetByID(ctx, id)
+// GetPostRevisions returns the earlier versions of a thread viewer may
+// see, oldest first, each with its changes to the next version
+func (s *PostService) GetPostRevisions(ctx context.Context, id int, viewer models.Viewer) ([]*models.Revision, error) {
+	post, err := s.postRepo.GetByID(ctx, id, viewer)
 	if err != nil {
-		return err
+		return nil, err
+	}
+	if post == nil {
+		return nil, models.ErrPostNotFound
 	}
 
-	if existingPost == nil {
-		return errors.New("post not found")
+	revisions, err := s.postRepo.GetRevisions(ctx, id)
+	if err != nil {
+		return nil, err
 	}
+	return diffRevisions(revisions, post.Title, post.Content), nil
+}
+
+func (s *PostService) DeletePost(ctx context.Context, id int) error {
+	// Attachments of the thread and its replies go with the post; reading
+	// them in the same transaction keeps a reply saved meanwhile from
+	// leaving its files behind
+	var attachments []*models.Attachment
+	err := s.uow.Do(ctx, func(work ports.Work) error {
+		existingPost, err := work.Posts().Lock(ctx, id)
+		if err != nil {
+			return err
+		}
+		if existingPost == nil {
+			return models.ErrPostNotFound
+		}
 
-	// Delete post from database
-	err = s.postRepo.Delete(ctx, id)
+		attachments, err = work.Attachments().GetByPostIDs(ctx, []int{id})
+		if err != nil {
+			return err
+		}
+
+		return work.Posts().Delete(ctx, id)
+	})
 	if err != nil {
 		return err
 	}
 
+	releaseAttachmentObjects(ctx, s.storage, s.objectRepo, attachments)
 	return nil
 }
 
@@ -161,3 +381,191 @@ func (s *PostService) ArchivePost(ctx context.Context, id int) error {
 func (s *PostService) UnarchivePost(ctx context.Context, id int) error {
 	return s.postRepo.Unarchive(ctx, id)
 }
+
+func (s *PostService) SetSticky(ctx context.Context, id int, sticky bool) error {
+	return s.postRepo.SetSticky(ctx, id, sticky)
+}
+
+func (s *PostService) SetLocked(ctx context.Context, id int, locked bool) error {
+	return s.postRepo.SetLocked(ctx, id, locked)
+}
+
+// SetBoardLimits changes the limits of a board. A lower thread cap takes
+// effect with the next thread created on the board.
+func (s *PostService) SetBoardLimits(ctx context.Context, board string, limits models.BoardLimits) error {
+	counts := []struct {
+		name  string
+		value *int
+	}{
+		{"bump_limit", limits.BumpLimit},
+		{"max_threads", limits.MaxThreads},
+		{"max_attachments", limits.MaxAttachments},
+		{"max_video_duration", limits.MaxVideoDuration},
+	}
+	for _, count := range counts {
+		if count.value != nil && *count.value < 0 {
+			return fmt.Errorf("%w: %s must not be negative", models.ErrInvalidLimits, count.name)
+		}
+	}
+	if limits.MaxFileSize != nil && (*limits.MaxFileSize <= 0 || *limits.MaxFileSize > models.MaxAttachmentSize) {
+		return fmt.Errorf("%w: max_file_size must be between 1 byte and %d MB", models.ErrInvalidLimits, models.MaxAttachmentSize>>20)
+	}
+
+	return s.boardRepo.SetLimits(ctx, board, limits)
+}
+
+// ArchiveExpiredPosts archives threads whose expiry time has passed
+func (s *PostService) ArchiveExpiredPosts(ctx context.Context) (int, error) {
+	return s.postRepo.ArchiveExpired(ctx, time.Now())
+}
+
+// GetCatalog returns the catalog of a board with titles and content shortened
+func (s *PostService) GetCatalog(ctx context.Context, board string) ([]*models.CatalogEntry, error) {
+	existing, err := s.boardRepo.GetBySlug(ctx, board)
+	if err != nil {
+		return nil, err
+	}
+	if existing == nil {
+		return nil, models.ErrBoardNotFound
+	}
+
+	entries, err := s.postRepo.GetCatalog(ctx, board)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, entry := range entries {
+		entry.Title = truncate(entry.Title, catalogTitleLength)
+		entry.Excerpt = truncate(entry.Excerpt, catalogExcerptLength)
+	}
+
+	if entries == nil {
+		entries = []*models.CatalogEntry{}
+	}
+	return entries, nil
+}
+
+// truncate shortens s to at most n runes, marking the cut with an ellipsis
+func truncate(s string, n int) string {
+	if utf8.RuneCountInString(s) <= n {
+		return s
+	}
+	runes := []rune(s)
+	return string(runes[:n-1]) + "…"
+}
+
+// GetArchiveBuckets counts a board's archived threads per day or month
+func (s *PostService) GetArchiveBuckets(ctx context.Context, board string, size models.ArchiveBucketSize, search string) ([]*models.ArchiveBucket, error) {
+	existing, err := s.boardRepo.GetBySlug(ctx, board)
+	if err != nil {
+		return nil, err
+	}
+	if existing == nil {
+		return nil, models.ErrBoardNotFound
+	}
+
+	buckets, err := s.postRepo.GetArchiveBuckets(ctx, board, size, search)
+	if err != nil {
+		return nil, err
+	}
+
+	if buckets == nil {
+		buckets = []*models.ArchiveBucket{}
+	}
+	return buckets, nil
+}
+
+// GetArchivedPosts lists a board's archived threads created in [from, to)
+func (s *PostService) GetArchivedPosts(ctx context.Context, board string, from, to time.Time, search string, limit, offset int) ([]*models.Post, error) {
+	existing, err := s.boardRepo.GetBySlug(ctx, board)
+	if err != nil {
+		return nil, err
+	}
+	if existing == nil {
+		return nil, models.ErrBoardNotFound
+	}
+
+	posts, err := s.postRepo.GetArchived(ctx, board, from, to, search, limit, offset)
+	if err != nil {
+		return nil, err
+	}
+
+	if posts == nil {
+		posts = []*models.Post{}
+	}
+	if err := loadAttachments(ctx, s.attachmentRepo, posts); err != nil {
+		return nil, err
+	}
+	return posts, nil
+}
+
+// PurgeArchivedPosts permanently deletes threads archived before cutoff and
+// releases the images of the thread and its replies. It returns the
+// number of deleted threads.
+func (s *PostService) PurgeArchivedPosts(ctx context.Context, cutoff time.Time) (int, error) {
+	purged := 0
+	for {
+		posts, err := s.postRepo.GetArchivedBefore(ctx, cutoff, purgeBatchSize)
+		if err != nil {
+			return purged, err
+		}
+		if len(posts) == 0 {
+			return purged, nil
+		}
+
+		for _, post := range posts {
+			comments, err := s.commentRepo.GetByPostID(ctx, post.ID, models.Staff)
+			if err != nil {
+				return purged, err
+			}
+
+			attachments, err := s.attachmentRepo.GetByPostIDs(ctx, []int{post.ID})
+			if err != nil {
+				return purged, err
+			}
+
+			imageURLs := []string{post.ImageURL}
+			for _, comment := range comments {
+				imageURLs = append(imageURLs, comment.ImageURL)
+			}
+
+			if err := s.postRepo.Delete(ctx, post.ID); err != nil {
+				return purged, err
+			}
+			purged++
+
+			// The thread is gone either way; objects that fail to go are
+			// only logged
+			releaseThreadObjects(ctx, s.storage, s.objectRepo, post.ID, attachments, imageURLs)
+		}
+	}
+}
+
+// releaseThreadObjects releases the files of a deleted thread and its
+// replies, logging the ones that could not be released. Messages with
+// attachments show the first one as their image; only older messages own
+// their image by themselves.
+func releaseThreadObjects(ctx context.Context, objects *storage.MinioClient, objectRepo ports.ObjectRepository, postID int, attachments []*models.Attachment, imageURLs []string) {
+	releaseAttachmentObjects(ctx, objects, objectRepo, attachments)
+
+	seen := make(map[string]bool, len(imageURLs)+len(attachments))
+	for _, attachment := range attachments {
+		seen[attachment.URL] = true
+	}
+	for _, imageURL := range imageURLs {
+		if imageURL == "" || seen[imageURL] {
+			continue
+		}
+		seen[imageURL] = true
+		if err := releaseObject(ctx, objects, objectRepo, imageURL); err != nil {
+			log.Printf("Warning: Failed to delete image %s of deleted post %d: %v", imageURL, postID, err)
+		}
+	}
+}
+
+// releasePrunedThreads releases the files of the threads pruning deleted
+func releasePrunedThreads(ctx context.Context, objects *storage.MinioClient, objectRepo ports.ObjectRepository, pruned []*models.PrunedThread) {
+	for _, thread := range pruned {
+		releaseThreadObjects(ctx, objects, objectRepo, thread.PostID, thread.Attachments, thread.ImageURLs)
+	}
+}
@@ -0,0 +1,130 @@
+package service
+
+import (
+	"1337b04rd/internal/domain/models"
+	"1337b04rd/internal/domain/ports"
+	"context"
+	"fmt"
+	"strings"
+	"time"
+	"unicode/utf8"
+)
+
+// QuarantineService manages the quarantined sessions and addresses and the
+// queue of content waiting for approval
+type QuarantineService struct {
+	quarantineRepo ports.QuarantineRepository
+	postRepo       ports.PostRepository
+	commentRepo    ports.CommentRepository
+}
+
+func NewQuarantineService(quarantineRepo ports.QuarantineRepository, postRepo ports.PostRepository, commentRepo ports.CommentRepository) *QuarantineService {
+	return &QuarantineService{
+		quarantineRepo: quarantineRepo,
+		postRepo:       postRepo,
+		commentRepo:    commentRepo,
+	}
+}
+
+// initialVisibility decides who sees a new post or comment: content hidden
+// by the filter rules and content from a quarantined session or address
+// waits for approval
+func initialVisibility(ctx context.Context, quarantineRepo ports.QuarantineRepository, authorID, ipHash string, hidden bool) (string, error) {
+	if hidden {
+		return models.VisibilityPending, nil
+	}
+
+	quarantined, err := quarantineRepo.Matches(ctx, authorID, ipHash)
+	if err != nil {
+		return "", err
+	}
+	if quarantined {
+		return models.VisibilityPending, nil
+	}
+	return models.VisibilityVisible, nil
+}
+
+func (s *QuarantineService) GetQuarantines(ctx context.Context) ([]*models.Quarantine, error) {
+	return s.quarantineRepo.GetAll(ctx)
+}
+
+// CreateQuarantine holds back everything a session posts from now on. The
+// session is taken from the post or comment when postID or commentID is
+// set, and byIP quarantines the address it was written from instead, so
+// moderators never need to see either.
+func (s *QuarantineService) CreateQuarantine(ctx context.Context, sessionID string, postID, commentID int, byIP bool, reason string) (*models.Quarantine, error) {
+	var ipHash string
+	switch {
+	case postID > 0:
+		post, err := s.postRepo.GetByID(ctx, postID, models.Staff)
+		if err != nil {
+			return nil, err
+		}
+		if post == nil {
+			return nil, models.ErrPostNotFound
+		}
+		sessionID, ipHash = post.AuthorID, post.IPHash
+	case commentID > 0:
+		comment, err := s.commentRepo.GetByID(ctx, commentID)
+		if err != nil {
+			return nil, err
+		}
+		if comment == nil {
+			return nil, models.ErrCommentNotFound
+		}
+		sessionID, ipHash = comment.AuthorID, comment.IPHash
+	case byIP:
+		return nil, fmt.Errorf("%w: addresses can only be quarantined through a post or comment", models.ErrInvalidQuarantine)
+	}
+
+	quarantine := &models.Quarantine{SessionID: sessionID}
+	if byIP {
+		quarantine = &models.Quarantine{IPHash: ipHash}
+	}
+	if quarantine.SessionID == "" && quarantine.IPHash == "" {
+		return nil, fmt.Errorf("%w: no session or address to quarantine", models.ErrInvalidQuarantine)
+	}
+
+	reason = strings.TrimSpace(reason)
+	if utf8.RuneCountInString(reason) > maxBanReasonLength {
+		return nil, fmt.Errorf("%w: reason is longer than %d characters", models.ErrInvalidQuarantine, maxBanReasonLength)
+	}
+	quarantine.Reason = reason
+	quarantine.CreatedAt = time.Now()
+
+	if err := s.quarantineRepo.Create(ctx, quarantine); err != nil {
+		return nil, err
+	}
+	return quarantine, nil
+}
+
+// DeleteQuarantine lifts a quarantine. Content it held back stays pending
+// until approved.
+func (s *QuarantineService) DeleteQuarantine(ctx context.Context, id int) error {
+	return s.quarantineRepo.Delete(ctx, id)
+}
+
+// GetPending returns the posts and comments waiting for approval, oldest
+// first
+func (s *QuarantineService) GetPending(ctx context.Context, limit, offset int) (*models.ModerationQueue, error) {
+	posts, err := s.postRepo.GetPending(ctx, limit, offset)
+	if err != nil {
+		return nil, err
+	}
+	comments, err := s.commentRepo.GetPending(ctx, limit, offset)
+	if err != nil {
+		return nil, err
+	}
+
+	return moderationQueue(posts, comments), nil
+}
+
+// ApprovePost shows a pending thread to everyone
+func (s *QuarantineService) ApprovePost(ctx context.Context, id int) error {
+	return s.postRepo.Approve(ctx, id)
+}
+
+// ApproveComment shows a pending comment to everyone
+func (s *QuarantineService) ApproveComment(ctx context.Context, id int) error {
+	return s.commentRepo.Approve(ctx, id)
+}
@@ -0,0 +1,226 @@
+package service
+
+import (
+	"1337b04rd/internal/domain/models"
+	"1337b04rd/internal/domain/ports"
+	"context"
+	"fmt"
+	"strings"
+	"time"
+	"unicode/utf8"
+)
+
+const (
+	// maxBoardReactions bounds the size of a board's reaction set
+	maxBoardReactions = 16
+
+	// maxReactionLength matches the emoji column of the reactions table
+	maxReactionLength = 32
+)
+
+type ReactionService struct {
+	reactionRepo ports.ReactionRepository
+	postRepo     ports.PostRepository
+	commentRepo  ports.CommentRepository
+	boardRepo    ports.BoardRepository
+	events       ports.EventPublisher
+}
+
+func NewReactionService(reactionRepo ports.ReactionRepository, postRepo ports.PostRepository, commentRepo ports.CommentRepository, boardRepo ports.BoardRepository, events ports.EventPublisher) *ReactionService {
+	return &ReactionService{
+		reactionRepo: reactionRepo,
+		postRepo:     postRepo,
+		commentRepo:  commentRepo,
+		boardRepo:    boardRepo,
+		events:       events,
+	}
+}
+
+// AddReaction records a session's reaction to a post or comment and returns
+// the item's updated counts. Reacting twice with the same emoji is a no-op.
+func (s *ReactionService) AddReaction(ctx context.Context, reaction *models.Reaction) (map[string]int, error) {
+	return s.react(ctx, reaction, true)
+}
+
+// RemoveReaction withdraws a session's reaction and returns the item's
+// updated counts. Removing a reaction that was never given is a no-op.
+func (s *ReactionService) RemoveReaction(ctx context.Context, reaction *models.Reaction) (map[string]int, error) {
+	return s.react(ctx, reaction, false)
+}
+
+func (s *ReactionService) react(ctx context.Context, reaction *models.Reaction, add bool) (map[string]int, error) {
+	// Sessions can only react to what they can see
+	viewer := models.Viewer{SessionID: reaction.SessionID}
+
+	// Counts of pending content must not reach the public stream, or
+	// everyone would learn the content exists
+	public := true
+
+	// Comment reactions are stored against the comment's thread
+	if reaction.CommentID != nil {
+		comment, err := s.commentRepo.GetByID(ctx, *reaction.CommentID)
+		if err != nil {
+			return nil, err
+		}
+		if comment == nil || !viewer.CanSee(comment.Visibility, comment.AuthorID) {
+			return nil, models.ErrCommentNotFound
+		}
+		reaction.PostID = comment.PostID
+		public = models.Viewer{}.CanSee(comment.Visibility, comment.AuthorID)
+	}
+
+	post, err := s.postRepo.GetByID(ctx, reaction.PostID, viewer)
+	if err != nil {
+		return nil, err
+	}
+	if post == nil {
+		return nil, models.ErrPostNotFound
+	}
+	if post.IsArchive {
+		return nil, models.ErrThreadArchived
+	}
+	public = public && models.Viewer{}.CanSee(post.Visibility, post.AuthorID)
+
+	var changed bool
+	var counts map[string]int
+	if add {
+		board, err := s.boardRepo.GetBySlug(ctx, post.Board)
+		if err != nil {
+			return nil, err
+		}
+		if board == nil || !containsString(board.Reactions, reaction.Emoji) {
+			return nil, models.ErrInvalidReaction
+		}
+
+		reaction.CreatedAt = time.Now()
+		changed, counts, err = s.reactionRepo.Add(ctx, reaction)
+		if err != nil {
+			return nil, err
+		}
+	} else {
+		// Removal skips the board check so reactions dropped from the
+		// board's set can still be taken back
+		changed, counts, err = s.reactionRepo.Remove(ctx, reaction)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	if changed && public {
+		s.events.Publish(models.Event{
+			Type:  models.EventReactionsUpdated,
+			Board: post.Board,
+			Data: &models.ReactionUpdate{
+				PostID:    reaction.PostID,
+				CommentID: reaction.CommentID,
+				Reactions: counts,
+			},
+		})
+	}
+
+	return counts, nil
+}
+
+// GetBoardReactions returns the reactions allowed on a board
+func (s *ReactionService) GetBoardReactions(ctx context.Context, board string) ([]string, error) {
+	existing, err := s.boardRepo.GetBySlug(ctx, board)
+	if err != nil {
+		return nil, err
+	}
+	if existing == nil {
+		return nil, models.ErrBoardNotFound
+	}
+
+	return existing.Reactions, nil
+}
+
+// SetBoardReactions replaces the reactions allowed on a board. An empty set
+// restores the default reactions. Counts of reactions that are no longer
+// allowed are kept until their sessions remove them.
+func (s *ReactionService) SetBoardReactions(ctx context.Context, board string, reactions []string) error {
+	var cleaned []string
+	for _, reaction := range reactions {
+		reaction = strings.TrimSpace(reaction)
+		if reaction == "" || containsString(cleaned, reaction) {
+			continue
+		}
+		if utf8.RuneCountInString(reaction) > maxReactionLength {
+			return fmt.Errorf("%w: %q is too long", models.ErrInvalidReaction, reaction)
+		}
+		cleaned = append(cleaned, reaction)
+	}
+	if len(cleaned) > maxBoardReactions {
+		return fmt.Errorf("%w: at most %d reactions per board", models.ErrInvalidReaction, maxBoardReactions)
+	}
+
+	return s.boardRepo.SetReactions(ctx, board, cleaned)
+}
+
+// LoadSessionReactions fills in MyReactions on the posts and their loaded
+// comments for the given session
+func (s *ReactionService) LoadSessionReactions(ctx context.Context, sessionID string, posts []*models.Post) error {
+	var comments []*models.Comment
+	for _, post := range posts {
+		comments = append(comments, post.Comments...)
+	}
+
+	return s.loadSessionReactions(ctx, sessionID, posts, comments)
+}
+
+// LoadSessionCommentReactions fills in MyReactions on the comments for the
+// given session
+func (s *ReactionService) LoadSessionCommentReactions(ctx context.Context, sessionID string, comments []*models.Comment) error {
+	return s.loadSessionReactions(ctx, sessionID, nil, comments)
+}
+
+func (s *ReactionService) loadSessionReactions(ctx context.Context, sessionID string, posts []*models.Post, comments []*models.Comment) error {
+	postsByID := make(map[int]*models.Post, len(posts))
+	commentsByID := make(map[int]*models.Comment, len(comments))
+	threads := make(map[int]bool)
+	for _, post := range posts {
+		post.MyReactions = []string{}
+		postsByID[post.ID] = post
+		threads[post.ID] = true
+	}
+	for _, comment := range comments {
+		comment.MyReactions = []string{}
+		commentsByID[comment.ID] = comment
+		threads[comment.PostID] = true
+	}
+	if sessionID == "" || len(threads) == 0 {
+		return nil
+	}
+
+	postIDs := make([]int, 0, len(threads))
+	for id := range threads {
+		postIDs = append(postIDs, id)
+	}
+
+	reactions, err := s.reactionRepo.GetBySession(ctx, sessionID, postIDs)
+	if err != nil {
+		return err
+	}
+
+	for _, reaction := range reactions {
+		if reaction.CommentID != nil {
+			if comment, ok := commentsByID[*reaction.CommentID]; ok {
+				comment.MyReactions = append(comment.MyReactions, reaction.Emoji)
+			}
+			continue
+		}
+		if post, ok := postsByID[reaction.PostID]; ok {
+			post.MyReactions = append(post.MyReactions, reaction.Emoji)
+		}
+	}
+
+	return nil
+}
+
+func containsString(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
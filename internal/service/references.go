@@ -0,0 +1,99 @@
+package service
+
+import (
+	"1337b04rd/internal/domain/models"
+	"1337b04rd/internal/domain/ports"
+	"1337b04rd/pkg/markup"
+	"context"
+)
+
+// saveCommentReferences parses the quotes in a comment's content, resolves
+// each one to the thread it lives in and stores them for the comment.
+func saveCommentReferences(ctx context.Context, commentRepo ports.CommentRepository, postRepo ports.PostRepository, referenceRepo ports.CommentReferenceRepository, comment *models.Comment) error {
+	viewer := models.Viewer{SessionID: comment.AuthorID}
+	var refs []*models.CommentReference
+	for _, quote := range markup.ParseQuotes(comment.Content) {
+		ref := &models.CommentReference{
+			CommentID:   comment.ID,
+			PostID:      comment.PostID,
+			TargetID:    quote.ID,
+			TargetBoard: quote.Board,
+		}
+
+		// Unknown targets, and ones the author cannot see, are kept as dead
+		// links without a thread
+		target, err := commentRepo.GetByID(ctx, quote.ID)
+		if err != nil {
+			return err
+		}
+		if target != nil && !viewer.CanSee(target.Visibility, target.AuthorID) {
+			target = nil
+		}
+		if target != nil && quote.Board != "" {
+			// ">>>/board/id" only resolves if the comment is on that board
+			post, err := postRepo.GetByID(ctx, target.PostID, viewer)
+			if err != nil {
+				return err
+			}
+			if post == nil || post.Board != quote.Board {
+				target = nil
+			}
+		}
+		if target != nil {
+			targetPostID := target.PostID
+			ref.TargetPostID = &targetPostID
+			ref.CrossThread = targetPostID != comment.PostID
+		}
+
+		refs = append(refs, ref)
+	}
+
+	if err := referenceRepo.ReplaceForComment(ctx, comment.ID, refs); err != nil {
+		return err
+	}
+
+	comment.Quotes = refs
+	if comment.Quotes == nil {
+		comment.Quotes = []*models.CommentReference{}
+	}
+	return nil
+}
+
+// loadCommentReferences fills in Quotes and Backlinks for the given
+// comments, leaving out backlinks from comments viewer may not see
+func loadCommentReferences(ctx context.Context, referenceRepo ports.CommentReferenceRepository, comments []*models.Comment, viewer models.Viewer) error {
+	if len(comments) == 0 {
+		return nil
+	}
+
+	ids := make([]int, 0, len(comments))
+	byID := make(map[int]*models.Comment, len(comments))
+	for _, comment := range comments {
+		comment.Quotes = []*models.CommentReference{}
+		comment.Backlinks = []*models.CommentReference{}
+		ids = append(ids, comment.ID)
+		byID[comment.ID] = comment
+	}
+
+	quotes, err := referenceRepo.GetByCommentIDs(ctx, ids)
+	if err != nil {
+		return err
+	}
+	for _, ref := range quotes {
+		if comment, ok := byID[ref.CommentID]; ok {
+			comment.Quotes = append(comment.Quotes, ref)
+		}
+	}
+
+	backlinks, err := referenceRepo.GetByTargetIDs(ctx, ids, viewer)
+	if err != nil {
+		return err
+	}
+	for _, ref := range backlinks {
+		if comment, ok := byID[ref.TargetID]; ok {
+			comment.Backlinks = append(comment.Backlinks, ref)
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,34 @@
+package service
+
+import (
+	"1337b04rd/internal/domain/models"
+	"1337b04rd/pkg/diff"
+)
+
+// diffRevisions fills in the changes each revision went through, comparing
+// it with the revision after it and the latest one with the current title
+// and content. A post or comment that was never edited has an empty list.
+func diffRevisions(revisions []*models.Revision, title, content string) []*models.Revision {
+	if revisions == nil {
+		return []*models.Revision{}
+	}
+
+	for i, revision := range revisions {
+		nextTitle, nextContent := title, content
+		if i+1 < len(revisions) {
+			nextTitle, nextContent = revisions[i+1].Title, revisions[i+1].Content
+		}
+		revision.TitleDiff = diffLines(revision.Title, nextTitle)
+		revision.ContentDiff = diffLines(revision.Content, nextContent)
+	}
+	return revisions
+}
+
+func diffLines(before, after string) []*models.DiffLine {
+	lines := diff.Lines(before, after)
+	out := make([]*models.DiffLine, len(lines))
+	for i, line := range lines {
+		out[i] = &models.DiffLine{Op: string(line.Op), Text: line.Text}
+	}
+	return out
+}
@@ -15,13 +15,15 @@ import (
 )
 
 type SessionService struct {
+	uow                ports.UnitOfWork
 	sessionRepo        ports.SessionRepository
 	rickAndMortyClient *externalapi.RickAndMortyClient
 	storage            *storage.MinioClient
 }
 
-func NewSessionService(sessionRepo ports.SessionRepository, storage *storage.MinioClient) *SessionService {
+func NewSessionService(uow ports.UnitOfWork, sessionRepo ports.SessionRepository, storage *storage.MinioClient) *SessionService {
 	return &SessionService{
+		uow:                uow,
 		sessionRepo:        sessionRepo,
 		rickAndMortyClient: externalapi.NewRickAndMortyClient(),
 		storage:            storage,
@@ -96,8 +98,16 @@ func (s *SessionService) CreateSession(ctx context.Context, session *models.Sess
 		session.Age = "Unknown"
 	}
 
-	// Create session in database
-	err = s.sessionRepo.Create(ctx, session)
+	// Create session in database; a character image uploaded for it is
+	// removed again if that fails
+	err = s.uow.Do(ctx, func(work ports.Work) error {
+		work.OnRollback(func(ctx context.Context) {
+			if err := s.storage.DeleteImageByURL(ctx, session.Image); err != nil {
+				log.Printf("Warning: Failed to remove character image of session %s: %v", session.ID, err)
+			}
+		})
+		return work.Sessions().Create(ctx, session)
+	})
 	if err != nil {
 		return fmt.Errorf("failed to create session in database: %w", err)
 	}
@@ -127,43 +137,37 @@ func (s *SessionService) GetSession(ctx context.Context, id string) (*models.Ses
 }
 
 func (s *SessionService) UpdateSession(ctx context.Context, session *models.Session) error {
-	// Check if session exists
-	existingSession, err := s.sessionRepo.GetByID(ctx, session.ID)
-	if err != nil {
-		return err
-	}
-
-	if existingSession == nil {
-		return errors.New("session not found")
-	}
+	return s.uow.Do(ctx, func(work ports.Work) error {
+		// Check if session exists
+		existingSession, err := work.Sessions().GetByID(ctx, session.ID)
+		if err != nil {
+			return err
+		}
 
-	// Update session in database
-	err = s.sessionRepo.Update(ctx, session)
-	if err != nil {
-		return err
-	}
+		if existingSession == nil {
+			return errors.New("session not found")
+		}
 
-	return nil
+		// Update session in database
+		return work.Sessions().Update(ctx, session)
+	})
 }
 
 func (s *SessionService) DeleteSession(ctx context.Context, id string) error {
-	// Check if session exists
-	existingSession, err := s.sessionRepo.GetByID(ctx, id)
-	if err != nil {
-		return err
-	}
-
-	if existingSession == nil {
-		return errors.New("session not found")
-	}
+	return s.uow.Do(ctx, func(work ports.Work) error {
+		// Check if session exists
+		existingSession, err := work.Sessions().GetByID(ctx, id)
+		if err != nil {
+			return err
+		}
 
-	// Delete session from database
-	err = s.sessionRepo.Delete(ctx, id)
-	if err != nil {
-		return err
-	}
+		if existingSession == nil {
+			return errors.New("session not found")
+		}
 
-	return nil
+		// Delete session from database
+		return work.Sessions().Delete(ctx, id)
+	})
 }
 
 func (s *SessionService) CleanupExpiredSessions(ctx context.Context) error {
@@ -0,0 +1,484 @@
+package service
+
+import (
+	"1337b04rd/internal/adapters/storage"
+	"1337b04rd/internal/domain/models"
+	"1337b04rd/internal/domain/ports"
+	"1337b04rd/pkg/markup"
+	"archive/zip"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"sort"
+	"time"
+	"unicode/utf8"
+)
+
+const (
+	// threadManifestName is the manifest file at the root of an export
+	threadManifestName = "thread.json"
+
+	// Upper bounds for entries read from an uploaded archive
+	maxManifestSize    = 16 << 20
+	maxImportImageSize = 32 << 20
+)
+
+// TransferService moves whole threads between deployments as ZIP archives
+// holding a thread.json manifest and copies of every referenced image.
+type TransferService struct {
+	uow            ports.UnitOfWork
+	postRepo       ports.PostRepository
+	commentRepo    ports.CommentRepository
+	referenceRepo  ports.CommentReferenceRepository
+	boardRepo      ports.BoardRepository
+	attachmentRepo ports.AttachmentRepository
+	objectRepo     ports.ObjectRepository
+	storage        *storage.MinioClient
+	events         ports.EventPublisher
+}
+
+func NewTransferService(uow ports.UnitOfWork, postRepo ports.PostRepository, commentRepo ports.CommentRepository, referenceRepo ports.CommentReferenceRepository, boardRepo ports.BoardRepository, attachmentRepo ports.AttachmentRepository, objectRepo ports.ObjectRepository, storage *storage.MinioClient, events ports.EventPublisher) *TransferService {
+	return &TransferService{
+		uow:            uow,
+		postRepo:       postRepo,
+		commentRepo:    commentRepo,
+		referenceRepo:  referenceRepo,
+		boardRepo:      boardRepo,
+		attachmentRepo: attachmentRepo,
+		objectRepo:     objectRepo,
+		storage:        storage,
+		events:         events,
+	}
+}
+
+// ExportThread writes a ZIP archive of the thread to w. Content waiting for
+// approval is left out, as it is for anonymous readers.
+func (s *TransferService) ExportThread(ctx context.Context, postID int, w io.Writer) error {
+	post, err := s.postRepo.GetByID(ctx, postID, models.Viewer{})
+	if err != nil {
+		return err
+	}
+	if post == nil {
+		return models.ErrPostNotFound
+	}
+
+	comments, err := s.commentRepo.GetByPostID(ctx, postID, models.Viewer{})
+	if err != nil {
+		return err
+	}
+	if err := loadCommentReferences(ctx, s.referenceRepo, comments, models.Viewer{}); err != nil {
+		return err
+	}
+
+	// Attachments held for review are left out along with pending content
+	post.Comments = comments
+	if err := loadAttachments(ctx, s.attachmentRepo, []*models.Post{post}); err != nil {
+		return err
+	}
+	post.Comments = nil
+
+	manifest := &models.ThreadExport{
+		Version:    models.ThreadExportVersion,
+		ExportedAt: time.Now().UTC(),
+		Post:       post,
+		Comments:   comments,
+		References: []*models.CommentReference{},
+		Images:     []*models.ExportedImage{},
+	}
+
+	// References are listed once at the top level instead of per comment
+	for _, comment := range comments {
+		manifest.References = append(manifest.References, comment.Quotes...)
+		comment.Quotes = nil
+		comment.Backlinks = nil
+	}
+
+	imageURLs := append([]string{post.ImageURL, post.AuthorImage}, attachmentURLs(post.Attachments)...)
+	for _, comment := range comments {
+		imageURLs = append(imageURLs, comment.ImageURL, comment.AuthorImage)
+		imageURLs = append(imageURLs, attachmentURLs(comment.Attachments)...)
+	}
+
+	zw := zip.NewWriter(w)
+	seenURLs := make(map[string]bool)
+	seenPaths := make(map[string]bool)
+	for _, imageURL := range imageURLs {
+		if imageURL == "" || seenURLs[imageURL] {
+			continue
+		}
+		seenURLs[imageURL] = true
+
+		bucket, objectName, ok := storage.ParseMinioURL(imageURL)
+		if !ok || !s.storage.IsKnownBucket(bucket) {
+			continue
+		}
+
+		data, contentType, err := s.storage.GetImage(ctx, bucket, objectName)
+		if err != nil {
+			// A missing image should not make the whole thread unexportable
+			log.Printf("Warning: Failed to export image %s: %v", imageURL, err)
+			continue
+		}
+
+		sum := sha256.Sum256(data)
+		checksum := hex.EncodeToString(sum[:])
+		path := "images/" + bucket + "/" + checksum + storage.ObjectExt(objectName)
+
+		if !seenPaths[path] {
+			seenPaths[path] = true
+			entry, err := zw.Create(path)
+			if err != nil {
+				return err
+			}
+			if _, err := entry.Write(data); err != nil {
+				return err
+			}
+		}
+
+		manifest.Images = append(manifest.Images, &models.ExportedImage{
+			URL:         imageURL,
+			Bucket:      bucket,
+			Path:        path,
+			ContentType: contentType,
+			SHA256:      checksum,
+		})
+	}
+
+	entry, err := zw.Create(threadManifestName)
+	if err != nil {
+		return err
+	}
+	encoder := json.NewEncoder(entry)
+	encoder.SetIndent("", "  ")
+	if err := encoder.Encode(manifest); err != nil {
+		return err
+	}
+
+	return zw.Close()
+}
+
+// ImportThread restores a thread from an export archive as a new thread on
+// board (or the thread's original board when empty). Posts and comments get
+// new IDs and quotes inside the thread are rewritten to match. Images are
+// stored under their content hash like any other file, so importing the
+// same archive again shares the objects stored the first time.
+func (s *TransferService) ImportThread(ctx context.Context, r io.ReaderAt, size int64, board string) (*models.Post, error) {
+	zr, err := zip.NewReader(r, size)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", models.ErrInvalidExport, err)
+	}
+
+	var manifest models.ThreadExport
+	data, err := readArchiveFile(zr, threadManifestName, maxManifestSize)
+	if err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(data, &manifest); err != nil {
+		return nil, fmt.Errorf("%w: %v", models.ErrInvalidExport, err)
+	}
+	if manifest.Version != models.ThreadExportVersion {
+		return nil, fmt.Errorf("%w: unsupported version %d", models.ErrInvalidExport, manifest.Version)
+	}
+	if manifest.Post == nil {
+		return nil, fmt.Errorf("%w: missing post", models.ErrInvalidExport)
+	}
+
+	sourceBoard := manifest.Post.Board
+	if board == "" {
+		board = sourceBoard
+	}
+	if board == "" {
+		board = models.DefaultBoard
+	}
+	existing, err := s.boardRepo.GetBySlug(ctx, board)
+	if err != nil {
+		return nil, err
+	}
+	if existing == nil {
+		return nil, models.ErrBoardNotFound
+	}
+
+	post := manifest.Post
+	post.ID = 0
+	post.Board = board
+	post.Comments = nil
+
+	// The thread, its comments and the references on its images are saved
+	// together or not at all
+	var pruned []*models.PrunedThread
+	var imported []string
+	err = s.uow.Do(ctx, func(work ports.Work) error {
+		imageURLs, stored, err := s.importImages(ctx, work, zr, manifest.Images)
+		if err != nil {
+			return err
+		}
+		imported = stored
+		mapImage := func(imageURL string) string {
+			if newURL, ok := imageURLs[imageURL]; ok {
+				return newURL
+			}
+			// Objects of the source deployment that were not exported are dropped
+			if _, _, ok := storage.ParseMinioURL(imageURL); ok {
+				return ""
+			}
+			return imageURL
+		}
+		post.ImageURL = mapImage(post.ImageURL)
+		post.AuthorImage = mapImage(post.AuthorImage)
+
+		pruned, err = work.Posts().Create(ctx, post)
+		if err != nil {
+			return err
+		}
+		if err := restoreThread(ctx, work, post, manifest.Comments, sourceBoard, mapImage); err != nil {
+			return err
+		}
+		return s.acquireThreadObjects(ctx, work, post, manifest.Comments)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	// The thread holds its own references now, so objects it ended up not
+	// using go away
+	releaseObjects(ctx, s.storage, s.objectRepo, imported)
+	releasePrunedThreads(ctx, s.storage, s.objectRepo, pruned)
+	for _, thread := range pruned {
+		s.events.Publish(models.Event{Type: models.EventThreadPruned, Board: thread.Board, Data: thread})
+	}
+
+	return post, nil
+}
+
+// importImages stores the archived images under their content hash and
+// maps each original URL to the URL of its copy, also returning the URL of
+// every object stored. Each object is stored with
+// a reference of the import's own, which keeps it alive until the thread
+// has taken its references; it is released again if work is rolled back.
+func (s *TransferService) importImages(ctx context.Context, work ports.Work, zr *zip.Reader, images []*models.ExportedImage) (map[string]string, []string, error) {
+	urls := make(map[string]string, len(images))
+	byKey := make(map[string]string, len(images))
+	var stored []string
+	for _, image := range images {
+		if !s.storage.IsKnownBucket(image.Bucket) {
+			return nil, nil, fmt.Errorf("%w: unknown bucket %q", models.ErrInvalidExport, image.Bucket)
+		}
+
+		data, err := readArchiveFile(zr, image.Path, maxImportImageSize)
+		if err != nil {
+			return nil, nil, err
+		}
+
+		sum := sha256.Sum256(data)
+		checksum := hex.EncodeToString(sum[:])
+		if checksum != image.SHA256 {
+			return nil, nil, fmt.Errorf("%w: checksum mismatch for %s", models.ErrInvalidExport, image.Path)
+		}
+
+		// Copies of one file under several URLs are stored once
+		key := image.Bucket + "/" + storage.ContentObjectName(data, image.ContentType)
+		if newURL, ok := byKey[key]; ok {
+			urls[image.URL] = newURL
+			continue
+		}
+
+		newURL, err := storeObject(ctx, s.storage, s.objectRepo, image.Bucket, data, image.ContentType)
+		if err != nil {
+			return nil, nil, err
+		}
+		work.OnRollback(func(ctx context.Context) {
+			releaseObjects(ctx, s.storage, s.objectRepo, []string{newURL})
+		})
+		byKey[key] = newURL
+		stored = append(stored, newURL)
+		urls[image.URL] = newURL
+	}
+
+	return urls, stored, nil
+}
+
+// acquireThreadObjects takes the references an imported thread holds on
+// its files, the way deleting the thread releases them: one per attachment
+// file and one per other image of the thread. Author images are counted
+// too, though no thread releases them. The references are released again
+// if work is rolled back.
+func (s *TransferService) acquireThreadObjects(ctx context.Context, work ports.Work, post *models.Post, comments []*models.Comment) error {
+	attachments := post.Attachments
+	images := []string{post.ImageURL, post.AuthorImage}
+	for _, comment := range comments {
+		attachments = append(attachments, comment.Attachments...)
+		images = append(images, comment.ImageURL, comment.AuthorImage)
+	}
+
+	objectURLs := attachmentURLs(attachments)
+	seen := make(map[string]bool, len(attachments))
+	for _, attachment := range attachments {
+		seen[attachment.URL] = true
+	}
+	for _, imageURL := range images {
+		if imageURL != "" && !seen[imageURL] {
+			seen[imageURL] = true
+			objectURLs = append(objectURLs, imageURL)
+		}
+	}
+
+	for _, objectURL := range objectURLs {
+		bucket, objectName, ok := storage.ParseMinioURL(objectURL)
+		if !ok {
+			continue
+		}
+		if err := s.objectRepo.Acquire(ctx, bucket, objectName); err != nil {
+			return err
+		}
+		work.OnRollback(func(ctx context.Context) {
+			releaseObjects(ctx, s.storage, s.objectRepo, []string{objectURL})
+		})
+	}
+	return nil
+}
+
+// restoreThread recreates the comments and attachments of an imported
+// thread under post and rewrites quotes between them to the new IDs
+func restoreThread(ctx context.Context, work ports.Work, post *models.Post, comments []*models.Comment, sourceBoard string, mapImage func(string) string) error {
+	if post.IsArchive {
+		if err := work.Posts().Archive(ctx, post.ID); err != nil {
+			return err
+		}
+	}
+	if post.IsSticky {
+		if err := work.Posts().SetSticky(ctx, post.ID, true); err != nil {
+			return err
+		}
+	}
+	if post.IsLocked {
+		if err := work.Posts().SetLocked(ctx, post.ID, true); err != nil {
+			return err
+		}
+	}
+
+	if err := restoreAttachments(ctx, work, post.ID, nil, &post.Attachments, mapImage); err != nil {
+		return err
+	}
+
+	// Creating in original ID order guarantees parents exist before replies
+	sort.Slice(comments, func(i, j int) bool { return comments[i].ID < comments[j].ID })
+
+	ids := make(map[int]int, len(comments))
+	for _, comment := range comments {
+		oldID := comment.ID
+		comment.ID = 0
+		comment.PostID = post.ID
+		comment.ImageURL = mapImage(comment.ImageURL)
+		comment.AuthorImage = mapImage(comment.AuthorImage)
+		comment.Quotes = nil
+		comment.Backlinks = nil
+		if comment.ReplyToCommentID != nil {
+			if newID, ok := ids[*comment.ReplyToCommentID]; ok {
+				comment.ReplyToCommentID = &newID
+			} else {
+				comment.ReplyToCommentID = nil
+			}
+		}
+
+		if err := work.Comments().Create(ctx, comment); err != nil {
+			return err
+		}
+		ids[oldID] = comment.ID
+
+		commentID := comment.ID
+		if err := restoreAttachments(ctx, work, post.ID, &commentID, &comment.Attachments, mapImage); err != nil {
+			return err
+		}
+	}
+
+	for _, comment := range comments {
+		content := markup.RemapQuotes(comment.Content, ids, sourceBoard, post.Board)
+		if content != comment.Content {
+			comment.Content = content
+			comment.ContentHTML = markup.Render(content)
+			if err := work.Comments().Update(ctx, comment); err != nil {
+				return err
+			}
+		}
+
+		if err := saveCommentReferences(ctx, work.Comments(), work.Posts(), work.References(), comment); err != nil {
+			return err
+		}
+	}
+
+	content := markup.RemapQuotes(post.Content, ids, sourceBoard, post.Board)
+	if content != post.Content {
+		post.Content = content
+		post.ContentHTML = markup.Render(content)
+		if err := work.Posts().Update(ctx, post); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// restoreAttachments saves the exported attachments of a post or comment
+// with their files mapped to the imported copies. Attachments whose file
+// was not exported are dropped.
+func restoreAttachments(ctx context.Context, work ports.Work, postID int, commentID *int, attachments *[]*models.Attachment, mapImage func(string) string) error {
+	restored := make([]*models.Attachment, 0, len(*attachments))
+	for _, attachment := range *attachments {
+		attachment.URL = mapImage(attachment.URL)
+		if attachment.URL == "" {
+			continue
+		}
+		if utf8.RuneCountInString(attachment.AltText) > models.MaxAltTextLength {
+			return fmt.Errorf("%w: alt text of %s is too long", models.ErrInvalidExport, attachment.Filename)
+		}
+
+		attachment.ID = 0
+		attachment.ThumbnailURL = mapImage(attachment.ThumbnailURL)
+		attachment.Filename = truncate(attachment.Filename, maxFilenameLength)
+		attachment.Held = false
+		restored = append(restored, attachment)
+	}
+
+	*attachments = restored
+	if len(restored) == 0 {
+		return nil
+	}
+	_, err := work.Attachments().Replace(ctx, postID, commentID, restored)
+	return err
+}
+
+// attachmentURLs returns the URLs of the files and thumbnails of attachments
+func attachmentURLs(attachments []*models.Attachment) []string {
+	urls := make([]string, 0, 2*len(attachments))
+	for _, attachment := range attachments {
+		urls = append(urls, attachment.URL)
+		if attachment.ThumbnailURL != "" {
+			urls = append(urls, attachment.ThumbnailURL)
+		}
+	}
+	return urls
+}
+
+// readArchiveFile reads a named entry of an archive, refusing entries that
+// are missing or larger than limit
+func readArchiveFile(zr *zip.Reader, name string, limit int64) ([]byte, error) {
+	file, err := zr.Open(name)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %s: %v", models.ErrInvalidExport, name, err)
+	}
+	defer file.Close()
+
+	data, err := io.ReadAll(io.LimitReader(file, limit+1))
+	if err != nil {
+		return nil, fmt.Errorf("%w: %s: %v", models.ErrInvalidExport, name, err)
+	}
+	if int64(len(data)) > limit {
+		return nil, fmt.Errorf("%w: %s is too large", models.ErrInvalidExport, name)
+	}
+
+	return data, nil
+}
@@ -0,0 +1,217 @@
+package service
+
+import (
+	"1337b04rd/internal/adapters/storage"
+	"1337b04rd/internal/domain/models"
+	"1337b04rd/internal/domain/ports"
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+const (
+	// collectBatchSize bounds how many expired uploads one query loads
+	collectBatchSize = 100
+
+	// collectGrace lets a PUT that started just before its URL expired
+	// finish before the object is collected
+	collectGrace = 5 * time.Minute
+)
+
+// imageTypes are the image content types accepted as attachments; which
+// video types are accepted is configured
+var imageTypes = []string{"image/jpeg", "image/png", "image/gif"}
+
+type UploadService struct {
+	uploadRepo ports.UploadRepository
+	boardRepo  ports.BoardRepository
+	storage    *storage.MinioClient
+	videoTypes []string
+	expiry     time.Duration
+}
+
+func NewUploadService(uploadRepo ports.UploadRepository, boardRepo ports.BoardRepository, storage *storage.MinioClient, videoTypes []string, expiry time.Duration) *UploadService {
+	return &UploadService{
+		uploadRepo: uploadRepo,
+		boardRepo:  boardRepo,
+		storage:    storage,
+		videoTypes: videoTypes,
+		expiry:     expiry,
+	}
+}
+
+// CreateUpload reserves an object in the bucket of the target and returns a
+// presigned URL through which the client stores the file itself. The
+// announced size is checked against the file size limit of the board the
+// file will be posted to; the file itself is checked against the board's
+// limits once a post or comment claims it.
+func (s *UploadService) CreateUpload(ctx context.Context, sessionID string, target models.UploadTarget, boardSlug, filename, contentType string, size int64) (*models.PresignedUpload, error) {
+	var bucket string
+	switch target {
+	case models.UploadTargetPost:
+		bucket = s.storage.GetBucketName("post")
+	case models.UploadTargetComment:
+		bucket = s.storage.GetBucketName("comment")
+	default:
+		return nil, fmt.Errorf("%w: upload target must be post or comment", models.ErrInvalidAttachment)
+	}
+
+	if filename == "" {
+		return nil, fmt.Errorf("%w: filename is required", models.ErrInvalidAttachment)
+	}
+	if !containsString(imageTypes, contentType) && !containsString(s.videoTypes, contentType) {
+		return nil, fmt.Errorf("%w: %q files are not accepted", models.ErrInvalidAttachment, contentType)
+	}
+
+	if boardSlug == "" {
+		boardSlug = models.DefaultBoard
+	}
+	board, err := s.boardRepo.GetBySlug(ctx, boardSlug)
+	if err != nil {
+		return nil, err
+	}
+	if board == nil {
+		return nil, models.ErrBoardNotFound
+	}
+	if size <= 0 || size > board.MaxFileSize {
+		return nil, fmt.Errorf("%w: size must be between 1 byte and the %d KB allowed on /%s/", models.ErrInvalidAttachment, board.MaxFileSize>>10, board.Slug)
+	}
+
+	id, err := generateUploadID()
+	if err != nil {
+		return nil, err
+	}
+
+	now := time.Now()
+	upload := &models.Upload{
+		ID:          id,
+		SessionID:   sessionID,
+		Bucket:      bucket,
+		ObjectName:  storage.UploadPrefix + id + storage.ObjectExt(filename),
+		Filename:    truncate(filename, maxFilenameLength),
+		ContentType: contentType,
+		Size:        size,
+		CreatedAt:   now,
+		ExpiresAt:   now.Add(s.expiry),
+	}
+
+	url, err := s.storage.PresignUpload(ctx, bucket, upload.ObjectName, contentType, size, s.expiry)
+	if err != nil {
+		return nil, err
+	}
+	if err := s.uploadRepo.Create(ctx, upload); err != nil {
+		return nil, err
+	}
+
+	return &models.PresignedUpload{
+		Upload: upload,
+		URL:    url,
+		Method: http.MethodPut,
+		Headers: map[string]string{
+			"Content-Type":   contentType,
+			"Content-Length": strconv.FormatInt(size, 10),
+		},
+	}, nil
+}
+
+// CollectExpiredUploads deletes the objects and rows of uploads that were
+// never claimed and returns how many were collected
+func (s *UploadService) CollectExpiredUploads(ctx context.Context) (int, error) {
+	collected := 0
+	for {
+		uploads, err := s.uploadRepo.GetExpired(ctx, time.Now().Add(-collectGrace), collectBatchSize)
+		if err != nil {
+			return collected, err
+		}
+
+		for _, upload := range uploads {
+			// The object goes first so a failure leaves the row to retry
+			if err := s.storage.DeleteImage(ctx, upload.Bucket, upload.ObjectName); err != nil {
+				return collected, fmt.Errorf("failed to delete upload %s: %w", upload.ID, err)
+			}
+			if err := s.uploadRepo.Delete(ctx, upload.ID); err != nil {
+				return collected, err
+			}
+			collected++
+		}
+
+		if len(uploads) < collectBatchSize {
+			return collected, nil
+		}
+	}
+}
+
+// generateUploadID returns a random, unguessable upload ID
+func generateUploadID() (string, error) {
+	randomBytes := make([]byte, 16)
+	if _, err := rand.Read(randomBytes); err != nil {
+		return "", fmt.Errorf("failed to generate upload ID: %w", err)
+	}
+	return hex.EncodeToString(randomBytes), nil
+}
+
+// claimUploads claims the uploads referenced by ID on behalf of the session,
+// checking that each object was stored with the size and type it was
+// announced with. It runs in the unit of work saving the post or comment,
+// so a rollback restores the claims and leaves the objects to be claimed
+// again or collected once they expire. storeAttachments then checks the
+// files in place and copies them to their content hash; the claimed
+// objects are removed once the work is committed.
+func claimUploads(ctx context.Context, uploadRepo ports.UploadRepository, objects *storage.MinioClient, bucket, sessionID string, uploads []*models.AttachmentUpload, now time.Time) error {
+	for _, file := range uploads {
+		if file.UploadID == "" {
+			continue
+		}
+
+		upload, err := uploadRepo.Claim(ctx, file.UploadID, sessionID, bucket, now)
+		if err != nil {
+			return err
+		}
+		if upload == nil {
+			return fmt.Errorf("%w: upload %s is unknown, expired or already used", models.ErrUploadNotFound, file.UploadID)
+		}
+
+		file.ObjectURL = storage.ObjectURL(upload.Bucket, upload.ObjectName)
+		file.Filename = upload.Filename
+		file.ContentType = upload.ContentType
+		if err := checkUpload(ctx, objects, upload); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func checkUpload(ctx context.Context, objects *storage.MinioClient, upload *models.Upload) error {
+	size, contentType, err := objects.StatObject(ctx, upload.Bucket, upload.ObjectName)
+	if errors.Is(err, storage.ErrObjectNotFound) {
+		return fmt.Errorf("%w: %s was never uploaded", models.ErrInvalidAttachment, upload.Filename)
+	}
+	if err != nil {
+		return err
+	}
+	if size != upload.Size || contentType != upload.ContentType {
+		return fmt.Errorf("%w: %s does not match the size or type it was announced with", models.ErrInvalidAttachment, upload.Filename)
+	}
+	return nil
+}
+
+// removeClaimedObjects deletes the objects of claimed uploads once their
+// files are stored under their content hash, logging the ones that could
+// not be removed
+func removeClaimedObjects(ctx context.Context, objects *storage.MinioClient, uploads []*models.AttachmentUpload) {
+	for _, file := range uploads {
+		if file.ObjectURL == "" {
+			continue
+		}
+		if err := objects.DeleteImageByURL(ctx, file.ObjectURL); err != nil {
+			log.Printf("Warning: Failed to delete uploaded object %s: %v", file.ObjectURL, err)
+		}
+	}
+}
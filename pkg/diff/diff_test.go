@@ -0,0 +1,44 @@
+package diff
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestLines(t *testing.T) {
+	tests := []struct {
+		name string
+		a, b string
+		want []Line
+	}{
+		{"unchanged", "a\nb", "a\nb", []Line{{Equal, "a"}, {Equal, "b"}}},
+		{"both empty", "", "", []Line{}},
+		{"added", "", "a", []Line{{Insert, "a"}}},
+		{"removed", "a", "", []Line{{Delete, "a"}}},
+		{"changed line", "a\nb\nc", "a\nx\nc", []Line{{Equal, "a"}, {Delete, "b"}, {Insert, "x"}, {Equal, "c"}}},
+		{"moved line", "a\nb\nc", "b\nc\na", []Line{{Delete, "a"}, {Equal, "b"}, {Equal, "c"}, {Insert, "a"}}},
+		{"crlf", "a\r\nb", "a\nb", []Line{{Equal, "a"}, {Equal, "b"}}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := Lines(tt.a, tt.b); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("Lines(%q, %q) = %v, want %v", tt.a, tt.b, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestLinesLargeMiddle(t *testing.T) {
+	a := strings.Repeat("a\n", 2000) + "end"
+	b := strings.Repeat("b\n", 2000) + "end"
+
+	got := Lines(a, b)
+	if len(got) != 4001 {
+		t.Fatalf("len(Lines) = %d, want 4001", len(got))
+	}
+	if got[0].Op != Delete || got[2000].Op != Insert || got[4000] != (Line{Equal, "end"}) {
+		t.Errorf("Lines did not fall back to replacing the middle: %v, %v, %v", got[0], got[2000], got[4000])
+	}
+}
@@ -0,0 +1,28 @@
+// Package hashkey provides the keys that server-side hashes are keyed with.
+package hashkey
+
+import (
+	"crypto/rand"
+	"fmt"
+	"log"
+)
+
+// keySize is the size of generated keys in bytes
+const keySize = 32
+
+// New returns the configured secret as a key. Without one, hashes could
+// simply be precomputed, so a random per-process key is generated instead
+// and warning is logged: whatever depends on the hashes will not survive a
+// restart.
+func New(configured, warning string) ([]byte, error) {
+	if configured != "" {
+		return []byte(configured), nil
+	}
+
+	log.Printf("Warning: %s", warning)
+	key := make([]byte, keySize)
+	if _, err := rand.Read(key); err != nil {
+		return nil, fmt.Errorf("failed to generate key: %w", err)
+	}
+	return key, nil
+}
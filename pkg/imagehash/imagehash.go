@@ -0,0 +1,105 @@
+package imagehash
+
+import (
+	"bytes"
+	"fmt"
+	"image"
+	"math/bits"
+	"strconv"
+
+	// Register the decoders for the formats thumbnails and uploads come in
+	_ "image/gif"
+	_ "image/jpeg"
+	_ "image/png"
+)
+
+// Hash is a 64-bit perceptual hash. Images that look alike have hashes that
+// differ in few bits, even after resizing or re-encoding.
+type Hash uint64
+
+// Bits is the number of bits in a Hash, the largest possible distance
+const Bits = 64
+
+// Compute decodes an image and returns its difference hash
+func Compute(data []byte) (Hash, error) {
+	img, _, err := image.Decode(bytes.NewReader(data))
+	if err != nil {
+		return 0, err
+	}
+	return DHash(img), nil
+}
+
+// DHash computes a difference hash: the image is reduced to 9x8 grayscale
+// cells and each bit records whether a cell is brighter than its right
+// neighbour
+func DHash(img image.Image) Hash {
+	var cells [8][9]float64
+	bounds := img.Bounds()
+	width, height := bounds.Dx(), bounds.Dy()
+	if width == 0 || height == 0 {
+		return 0
+	}
+
+	// Average the luminance of the source pixels each cell covers
+	for y := 0; y < 8; y++ {
+		y0, y1 := span(y, 8, height)
+		for x := 0; x < 9; x++ {
+			x0, x1 := span(x, 9, width)
+			var sum float64
+			for sy := y0; sy < y1; sy++ {
+				for sx := x0; sx < x1; sx++ {
+					r, g, b, _ := img.At(bounds.Min.X+sx, bounds.Min.Y+sy).RGBA()
+					sum += 0.299*float64(r) + 0.587*float64(g) + 0.114*float64(b)
+				}
+			}
+			cells[y][x] = sum / float64((y1-y0)*(x1-x0))
+		}
+	}
+
+	var hash Hash
+	for y := 0; y < 8; y++ {
+		for x := 0; x < 8; x++ {
+			hash <<= 1
+			if cells[y][x] > cells[y][x+1] {
+				hash |= 1
+			}
+		}
+	}
+	return hash
+}
+
+// span returns the source range covered by cell i of n over size pixels,
+// at least one pixel wide
+func span(i, n, size int) (int, int) {
+	start := i * size / n
+	end := (i + 1) * size / n
+	if end <= start {
+		end = start + 1
+	}
+	if end > size {
+		start, end = size-1, size
+	}
+	return start, end
+}
+
+// Distance returns the number of bits in which two hashes differ
+func Distance(a, b Hash) int {
+	return bits.OnesCount64(uint64(a ^ b))
+}
+
+// String formats the hash as 16 hexadecimal digits
+func (h Hash) String() string {
+	return fmt.Sprintf("%016x", uint64(h))
+}
+
+// Parse reads a hash formatted by String
+func Parse(s string) (Hash, error) {
+	if len(s) != 16 {
+		return 0, fmt.Errorf("image hash must be 16 hexadecimal digits")
+	}
+	value, err := strconv.ParseUint(s, 16, 64)
+	if err != nil {
+		return 0, fmt.Errorf("image hash must be 16 hexadecimal digits")
+	}
+	return Hash(value), nil
+}
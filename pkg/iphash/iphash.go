@@ -0,0 +1,61 @@
+package iphash
+
+import (
+	"1337b04rd/pkg/hashkey"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"net"
+	"net/http"
+	"strings"
+)
+
+// Hasher turns client addresses into keyed hashes, so posts can be tied to
+// the address they came from without the address ever being stored
+type Hasher struct {
+	secret []byte
+
+	// trustProxy takes the client address from X-Real-IP or
+	// X-Forwarded-For, as set by a reverse proxy in front of the server
+	trustProxy bool
+}
+
+func NewHasher(secret string, trustProxy bool) (*Hasher, error) {
+	key, err := hashkey.New(secret, "IP_HASH_SECRET is not set, IP quarantines will not survive a restart")
+	if err != nil {
+		return nil, err
+	}
+	return &Hasher{secret: key, trustProxy: trustProxy}, nil
+}
+
+// Hash returns the hex-encoded hash of an address
+func (h *Hasher) Hash(ip string) string {
+	mac := hmac.New(sha256.New, h.secret)
+	mac.Write([]byte(ip))
+	return hex.EncodeToString(mac.Sum(nil))[:32]
+}
+
+// Request returns the hash of the address a request came from
+func (h *Hasher) Request(r *http.Request) string {
+	return h.Hash(ClientIP(r, h.trustProxy))
+}
+
+// ClientIP returns the address a request came from. Proxy headers are only
+// looked at when trustProxy is set, since clients can send them too.
+func ClientIP(r *http.Request, trustProxy bool) string {
+	if trustProxy {
+		if ip := strings.TrimSpace(r.Header.Get("X-Real-IP")); ip != "" {
+			return ip
+		}
+		if forwarded := r.Header.Get("X-Forwarded-For"); forwarded != "" {
+			ip, _, _ := strings.Cut(forwarded, ",")
+			return strings.TrimSpace(ip)
+		}
+	}
+
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
+}
@@ -0,0 +1,71 @@
+package markup
+
+import (
+	"regexp"
+	"strconv"
+)
+
+// Quote is a ">>id" or ">>>/board/id" reference found in content
+type Quote struct {
+	Board string
+	ID    int
+}
+
+var quotePattern = regexp.MustCompile(`>>>/([a-z0-9]+)/(\d+)|>>(\d+)`)
+
+// ParseQuotes returns every distinct quote in content in order of appearance
+func ParseQuotes(content string) []Quote {
+	var quotes []Quote
+	seen := make(map[Quote]bool)
+
+	for _, match := range quotePattern.FindAllStringSubmatch(content, -1) {
+		var quote Quote
+		idStr := match[3]
+		if match[2] != "" {
+			quote.Board = match[1]
+			idStr = match[2]
+		}
+
+		id, err := strconv.Atoi(idStr)
+		if err != nil || id <= 0 {
+			continue
+		}
+		quote.ID = id
+
+		if seen[quote] {
+			continue
+		}
+		seen[quote] = true
+		quotes = append(quotes, quote)
+	}
+
+	return quotes
+}
+
+// RemapQuotes rewrites quotes of the comment IDs in ids to their new IDs.
+// Board-qualified quotes are only rewritten when they name fromBoard, and
+// then point at toBoard instead. Other quotes are left untouched.
+func RemapQuotes(content string, ids map[int]int, fromBoard, toBoard string) string {
+	return quotePattern.ReplaceAllStringFunc(content, func(match string) string {
+		m := quotePattern.FindStringSubmatch(match)
+		if m[2] != "" {
+			id, err := strconv.Atoi(m[2])
+			if err != nil || m[1] != fromBoard {
+				return match
+			}
+			if newID, ok := ids[id]; ok {
+				return ">>>/" + toBoard + "/" + strconv.Itoa(newID)
+			}
+			return match
+		}
+
+		id, err := strconv.Atoi(m[3])
+		if err != nil {
+			return match
+		}
+		if newID, ok := ids[id]; ok {
+			return ">>" + strconv.Itoa(newID)
+		}
+		return match
+	})
+}
@@ -0,0 +1,128 @@
+package markup
+
+import (
+	"html"
+	"regexp"
+	"strings"
+)
+
+var (
+	codePattern      = regexp.MustCompile("`([^`]+)`")
+	quoteLinePattern = regexp.MustCompile(`^(>>\d|>>>/[a-z0-9]+/\d)`)
+	trailingPunct    = ".,;:!?)]"
+)
+
+// inlinePattern matches spoilers, bold text, URLs and quote links. Groups:
+// 1 spoiler body, 2 bold body, 3 URL, 4+5 board quote, 6 quote.
+var inlinePattern = regexp.MustCompile(
+	`\[spoiler\](.+?)\[/spoiler\]` +
+		`|\*\*(.+?)\*\*` +
+		"|(https?://[^\\s<>\"'`]+)" +
+		`|>>>/([a-z0-9]+)/(\d+)` +
+		`|>>(\d+)`,
+)
+
+// Render converts board markup into HTML. All user text is escaped and the
+// only tags emitted are the ones produced here, so the result is safe to
+// embed in a page as-is.
+func Render(content string) string {
+	content = strings.ReplaceAll(content, "\r\n", "\n")
+	lines := strings.Split(content, "\n")
+
+	var b strings.Builder
+	afterBlock := true
+	for i := 0; i < len(lines); i++ {
+		line := lines[i]
+
+		// Fenced code block: everything up to the closing fence is literal
+		if strings.HasPrefix(strings.TrimSpace(line), "```") {
+			var code []string
+			i++
+			for ; i < len(lines); i++ {
+				if strings.HasPrefix(strings.TrimSpace(lines[i]), "```") {
+					break
+				}
+				code = append(code, lines[i])
+			}
+			b.WriteString("<pre><code>")
+			b.WriteString(html.EscapeString(strings.Join(code, "\n")))
+			b.WriteString("</code></pre>")
+			afterBlock = true
+			continue
+		}
+
+		if !afterBlock {
+			b.WriteString("<br>")
+		}
+		afterBlock = false
+
+		if strings.HasPrefix(line, ">") && !quoteLinePattern.MatchString(line) {
+			b.WriteString(`<span class="greentext">`)
+			b.WriteString(renderLine(line))
+			b.WriteString("</span>")
+			continue
+		}
+
+		b.WriteString(renderLine(line))
+	}
+
+	return b.String()
+}
+
+// renderLine renders a single line, keeping inline code spans literal
+func renderLine(line string) string {
+	var b strings.Builder
+	for {
+		loc := codePattern.FindStringSubmatchIndex(line)
+		if loc == nil {
+			b.WriteString(renderText(line))
+			return b.String()
+		}
+		b.WriteString(renderText(line[:loc[0]]))
+		b.WriteString("<code>")
+		b.WriteString(html.EscapeString(line[loc[2]:loc[3]]))
+		b.WriteString("</code>")
+		line = line[loc[1]:]
+	}
+}
+
+// renderText renders spoilers, bold text, links and quotes in text
+func renderText(text string) string {
+	var b strings.Builder
+	last := 0
+	for _, m := range inlinePattern.FindAllStringSubmatchIndex(text, -1) {
+		b.WriteString(html.EscapeString(text[last:m[0]]))
+		last = m[1]
+
+		switch {
+		case m[2] >= 0:
+			b.WriteString(`<span class="spoiler">`)
+			b.WriteString(renderText(text[m[2]:m[3]]))
+			b.WriteString("</span>")
+		case m[4] >= 0:
+			b.WriteString("<strong>")
+			b.WriteString(renderText(text[m[4]:m[5]]))
+			b.WriteString("</strong>")
+		case m[6] >= 0:
+			url := strings.TrimRight(text[m[6]:m[7]], trailingPunct)
+			last = m[6] + len(url)
+			escaped := html.EscapeString(url)
+			b.WriteString(`<a href="` + escaped + `" rel="nofollow noopener noreferrer" target="_blank">`)
+			b.WriteString(escaped)
+			b.WriteString("</a>")
+		case m[8] >= 0:
+			board, id := text[m[8]:m[9]], text[m[10]:m[11]]
+			b.WriteString(`<a class="quotelink" data-board="` + board + `" href="#c` + id + `">`)
+			b.WriteString("&gt;&gt;&gt;/" + board + "/" + id)
+			b.WriteString("</a>")
+		case m[12] >= 0:
+			id := text[m[12]:m[13]]
+			b.WriteString(`<a class="quotelink" href="#c` + id + `">`)
+			b.WriteString("&gt;&gt;" + id)
+			b.WriteString("</a>")
+		}
+	}
+	b.WriteString(html.EscapeString(text[last:]))
+
+	return b.String()
+}
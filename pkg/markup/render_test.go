@@ -0,0 +1,76 @@
+package markup
+
+import (
+	"regexp"
+	"strings"
+	"testing"
+)
+
+func TestRender(t *testing.T) {
+	tests := []struct {
+		name    string
+		content string
+		want    string
+	}{
+		{"plain", "hello", "hello"},
+		{"escapes html", `<script>alert("x")</script>`, "&lt;script&gt;alert(&#34;x&#34;)&lt;/script&gt;"},
+		{"greentext", ">be me\nok", `<span class="greentext">&gt;be me</span><br>ok`},
+		{"quote is not greentext", ">>12 yes", `<a class="quotelink" href="#c12">&gt;&gt;12</a> yes`},
+		{"board quote", ">>>/b/7", `<a class="quotelink" data-board="b" href="#c7">&gt;&gt;&gt;/b/7</a>`},
+		{"spoiler and bold", "[spoiler]**x**[/spoiler]", `<span class="spoiler"><strong>x</strong></span>`},
+		{"inline code", "`**x** <b>`", "<code>**x** &lt;b&gt;</code>"},
+		{"fenced code", "a\n```\n>x **y**\n```\nb", "a<pre><code>&gt;x **y**</code></pre>b"},
+		{"link", "see https://example.com/a?b=1&c=2.", `see <a href="https://example.com/a?b=1&amp;c=2" rel="nofollow noopener noreferrer" target="_blank">https://example.com/a?b=1&amp;c=2</a>.`},
+		{"no javascript links", "javascript:alert(1)", "javascript:alert(1)"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := Render(tt.content); got != tt.want {
+				t.Errorf("Render(%q) = %q, want %q", tt.content, got, tt.want)
+			}
+		})
+	}
+}
+
+var (
+	tagPattern     = regexp.MustCompile(`<[^>]*>`)
+	allowedTagExpr = regexp.MustCompile(`^(?:` +
+		`<br>|<pre>|</pre>|<code>|</code>|<strong>|</strong>|</span>|</a>` +
+		`|<span class="(?:greentext|spoiler)">` +
+		`|<a class="quotelink"(?: data-board="[a-z0-9]+")? href="#c[0-9]+">` +
+		`|<a href="https?://[^"<>]*" rel="nofollow noopener noreferrer" target="_blank">` +
+		`)$`)
+)
+
+func FuzzRender(f *testing.F) {
+	seeds := []string{
+		"",
+		">greentext\n>>123\n>>>/b/1",
+		"[spoiler]secret[/spoiler] **bold** `code`",
+		"```\n<script>alert(1)</script>\n```",
+		`<img src=x onerror="alert(1)">`,
+		"http://x.y/\"onmouseover=\"alert(1)",
+		"https://a.b/<script>",
+		"[spoiler]**[/spoiler]**",
+		"<a href=\"javascript:alert(1)\">x</a>",
+	}
+	for _, seed := range seeds {
+		f.Add(seed)
+	}
+
+	f.Fuzz(func(t *testing.T, content string) {
+		out := Render(content)
+
+		for _, tag := range tagPattern.FindAllString(out, -1) {
+			if !allowedTagExpr.MatchString(tag) {
+				t.Fatalf("Render(%q) emitted disallowed tag %q", content, tag)
+			}
+		}
+
+		rest := tagPattern.ReplaceAllString(out, "")
+		if strings.ContainsAny(rest, "<>") {
+			t.Fatalf("Render(%q) left unescaped markup in %q", content, out)
+		}
+	})
+}
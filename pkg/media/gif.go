@@ -0,0 +1,104 @@
+package media
+
+import (
+	"bufio"
+	"encoding/binary"
+	"io"
+	"time"
+)
+
+// probeGIF walks the blocks of a GIF to count its frames and add up their
+// delays. Frame data is skipped, never decompressed.
+func probeGIF(src *source) (*Info, error) {
+	r := bufio.NewReader(io.NewSectionReader(src, 0, src.size))
+
+	// Header and logical screen descriptor
+	header := make([]byte, 13)
+	if _, err := io.ReadFull(r, header); err != nil {
+		return nil, ErrMalformed
+	}
+	info := &Info{
+		ContentType: "image/gif",
+		Width:       int(binary.LittleEndian.Uint16(header[6:8])),
+		Height:      int(binary.LittleEndian.Uint16(header[8:10])),
+	}
+
+	if flags := header[10]; flags&0x80 != 0 {
+		if _, err := r.Discard(3 << (flags&0x07 + 1)); err != nil {
+			return nil, ErrMalformed
+		}
+	}
+
+	frames := 0
+	var delay time.Duration
+	for {
+		// Files cut off after their last frame are still accepted
+		block, err := r.ReadByte()
+		if err != nil || block == 0x3B {
+			if frames == 0 {
+				return nil, ErrMalformed
+			}
+			info.Animated = frames > 1
+			if info.Animated {
+				info.Duration = delay
+			}
+			return info, nil
+		}
+
+		switch block {
+		case 0x21: // Extension
+			label, err := r.ReadByte()
+			if err != nil {
+				return nil, ErrMalformed
+			}
+			// Graphic control extensions carry the delay of the next frame
+			// in hundredths of a second
+			if label == 0xF9 {
+				if control, err := r.Peek(5); err == nil && control[0] == 4 {
+					delay += time.Duration(binary.LittleEndian.Uint16(control[2:4])) * 10 * time.Millisecond
+				}
+			}
+			if !skipSubBlocks(r) {
+				return nil, ErrMalformed
+			}
+
+		case 0x2C: // Image descriptor
+			descriptor := make([]byte, 9)
+			if _, err := io.ReadFull(r, descriptor); err != nil {
+				return nil, ErrMalformed
+			}
+			if flags := descriptor[8]; flags&0x80 != 0 {
+				if _, err := r.Discard(3 << (flags&0x07 + 1)); err != nil {
+					return nil, ErrMalformed
+				}
+			}
+			// LZW minimum code size, then the image data
+			if _, err := r.ReadByte(); err != nil {
+				return nil, ErrMalformed
+			}
+			if !skipSubBlocks(r) {
+				return nil, ErrMalformed
+			}
+			frames++
+
+		default:
+			return nil, ErrMalformed
+		}
+	}
+}
+
+// skipSubBlocks reads past a chain of GIF data sub-blocks
+func skipSubBlocks(r *bufio.Reader) bool {
+	for {
+		size, err := r.ReadByte()
+		if err != nil {
+			return false
+		}
+		if size == 0 {
+			return true
+		}
+		if _, err := r.Discard(int(size)); err != nil {
+			return false
+		}
+	}
+}
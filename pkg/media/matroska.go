@@ -0,0 +1,313 @@
+package media
+
+import (
+	"encoding/binary"
+	"math"
+	"strings"
+	"time"
+)
+
+var ebmlMagic = []byte{0x1A, 0x45, 0xDF, 0xA3}
+
+// Matroska element IDs, kept with their length marker bits as in the spec
+const (
+	idEBML            = 0x1A45DFA3
+	idDocType         = 0x4282
+	idSegment         = 0x18538067
+	idInfo            = 0x1549A966
+	idTimecodeScale   = 0x2AD7B1
+	idDuration        = 0x4489
+	idTracks          = 0x1654AE6B
+	idTrackEntry      = 0xAE
+	idTrackType       = 0x83
+	idVideo           = 0xE0
+	idPixelWidth      = 0xB0
+	idPixelHeight     = 0xBA
+	idAttachments     = 0x1941A469
+	idAttachedFile    = 0x61A7
+	idFileMimeType    = 0x4660
+	idFileData        = 0x465C
+	idCluster         = 0x1F43B675
+	idClusterTimecode = 0xE7
+	idBlockGroup      = 0xA0
+	idBlock           = 0xA1
+	idSimpleBlock     = 0xA3
+
+	trackTypeVideo = 1
+)
+
+// unknownSize marks elements whose size is not given, as written by live
+// encoders such as browser MediaRecorder
+const unknownSize = -1
+
+// ebmlElement is an element header and the span of its body within the
+// parsed buffer
+type ebmlElement struct {
+	id    uint32
+	start int
+	end   int
+}
+
+// readElement reads the element header at pos. Elements of unknown size
+// extend to the end of data.
+func readElement(data []byte, pos int) (ebmlElement, bool) {
+	id, n := readVint(data, pos, 4, true)
+	if n == 0 {
+		return ebmlElement{}, false
+	}
+	pos += n
+
+	size, m := readVint(data, pos, 8, false)
+	if m == 0 {
+		return ebmlElement{}, false
+	}
+	pos += m
+
+	end := len(data)
+	if size != unknownSize {
+		if size > int64(len(data)-pos) {
+			return ebmlElement{}, false
+		}
+		end = pos + int(size)
+	}
+	return ebmlElement{id: uint32(id), start: pos, end: end}, true
+}
+
+// readVint decodes an EBML variable length integer of at most maxLen
+// bytes. IDs keep their marker bit; sizes with all value bits set decode to
+// unknownSize.
+func readVint(data []byte, pos, maxLen int, keepMarker bool) (int64, int) {
+	if pos >= len(data) || data[pos] == 0 {
+		return 0, 0
+	}
+	length := 1
+	for mask := byte(0x80); data[pos]&mask == 0; mask >>= 1 {
+		length++
+	}
+	if length > maxLen || pos+length > len(data) {
+		return 0, 0
+	}
+
+	value := int64(data[pos])
+	if !keepMarker {
+		value &= int64(0xFF >> length)
+	}
+	allOnes := value == int64(0xFF>>length)
+	for _, b := range data[pos+1 : pos+length] {
+		value = value<<8 | int64(b)
+		allOnes = allOnes && b == 0xFF
+	}
+	if !keepMarker && allOnes {
+		return unknownSize, length
+	}
+	return value, length
+}
+
+func readUint(body []byte) uint64 {
+	var value uint64
+	for _, b := range body {
+		value = value<<8 | uint64(b)
+	}
+	return value
+}
+
+func readFloat(body []byte) float64 {
+	switch len(body) {
+	case 4:
+		return float64(math.Float32frombits(binary.BigEndian.Uint32(body)))
+	case 8:
+		return math.Float64frombits(binary.BigEndian.Uint64(body))
+	}
+	return 0
+}
+
+// children calls fn for each child element of a body with a known size
+func children(data []byte, start, end int, fn func(ebmlElement)) bool {
+	for pos := start; pos < end; {
+		el, ok := readElement(data[:end], pos)
+		if !ok {
+			return false
+		}
+		fn(el)
+		pos = el.end
+	}
+	return true
+}
+
+// fileElement is an element header and the span of its body within the
+// file
+type fileElement struct {
+	id    uint32
+	start int64
+	end   int64
+}
+
+// readFileElement reads the element header at pos of the file. Elements
+// of unknown size extend to the end of the file.
+func readFileElement(src *source, pos int64) (fileElement, bool) {
+	// IDs take at most four bytes and sizes at most eight
+	header := src.bytes(pos, min(src.size-pos, 12))
+	id, n := readVint(header, 0, 4, true)
+	if n == 0 {
+		return fileElement{}, false
+	}
+	size, m := readVint(header, n, 8, false)
+	if m == 0 {
+		return fileElement{}, false
+	}
+	start := pos + int64(n+m)
+
+	end := src.size
+	if size != unknownSize {
+		if size > src.size-start {
+			return fileElement{}, false
+		}
+		end = start + size
+	}
+	return fileElement{id: uint32(id), start: start, end: end}, true
+}
+
+// probeMatroska reads a WebM or Matroska file: the doc type, the first
+// video track's size, the duration from the segment info and a cover image
+// from the attachments. Files without a duration, as written by live
+// encoders, are measured by the timecode of their last block. Only element
+// headers are read from clusters; frames are skipped.
+func probeMatroska(src *source) (*Info, error) {
+	header, ok := readFileElement(src, 0)
+	if !ok || header.id != idEBML || header.end == src.size {
+		return nil, ErrMalformed
+	}
+	data := src.body(header.start, header.end)
+	if data == nil {
+		return nil, ErrMalformed
+	}
+
+	docType := "matroska"
+	children(data, 0, len(data), func(el ebmlElement) {
+		if el.id == idDocType {
+			docType = strings.TrimRight(string(data[el.start:el.end]), "\x00")
+		}
+	})
+
+	info := &Info{Video: true}
+	switch docType {
+	case "webm":
+		info.ContentType = "video/webm"
+	case "matroska":
+		info.ContentType = "video/x-matroska"
+	default:
+		return nil, ErrUnsupported
+	}
+
+	timecodeScale := uint64(1_000_000)
+	var duration float64
+	var clusterTime, lastBlock int64
+	hasVideo := false
+
+	// Segments and clusters are entered rather than skipped, so both can
+	// be of unknown size; their children are told apart by ID
+	for pos := header.end; pos < src.size; {
+		el, ok := readFileElement(src, pos)
+		if !ok {
+			// Trailing garbage after the last complete element is ignored
+			break
+		}
+		pos = el.end
+
+		switch el.id {
+		case idSegment, idCluster, idBlockGroup:
+			pos = el.start
+
+		case idInfo:
+			data := src.body(el.start, el.end)
+			children(data, 0, len(data), func(child ebmlElement) {
+				body := data[child.start:child.end]
+				switch child.id {
+				case idTimecodeScale:
+					if scale := readUint(body); scale > 0 {
+						timecodeScale = scale
+					}
+				case idDuration:
+					duration = readFloat(body)
+				}
+			})
+
+		case idTracks:
+			data := src.body(el.start, el.end)
+			children(data, 0, len(data), func(entry ebmlElement) {
+				if entry.id != idTrackEntry || hasVideo {
+					return
+				}
+				var trackType uint64
+				var width, height uint64
+				children(data, entry.start, entry.end, func(child ebmlElement) {
+					switch child.id {
+					case idTrackType:
+						trackType = readUint(data[child.start:child.end])
+					case idVideo:
+						children(data, child.start, child.end, func(video ebmlElement) {
+							switch video.id {
+							case idPixelWidth:
+								width = readUint(data[video.start:video.end])
+							case idPixelHeight:
+								height = readUint(data[video.start:video.end])
+							}
+						})
+					}
+				})
+				if trackType == trackTypeVideo && width <= math.MaxInt32 && height <= math.MaxInt32 {
+					hasVideo = true
+					info.Width, info.Height = int(width), int(height)
+				}
+			})
+
+		case idAttachments:
+			data := src.body(el.start, el.end)
+			children(data, 0, len(data), func(file ebmlElement) {
+				if file.id != idAttachedFile || info.Poster != nil {
+					return
+				}
+				var mimeType string
+				var fileData []byte
+				children(data, file.start, file.end, func(child ebmlElement) {
+					switch child.id {
+					case idFileMimeType:
+						mimeType = string(data[child.start:child.end])
+					case idFileData:
+						fileData = data[child.start:child.end]
+					}
+				})
+				if strings.HasPrefix(mimeType, "image/") {
+					info.Poster = fileData
+				}
+			})
+
+		case idClusterTimecode:
+			clusterTime = int64(readUint(src.body(el.start, el.end)))
+
+		case idSimpleBlock, idBlock:
+			// Track number, then the block's 16-bit timecode relative to
+			// its cluster
+			block := src.bytes(el.start, min(el.end-el.start, 10))
+			_, n := readVint(block, 0, 8, false)
+			if n > 0 && n+2 <= len(block) {
+				relative := int16(binary.BigEndian.Uint16(block[n:]))
+				lastBlock = max(lastBlock, clusterTime+int64(relative))
+			}
+		}
+	}
+
+	if !hasVideo {
+		return nil, ErrUnsupported
+	}
+
+	if math.IsNaN(duration) || duration <= 0 {
+		duration = float64(lastBlock)
+	}
+	nanoseconds := duration * float64(timecodeScale)
+	if nanoseconds >= math.MaxInt64 {
+		return nil, ErrMalformed
+	}
+	info.Duration = time.Duration(nanoseconds)
+	return info, nil
+}
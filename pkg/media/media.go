@@ -0,0 +1,135 @@
+package media
+
+import (
+	"bytes"
+	"errors"
+	"image"
+	"io"
+	"time"
+
+	// Register the decoders for the still formats boards accept
+	_ "image/jpeg"
+	_ "image/png"
+)
+
+// maxPixels guards against decompression bombs: files whose headers declare
+// more pixels than this are rejected
+const maxPixels = 50_000_000
+
+// maxHeaderSize bounds the metadata read into memory at once, such as an
+// MP4 movie box or the Matroska segment info and tracks
+const maxHeaderSize = 16 << 20
+
+var (
+	ErrUnsupported = errors.New("unsupported media format")
+	ErrMalformed   = errors.New("malformed media file")
+	ErrTooLarge    = errors.New("media dimensions are too large")
+)
+
+// Info describes an uploaded file as read from its own headers
+type Info struct {
+	ContentType string
+	Width       int
+	Height      int
+
+	// Duration is zero for still images
+	Duration time.Duration
+
+	// Video is set for clips, Animated for GIFs with more than one frame
+	Video    bool
+	Animated bool
+
+	// Poster is an encoded still image embedded in a video container, such
+	// as MP4 cover art or a Matroska cover attachment. It is nil when the
+	// container carries none.
+	Poster []byte
+}
+
+// Probe identifies a file of the given size by its content and reads its
+// dimensions and duration without decoding any frames. Only the headers
+// are read; frame data is skipped over, so r can be a file in storage.
+// Only still images, GIFs, WebM or Matroska and MP4 or QuickTime files are
+// recognised.
+func Probe(r io.ReaderAt, size int64) (*Info, error) {
+	src := &source{r: r, size: size}
+	head := src.bytes(0, min(size, 12))
+
+	var info *Info
+	var err error
+	switch {
+	case bytes.HasPrefix(head, []byte("GIF87a")), bytes.HasPrefix(head, []byte("GIF89a")):
+		info, err = probeGIF(src)
+	case bytes.HasPrefix(head, ebmlMagic):
+		info, err = probeMatroska(src)
+	case len(head) >= 8 && string(head[4:8]) == "ftyp":
+		info, err = probeMP4(src)
+	default:
+		info, err = probeImage(src)
+	}
+	// A failed read says nothing about the file
+	if src.err != nil {
+		return nil, src.err
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if info.Width <= 0 || info.Height <= 0 {
+		return nil, ErrMalformed
+	}
+	if info.Width*info.Height > maxPixels {
+		return nil, ErrTooLarge
+	}
+	return info, nil
+}
+
+// source reads a file in place. Reads past its end come back short, as
+// from a truncated file; any other read error is kept for Probe to return.
+type source struct {
+	r    io.ReaderAt
+	size int64
+	err  error
+}
+
+func (s *source) ReadAt(p []byte, off int64) (int, error) {
+	n, err := s.r.ReadAt(p, off)
+	if err != nil && err != io.EOF && s.err == nil {
+		s.err = err
+	}
+	return n, err
+}
+
+// bytes returns the n bytes at off, or nil when they run past the end of
+// the file or could not be read
+func (s *source) bytes(off, n int64) []byte {
+	if off < 0 || n < 0 || n > s.size-off {
+		return nil
+	}
+	buf := make([]byte, n)
+	if read, _ := s.ReadAt(buf, off); read < len(buf) {
+		return nil
+	}
+	return buf
+}
+
+// body returns the bytes from start to end, or nil when they are more than
+// maxHeaderSize or could not be read
+func (s *source) body(start, end int64) []byte {
+	if end-start > maxHeaderSize {
+		return nil
+	}
+	return s.bytes(start, end-start)
+}
+
+func probeImage(src *source) (*Info, error) {
+	config, format, err := image.DecodeConfig(io.NewSectionReader(src, 0, src.size))
+	if err != nil {
+		return nil, ErrUnsupported
+	}
+
+	return &Info{
+		ContentType: "image/" + format,
+		Width:       config.Width,
+		Height:      config.Height,
+	}, nil
+}
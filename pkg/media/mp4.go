@@ -0,0 +1,248 @@
+package media
+
+import (
+	"encoding/binary"
+	"time"
+)
+
+// mp4Box is a box header and the span of its payload within the parsed
+// buffer
+type mp4Box struct {
+	kind  string
+	start int
+	end   int
+}
+
+// boxes calls fn for each box in data[start:end]. A box of size zero
+// extends to the end of the range.
+func boxes(data []byte, start, end int, fn func(mp4Box)) bool {
+	for pos := start; pos+8 <= end; {
+		size := uint64(binary.BigEndian.Uint32(data[pos:]))
+		kind := string(data[pos+4 : pos+8])
+		header := uint64(8)
+
+		switch size {
+		case 0:
+			size = uint64(end - pos)
+		case 1:
+			if pos+16 > end {
+				return false
+			}
+			size = binary.BigEndian.Uint64(data[pos+8:])
+			header = 16
+		}
+		if size < header || size > uint64(end-pos) {
+			return false
+		}
+
+		fn(mp4Box{kind: kind, start: pos + int(header), end: pos + int(size)})
+		pos += int(size)
+	}
+	return true
+}
+
+// fileBoxes calls fn for each top-level box of the file, reading only the
+// box headers. A box of size zero extends to the end of the file.
+func fileBoxes(src *source, fn func(kind string, start, end int64) bool) bool {
+	for pos := int64(0); pos+8 <= src.size; {
+		header := src.bytes(pos, 8)
+		if header == nil {
+			return false
+		}
+		size := uint64(binary.BigEndian.Uint32(header))
+		kind := string(header[4:8])
+		headerSize := uint64(8)
+
+		switch size {
+		case 0:
+			size = uint64(src.size - pos)
+		case 1:
+			large := src.bytes(pos+8, 8)
+			if large == nil {
+				return false
+			}
+			size = binary.BigEndian.Uint64(large)
+			headerSize = 16
+		}
+		if size < headerSize || size > uint64(src.size-pos) {
+			return false
+		}
+
+		if !fn(kind, pos+int64(headerSize), pos+int64(size)) {
+			return false
+		}
+		pos += int64(size)
+	}
+	return true
+}
+
+// probeMP4 reads an MP4 or QuickTime file: the brand, the movie duration,
+// the size of the first video track and cover art from the iTunes-style
+// metadata, if any. Only the file type and movie boxes are read; the media
+// data is skipped.
+func probeMP4(src *source) (*Info, error) {
+	info := &Info{ContentType: "video/mp4", Video: true}
+
+	var timescale, duration, fragmentDuration uint64
+	hasMovie, hasVideo := false, false
+
+	ok := fileBoxes(src, func(kind string, start, end int64) bool {
+		switch kind {
+		case "ftyp":
+			brand := src.bytes(start, min(end-start, 4))
+			if string(brand) == "qt  " {
+				info.ContentType = "video/quicktime"
+			}
+		case "moov":
+			data := src.body(start, end)
+			if data == nil {
+				return false
+			}
+			hasMovie = true
+			boxes(data, 0, len(data), func(child mp4Box) {
+				body := data[child.start:child.end]
+				switch child.kind {
+				case "mvhd":
+					timescale, duration = readMovieHeader(body)
+				case "mvex":
+					boxes(data, child.start, child.end, func(ext mp4Box) {
+						if ext.kind == "mehd" {
+							fragmentDuration = readFullBoxTime(data[ext.start:ext.end], 0)
+						}
+					})
+				case "trak":
+					if !hasVideo {
+						width, height, video := readTrack(data, child)
+						if video {
+							hasVideo = true
+							info.Width, info.Height = width, height
+						}
+					}
+				case "udta":
+					info.Poster = findCoverArt(data, child)
+				}
+			})
+		}
+		return true
+	})
+	if !ok || !hasMovie {
+		return nil, ErrMalformed
+	}
+	if !hasVideo {
+		return nil, ErrUnsupported
+	}
+
+	// Fragmented files may leave the movie header empty and give the
+	// total in the movie extends header instead
+	if duration == 0 {
+		duration = fragmentDuration
+	}
+	if timescale > 0 {
+		seconds := duration / timescale
+		remainder := duration % timescale
+		if seconds > uint64(time.Duration(1<<62)/time.Second) {
+			return nil, ErrMalformed
+		}
+		info.Duration = time.Duration(seconds)*time.Second + time.Duration(remainder*uint64(time.Second)/timescale)
+	}
+	return info, nil
+}
+
+// readMovieHeader returns the timescale and duration of an mvhd box
+func readMovieHeader(body []byte) (timescale, duration uint64) {
+	if len(body) < 4 {
+		return 0, 0
+	}
+	if body[0] == 1 {
+		// Version 1: 64-bit creation and modification times
+		if len(body) < 32 {
+			return 0, 0
+		}
+		return uint64(binary.BigEndian.Uint32(body[20:])), binary.BigEndian.Uint64(body[24:])
+	}
+	if len(body) < 20 {
+		return 0, 0
+	}
+	return uint64(binary.BigEndian.Uint32(body[12:])), uint64(binary.BigEndian.Uint32(body[16:]))
+}
+
+// readFullBoxTime reads a 32 or 64-bit time field at offset from the end of
+// a full box's version and flags, depending on its version
+func readFullBoxTime(body []byte, offset int) uint64 {
+	if len(body) < 4 {
+		return 0
+	}
+	pos := 4 + offset
+	if body[0] == 1 {
+		if len(body) < pos+8 {
+			return 0
+		}
+		return binary.BigEndian.Uint64(body[pos:])
+	}
+	if len(body) < pos+4 {
+		return 0
+	}
+	return uint64(binary.BigEndian.Uint32(body[pos:]))
+}
+
+// readTrack returns the display size of a trak box and whether its handler
+// is a video handler
+func readTrack(data []byte, trak mp4Box) (width, height int, video bool) {
+	boxes(data, trak.start, trak.end, func(child mp4Box) {
+		body := data[child.start:child.end]
+		switch child.kind {
+		case "tkhd":
+			// Width and height are 16.16 fixed point at the end of the box
+			size := 84
+			if len(body) > 0 && body[0] == 1 {
+				size = 96
+			}
+			if len(body) >= size {
+				width = int(binary.BigEndian.Uint32(body[size-8:]) >> 16)
+				height = int(binary.BigEndian.Uint32(body[size-4:]) >> 16)
+			}
+		case "mdia":
+			boxes(data, child.start, child.end, func(mdia mp4Box) {
+				hdlr := data[mdia.start:mdia.end]
+				if mdia.kind == "hdlr" && len(hdlr) >= 12 && string(hdlr[8:12]) == "vide" {
+					video = true
+				}
+			})
+		}
+	})
+	return width, height, video
+}
+
+// findCoverArt looks for udta/meta/ilst/covr/data and returns the image it
+// holds
+func findCoverArt(data []byte, udta mp4Box) []byte {
+	var cover []byte
+	boxes(data, udta.start, udta.end, func(meta mp4Box) {
+		if meta.kind != "meta" || cover != nil {
+			return
+		}
+		// MP4 meta boxes are full boxes; QuickTime ones start with their
+		// children right away
+		start := meta.start
+		if meta.end-start >= 8 && string(data[start+4:start+8]) != "hdlr" {
+			start += 4
+		}
+		boxes(data, start, meta.end, func(ilst mp4Box) {
+			if ilst.kind != "ilst" {
+				return
+			}
+			boxes(data, ilst.start, ilst.end, func(covr mp4Box) {
+				if covr.kind != "covr" {
+					return
+				}
+				boxes(data, covr.start, covr.end, func(value mp4Box) {
+					// Type indicator and locale precede the image
+					if value.kind == "data" && cover == nil && value.end-value.start > 8 {
+						cover = data[value.start+8 : value.end]
+					}
+				})
+			})
+		})
+	})
+	return cover
+}
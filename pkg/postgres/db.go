@@ -40,6 +40,13 @@ func ConnectToDB(connectionString string) *sql.DB {
 func InitDB(db *sql.DB) error {
 	// Create tables if they don't exist
 	queries := []string{
+		`CREATE TABLE IF NOT EXISTS boards (
+			slug VARCHAR(32) PRIMARY KEY,
+			name VARCHAR(255) NOT NULL,
+			bump_limit INTEGER NOT NULL DEFAULT 300,
+			created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+		)`,
+		`INSERT INTO boards (slug, name) VALUES ('b', 'Random') ON CONFLICT (slug) DO NOTHING`,
 		`CREATE TABLE IF NOT EXISTS posts (
 			id SERIAL PRIMARY KEY,
 			title VARCHAR(255) NOT NULL,
@@ -71,10 +78,139 @@ func InitDB(db *sql.DB) error {
 			created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
 			expires_at TIMESTAMP
 		)`,
+		`CREATE TABLE IF NOT EXISTS comment_references (
+			id SERIAL PRIMARY KEY,
+			comment_id INTEGER NOT NULL REFERENCES comments(id) ON DELETE CASCADE,
+			post_id INTEGER NOT NULL REFERENCES posts(id) ON DELETE CASCADE,
+			target_id INTEGER NOT NULL,
+			target_board VARCHAR(32) NOT NULL DEFAULT '',
+			target_post_id INTEGER
+		)`,
+		`CREATE TABLE IF NOT EXISTS reactions (
+			id SERIAL PRIMARY KEY,
+			post_id INTEGER NOT NULL REFERENCES posts(id) ON DELETE CASCADE,
+			comment_id INTEGER REFERENCES comments(id) ON DELETE CASCADE,
+			session_id VARCHAR(255) NOT NULL,
+			emoji VARCHAR(32) NOT NULL,
+			created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+		)`,
+		`CREATE TABLE IF NOT EXISTS polls (
+			id SERIAL PRIMARY KEY,
+			post_id INTEGER NOT NULL UNIQUE REFERENCES posts(id) ON DELETE CASCADE,
+			question TEXT NOT NULL,
+			multiple_choice BOOLEAN NOT NULL DEFAULT FALSE,
+			closes_at TIMESTAMP,
+			created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+		)`,
+		`CREATE TABLE IF NOT EXISTS poll_options (
+			id SERIAL PRIMARY KEY,
+			poll_id INTEGER NOT NULL REFERENCES polls(id) ON DELETE CASCADE,
+			position INTEGER NOT NULL,
+			text VARCHAR(200) NOT NULL,
+			votes INTEGER NOT NULL DEFAULT 0
+		)`,
+		`CREATE TABLE IF NOT EXISTS poll_votes (
+			id SERIAL PRIMARY KEY,
+			poll_id INTEGER NOT NULL REFERENCES polls(id) ON DELETE CASCADE,
+			option_id INTEGER NOT NULL REFERENCES poll_options(id) ON DELETE CASCADE,
+			session_id VARCHAR(255) NOT NULL,
+			created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+			UNIQUE (poll_id, session_id, option_id)
+		)`,
+		`CREATE TABLE IF NOT EXISTS attachments (
+			id SERIAL PRIMARY KEY,
+			post_id INTEGER NOT NULL REFERENCES posts(id) ON DELETE CASCADE,
+			comment_id INTEGER REFERENCES comments(id) ON DELETE CASCADE,
+			position INTEGER NOT NULL,
+			url TEXT NOT NULL,
+			thumbnail_url TEXT NOT NULL DEFAULT '',
+			filename VARCHAR(255) NOT NULL,
+			content_type VARCHAR(255) NOT NULL,
+			size BIGINT NOT NULL,
+			width INTEGER NOT NULL DEFAULT 0,
+			height INTEGER NOT NULL DEFAULT 0,
+			spoiler BOOLEAN NOT NULL DEFAULT FALSE,
+			alt_text TEXT NOT NULL DEFAULT '',
+			created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+		)`,
+		`CREATE TABLE IF NOT EXISTS uploads (
+			id VARCHAR(64) PRIMARY KEY,
+			session_id VARCHAR(255) NOT NULL,
+			bucket VARCHAR(64) NOT NULL,
+			object_name TEXT NOT NULL,
+			filename VARCHAR(255) NOT NULL,
+			content_type VARCHAR(255) NOT NULL,
+			size BIGINT NOT NULL,
+			created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+			expires_at TIMESTAMP NOT NULL
+		)`,
+		`CREATE TABLE IF NOT EXISTS stored_objects (
+			bucket VARCHAR(64) NOT NULL,
+			object_name TEXT NOT NULL,
+			ref_count INTEGER NOT NULL,
+			created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+			PRIMARY KEY (bucket, object_name)
+		)`,
+		`CREATE TABLE IF NOT EXISTS image_bans (
+			id SERIAL PRIMARY KEY,
+			hash VARCHAR(16) NOT NULL,
+			threshold INTEGER NOT NULL,
+			reason TEXT NOT NULL DEFAULT '',
+			created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+		)`,
+		`CREATE TABLE IF NOT EXISTS post_revisions (
+			id SERIAL PRIMARY KEY,
+			post_id INTEGER NOT NULL REFERENCES posts(id) ON DELETE CASCADE,
+			title VARCHAR(255) NOT NULL,
+			content TEXT NOT NULL,
+			image_url TEXT,
+			editor_id VARCHAR(255) NOT NULL,
+			created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+		)`,
+		`CREATE TABLE IF NOT EXISTS comment_revisions (
+			id SERIAL PRIMARY KEY,
+			comment_id INTEGER NOT NULL REFERENCES comments(id) ON DELETE CASCADE,
+			title VARCHAR(255) NOT NULL,
+			content TEXT NOT NULL,
+			image_url TEXT,
+			editor_id VARCHAR(255) NOT NULL,
+			created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+		)`,
+		`CREATE TABLE IF NOT EXISTS filter_rules (
+			id SERIAL PRIMARY KEY,
+			board VARCHAR(32) REFERENCES boards(slug) ON DELETE CASCADE,
+			pattern TEXT NOT NULL,
+			is_regex BOOLEAN NOT NULL DEFAULT FALSE,
+			action VARCHAR(16) NOT NULL,
+			replacement TEXT NOT NULL DEFAULT '',
+			message TEXT NOT NULL DEFAULT '',
+			enabled BOOLEAN NOT NULL DEFAULT TRUE,
+			hits BIGINT NOT NULL DEFAULT 0,
+			last_hit_at TIMESTAMP,
+			created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+		)`,
+		`CREATE TABLE IF NOT EXISTS quarantines (
+			id SERIAL PRIMARY KEY,
+			session_id VARCHAR(255),
+			ip_hash VARCHAR(64),
+			reason TEXT NOT NULL DEFAULT '',
+			created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+		)`,
 		`CREATE INDEX IF NOT EXISTS idx_posts_author_id ON posts(author_id)`,
 		`CREATE INDEX IF NOT EXISTS idx_posts_is_archive ON posts(is_archive)`,
 		`CREATE INDEX IF NOT EXISTS idx_comments_post_id ON comments(post_id)`,
 		`CREATE INDEX IF NOT EXISTS idx_sessions_expires_at ON sessions(expires_at)`,
+		`CREATE INDEX IF NOT EXISTS idx_comment_references_comment_id ON comment_references(comment_id)`,
+		`CREATE INDEX IF NOT EXISTS idx_comment_references_target_id ON comment_references(target_id)`,
+		`CREATE UNIQUE INDEX IF NOT EXISTS idx_reactions_unique ON reactions(post_id, COALESCE(comment_id, 0), session_id, emoji)`,
+		`CREATE INDEX IF NOT EXISTS idx_reactions_session_id ON reactions(session_id, post_id)`,
+		`CREATE INDEX IF NOT EXISTS idx_poll_options_poll_id ON poll_options(poll_id)`,
+		`CREATE INDEX IF NOT EXISTS idx_attachments_post_id ON attachments(post_id)`,
+		`CREATE INDEX IF NOT EXISTS idx_uploads_expires_at ON uploads(expires_at)`,
+		`CREATE INDEX IF NOT EXISTS idx_quarantines_session_id ON quarantines(session_id)`,
+		`CREATE INDEX IF NOT EXISTS idx_quarantines_ip_hash ON quarantines(ip_hash)`,
+		`CREATE INDEX IF NOT EXISTS idx_post_revisions_post_id ON post_revisions(post_id)`,
+		`CREATE INDEX IF NOT EXISTS idx_comment_revisions_comment_id ON comment_revisions(comment_id)`,
 	}
 
 	for _, query := range queries {
@@ -92,6 +228,60 @@ func InitDB(db *sql.DB) error {
 		`UPDATE sessions SET age = 'Unknown' WHERE age IS NULL`,
 		`ALTER TABLE posts ADD COLUMN IF NOT EXISTS author_image TEXT`,
 		`ALTER TABLE comments ADD COLUMN IF NOT EXISTS author_image TEXT`,
+		`ALTER TABLE posts ADD COLUMN IF NOT EXISTS tripcode VARCHAR(32)`,
+		`ALTER TABLE comments ADD COLUMN IF NOT EXISTS tripcode VARCHAR(32)`,
+		`ALTER TABLE posts ADD COLUMN IF NOT EXISTS content_html TEXT`,
+		`ALTER TABLE comments ADD COLUMN IF NOT EXISTS content_html TEXT`,
+		`ALTER TABLE posts ADD COLUMN IF NOT EXISTS board VARCHAR(32) NOT NULL DEFAULT 'b' REFERENCES boards(slug)`,
+		`ALTER TABLE posts ADD COLUMN IF NOT EXISTS bumped_at TIMESTAMP`,
+		`UPDATE posts p SET bumped_at = COALESCE((SELECT MAX(c.created_at) FROM comments c WHERE c.post_id = p.id), p.created_at) WHERE bumped_at IS NULL`,
+		`CREATE INDEX IF NOT EXISTS idx_posts_board_bumped_at ON posts(board, bumped_at DESC)`,
+		`ALTER TABLE comments ADD COLUMN IF NOT EXISTS sage BOOLEAN NOT NULL DEFAULT FALSE`,
+		`ALTER TABLE posts ADD COLUMN IF NOT EXISTS is_sticky BOOLEAN NOT NULL DEFAULT FALSE`,
+		`ALTER TABLE posts ADD COLUMN IF NOT EXISTS is_locked BOOLEAN NOT NULL DEFAULT FALSE`,
+		`UPDATE posts SET expires_at = NULL WHERE expires_at < '1970-01-01'`,
+		// Boards that existed before the cap stay uncapped; new ones get 150
+		`ALTER TABLE boards ADD COLUMN IF NOT EXISTS max_threads INTEGER NOT NULL DEFAULT 0`,
+		`ALTER TABLE boards ALTER COLUMN max_threads SET DEFAULT 150`,
+		`ALTER TABLE boards ADD COLUMN IF NOT EXISTS archive_enabled BOOLEAN NOT NULL DEFAULT TRUE`,
+		`ALTER TABLE posts ADD COLUMN IF NOT EXISTS archived_at TIMESTAMP`,
+		`UPDATE posts SET archived_at = COALESCE(bumped_at, created_at) WHERE is_archive = true AND archived_at IS NULL`,
+		`CREATE INDEX IF NOT EXISTS idx_posts_archived_at ON posts(archived_at) WHERE is_archive = true`,
+		`ALTER TABLE boards ADD COLUMN IF NOT EXISTS reactions TEXT[]`,
+		`ALTER TABLE posts ADD COLUMN IF NOT EXISTS reaction_counts JSONB NOT NULL DEFAULT '{}'`,
+		`ALTER TABLE comments ADD COLUMN IF NOT EXISTS reaction_counts JSONB NOT NULL DEFAULT '{}'`,
+		`ALTER TABLE boards ADD COLUMN IF NOT EXISTS max_attachments INTEGER NOT NULL DEFAULT 4`,
+		`ALTER TABLE boards ADD COLUMN IF NOT EXISTS max_file_size BIGINT NOT NULL DEFAULT 10485760`,
+		`ALTER TABLE boards ADD COLUMN IF NOT EXISTS max_video_duration INTEGER NOT NULL DEFAULT 120`,
+		`ALTER TABLE attachments ADD COLUMN IF NOT EXISTS duration DOUBLE PRECISION NOT NULL DEFAULT 0`,
+		`ALTER TABLE attachments ADD COLUMN IF NOT EXISTS image_hash VARCHAR(16) NOT NULL DEFAULT ''`,
+		`ALTER TABLE attachments ADD COLUMN IF NOT EXISTS held BOOLEAN NOT NULL DEFAULT FALSE`,
+		`CREATE INDEX IF NOT EXISTS idx_attachments_held ON attachments(created_at) WHERE held = true`,
+		`ALTER TABLE boards ADD COLUMN IF NOT EXISTS image_ban_action VARCHAR(16) NOT NULL DEFAULT 'reject'`,
+		`ALTER TABLE posts ADD COLUMN IF NOT EXISTS flagged BOOLEAN NOT NULL DEFAULT FALSE`,
+		`ALTER TABLE comments ADD COLUMN IF NOT EXISTS flagged BOOLEAN NOT NULL DEFAULT FALSE`,
+		`CREATE INDEX IF NOT EXISTS idx_posts_flagged ON posts(created_at) WHERE flagged = true`,
+		`CREATE INDEX IF NOT EXISTS idx_comments_flagged ON comments(created_at) WHERE flagged = true`,
+		`ALTER TABLE posts ADD COLUMN IF NOT EXISTS visibility VARCHAR(16) NOT NULL DEFAULT 'visible'`,
+		`ALTER TABLE comments ADD COLUMN IF NOT EXISTS visibility VARCHAR(16) NOT NULL DEFAULT 'visible'`,
+		`DO $$ BEGIN
+			IF EXISTS (SELECT 1 FROM information_schema.columns WHERE table_name = 'posts' AND column_name = 'shadow_hidden') THEN
+				UPDATE posts SET visibility = 'pending' WHERE shadow_hidden = true;
+				ALTER TABLE posts DROP COLUMN shadow_hidden;
+			END IF;
+			IF EXISTS (SELECT 1 FROM information_schema.columns WHERE table_name = 'comments' AND column_name = 'shadow_hidden') THEN
+				UPDATE comments SET visibility = 'pending' WHERE shadow_hidden = true;
+				ALTER TABLE comments DROP COLUMN shadow_hidden;
+			END IF;
+		END $$`,
+		`CREATE INDEX IF NOT EXISTS idx_posts_pending ON posts(created_at) WHERE visibility = 'pending'`,
+		`CREATE INDEX IF NOT EXISTS idx_comments_pending ON comments(created_at) WHERE visibility = 'pending'`,
+		`ALTER TABLE posts ADD COLUMN IF NOT EXISTS ip_hash VARCHAR(64) NOT NULL DEFAULT ''`,
+		`ALTER TABLE comments ADD COLUMN IF NOT EXISTS ip_hash VARCHAR(64) NOT NULL DEFAULT ''`,
+		`ALTER TABLE posts ADD COLUMN IF NOT EXISTS edited_at TIMESTAMP`,
+		`ALTER TABLE comments ADD COLUMN IF NOT EXISTS edited_at TIMESTAMP`,
+		`ALTER TABLE posts ADD COLUMN IF NOT EXISTS version INTEGER NOT NULL DEFAULT 1`,
+		`ALTER TABLE comments ADD COLUMN IF NOT EXISTS version INTEGER NOT NULL DEFAULT 1`,
 	}
 
 	for _, query := range migrationQueries {
@@ -0,0 +1,121 @@
+package thumbnail
+
+import (
+	"bytes"
+	"errors"
+	"image"
+	"image/color"
+	"image/draw"
+	"image/jpeg"
+	"io"
+
+	// Register the decoders for the formats boards accept
+	_ "image/gif"
+	_ "image/png"
+)
+
+// MaxSize bounds the longer side of generated thumbnails in pixels
+const MaxSize = 250
+
+// maxPixels guards against decompression bombs: images whose header
+// declares more pixels than this are rejected before decoding
+const maxPixels = 50_000_000
+
+var ErrTooLarge = errors.New("image dimensions are too large")
+
+// Probe reads the format and dimensions of an encoded image without decoding
+// the pixel data
+func Probe(data []byte) (format string, width, height int, err error) {
+	return probe(bytes.NewReader(data))
+}
+
+func probe(r io.Reader) (format string, width, height int, err error) {
+	config, format, err := image.DecodeConfig(r)
+	if err != nil {
+		return "", 0, 0, err
+	}
+	if config.Width <= 0 || config.Height <= 0 || config.Width*config.Height > maxPixels {
+		return "", 0, 0, ErrTooLarge
+	}
+	return format, config.Width, config.Height, nil
+}
+
+// Generate decodes an image and renders a JPEG preview whose longer side is
+// at most maxSize pixels. Smaller images are re-encoded at their own size.
+// Transparent areas are flattened onto white.
+func Generate(data []byte, maxSize int) ([]byte, error) {
+	return GenerateFrom(bytes.NewReader(data), maxSize)
+}
+
+// GenerateFrom is Generate for an image read from r, which is read twice:
+// once for the header and once to decode it
+func GenerateFrom(r io.ReadSeeker, maxSize int) ([]byte, error) {
+	if _, _, _, err := probe(r); err != nil {
+		return nil, err
+	}
+	if _, err := r.Seek(0, io.SeekStart); err != nil {
+		return nil, err
+	}
+
+	src, _, err := image.Decode(r)
+	if err != nil {
+		return nil, err
+	}
+
+	bounds := src.Bounds()
+	width, height := fit(bounds.Dx(), bounds.Dy(), maxSize)
+
+	flat := image.NewRGBA(bounds)
+	draw.Draw(flat, bounds, image.NewUniform(color.White), image.Point{}, draw.Src)
+	draw.Draw(flat, bounds, src, bounds.Min, draw.Over)
+
+	var buf bytes.Buffer
+	if err := jpeg.Encode(&buf, downscale(flat, width, height), &jpeg.Options{Quality: 80}); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// fit scales width and height down to fit in a maxSize square, keeping the
+// aspect ratio and at least one pixel per side
+func fit(width, height, maxSize int) (int, int) {
+	if width <= maxSize && height <= maxSize {
+		return width, height
+	}
+	if width >= height {
+		return maxSize, max(1, height*maxSize/width)
+	}
+	return max(1, width*maxSize/height), maxSize
+}
+
+// downscale resizes src to width x height by averaging the source pixels
+// each target pixel covers
+func downscale(src *image.RGBA, width, height int) *image.RGBA {
+	bounds := src.Bounds()
+	if bounds.Dx() == width && bounds.Dy() == height {
+		return src
+	}
+
+	dst := image.NewRGBA(image.Rect(0, 0, width, height))
+	for y := 0; y < height; y++ {
+		y0 := bounds.Min.Y + y*bounds.Dy()/height
+		y1 := max(y0+1, bounds.Min.Y+(y+1)*bounds.Dy()/height)
+		for x := 0; x < width; x++ {
+			x0 := bounds.Min.X + x*bounds.Dx()/width
+			x1 := max(x0+1, bounds.Min.X+(x+1)*bounds.Dx()/width)
+
+			var r, g, b, n uint32
+			for sy := y0; sy < y1; sy++ {
+				for sx := x0; sx < x1; sx++ {
+					offset := src.PixOffset(sx, sy)
+					r += uint32(src.Pix[offset])
+					g += uint32(src.Pix[offset+1])
+					b += uint32(src.Pix[offset+2])
+					n++
+				}
+			}
+			dst.SetRGBA(x, y, color.RGBA{R: uint8(r / n), G: uint8(g / n), B: uint8(b / n), A: 255})
+		}
+	}
+	return dst
+}
@@ -0,0 +1,84 @@
+package tripcode
+
+import (
+	"1337b04rd/pkg/hashkey"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"strings"
+)
+
+// Generator turns "name#password" and "name##password" inputs into a
+// display name and a tripcode. Passwords are only ever held in memory.
+type Generator struct {
+	secret []byte
+}
+
+func NewGenerator(secret string) (*Generator, error) {
+	key, err := hashkey.New(secret, "TRIPCODE_SECRET is not set, secure tripcodes will change on restart")
+	if err != nil {
+		return nil, err
+	}
+	return &Generator{secret: key}, nil
+}
+
+// Parse splits a name field into the name to display and its tripcode.
+// Inputs without a '#' are returned unchanged with an empty tripcode.
+func (g *Generator) Parse(input string) (name, trip string) {
+	idx := strings.Index(input, "#")
+	if idx < 0 {
+		return strings.TrimSpace(input), ""
+	}
+
+	name = strings.TrimSpace(input[:idx])
+	password := input[idx+1:]
+
+	if strings.HasPrefix(password, "#") {
+		password = password[1:]
+		if password == "" {
+			return name, ""
+		}
+		return name, g.Secure(password)
+	}
+
+	if password == "" {
+		return name, ""
+	}
+	return name, Classic(password)
+}
+
+// Secure returns a "!!"-prefixed tripcode keyed with the server secret
+func (g *Generator) Secure(password string) string {
+	mac := hmac.New(sha256.New, g.secret)
+	mac.Write([]byte(password))
+	sum := base64.StdEncoding.EncodeToString(mac.Sum(nil))
+	return "!!" + sum[:10]
+}
+
+// Classic returns a "!"-prefixed tripcode computed the traditional way:
+// crypt(3) of the password with a salt derived from its 2nd and 3rd bytes.
+func Classic(password string) string {
+	replacer := strings.NewReplacer(
+		"&", "&amp;",
+		"\"", "&quot;",
+		"'", "&#39;",
+		"<", "&lt;",
+		">", "&gt;",
+	)
+	pw := []byte(replacer.Replace(password))
+
+	salt := []byte(string(pw) + "H..")[1:3]
+	for i, c := range salt {
+		switch {
+		case c < '.' || c > 'z':
+			salt[i] = '.'
+		case c >= ':' && c <= '@':
+			salt[i] = 'A' + (c - ':')
+		case c >= '[' && c <= '`':
+			salt[i] = 'a' + (c - '[')
+		}
+	}
+
+	hash := desCrypt(pw, salt)
+	return "!" + hash[len(hash)-10:]
+}
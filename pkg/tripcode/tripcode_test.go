@@ -0,0 +1,89 @@
+package tripcode
+
+import (
+	"strings"
+	"testing"
+)
+
+func newGenerator(t *testing.T, secret string) *Generator {
+	t.Helper()
+	g, err := NewGenerator(secret)
+	if err != nil {
+		t.Fatalf("NewGenerator: %v", err)
+	}
+	return g
+}
+
+func TestClassic(t *testing.T) {
+	tests := []struct {
+		password string
+		want     string
+	}{
+		{"password", "!ozOtJW9BFA"},
+		{"tea", "!WokonZwxw2"},
+		{"a", "!ZnBI2EKkq."},
+		{"abc", "!GmgU93SCyE"},
+		{"Kimi", "!36H4.8Nl4Y"},
+		{"a&b", "!vbZwEe8/SY"},
+		{"<3", "!0JTVzlbXog"},
+		{`x"y`, "!mFH1ZDYeBs"},
+		{"ü", "!ImOlOXVvQY"},
+		// crypt(3) only looks at the first eight bytes
+		{"longpass", "!XK69x/vEPo"},
+		{"longpassword", "!XK69x/vEPo"},
+	}
+
+	for _, tt := range tests {
+		if got := Classic(tt.password); got != tt.want {
+			t.Errorf("Classic(%q) = %q, want %q", tt.password, got, tt.want)
+		}
+	}
+}
+
+func TestParse(t *testing.T) {
+	g := newGenerator(t, "secret")
+
+	tests := []struct {
+		input    string
+		name     string
+		tripcode string
+	}{
+		{"Anonymous", "Anonymous", ""},
+		{"  Anonymous  ", "Anonymous", ""},
+		{"Anonymous#password", "Anonymous", "!ozOtJW9BFA"},
+		{"#password", "", "!ozOtJW9BFA"},
+		{"Anonymous#", "Anonymous", ""},
+		{"Anonymous##", "Anonymous", ""},
+		{"Anonymous##password", "Anonymous", g.Secure("password")},
+	}
+
+	for _, tt := range tests {
+		name, tripcode := g.Parse(tt.input)
+		if name != tt.name || tripcode != tt.tripcode {
+			t.Errorf("Parse(%q) = %q, %q, want %q, %q", tt.input, name, tripcode, tt.name, tt.tripcode)
+		}
+	}
+}
+
+func TestSecure(t *testing.T) {
+	g := newGenerator(t, "secret")
+
+	trip := g.Secure("password")
+	if !strings.HasPrefix(trip, "!!") || len(trip) != 12 {
+		t.Fatalf("Secure(%q) = %q, want \"!!\" and 10 characters", "password", trip)
+	}
+	if again := newGenerator(t, "secret").Secure("password"); again != trip {
+		t.Errorf("Secure is not stable for one secret: %q, then %q", trip, again)
+	}
+	if other := g.Secure("passwore"); other == trip {
+		t.Errorf("Secure gave %q for two passwords", trip)
+	}
+	if other := newGenerator(t, "other secret").Secure("password"); other == trip {
+		t.Errorf("Secure gave %q under two secrets", trip)
+	}
+
+	// Without a secret each generator gets its own random key
+	if newGenerator(t, "").Secure("password") == newGenerator(t, "").Secure("password") {
+		t.Errorf("generators without a secret share a key")
+	}
+}